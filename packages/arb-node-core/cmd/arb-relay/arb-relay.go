@@ -184,19 +184,28 @@ func (ar *ArbRelay) Start(parentContext context.Context) (chan bool, error) {
 				logger.Error().Err(err).Msg("relay aborting")
 				return
 			case msg := <-messages:
-				newAcc := msg.FeedItem.BatchItem.Accumulator
-				if recentFeedItems[newAcc] != (time.Time{}) {
-					continue
+				// Take any other messages already received so they can share frames
+				received := []broadcaster.BroadcastFeedMessage{msg}
+				for waiting := len(messages); waiting > 0; waiting-- {
+					received = append(received, <-messages)
 				}
-				recentFeedItems[newAcc] = time.Now()
-				err = ar.broadcaster.BroadcastSingle(msg.FeedItem.PrevAcc, msg.FeedItem.BatchItem, msg.Signature)
+				now := time.Now()
+				newMessages := make([]*broadcaster.BroadcastFeedMessage, 0, len(received))
+				for i := range received {
+					newAcc := received[i].FeedItem.BatchItem.Accumulator
+					if recentFeedItems[newAcc] != (time.Time{}) {
+						continue
+					}
+					recentFeedItems[newAcc] = now
+					newMessages = append(newMessages, &received[i])
+				}
+				err = ar.broadcaster.BroadcastFeedMessages(newMessages)
 				if err != nil {
 					logger.
 						Error().
 						Err(err).
-						Hex("PrevAcc", msg.FeedItem.PrevAcc.Bytes()).
-						Hex("BatchItem", msg.FeedItem.BatchItem.ToBytesWithSeqNum()).
-						Msg("unable to broadcast batch item")
+						Int("count", len(newMessages)).
+						Msg("unable to broadcast batch items")
 				}
 			case ca := <-ar.confirmedAccumulatorChan:
 				ar.broadcaster.ConfirmedAccumulator(ca)
@@ -70,6 +70,9 @@ type InboxReader struct {
 	caughtUpChan         chan bool
 	MessageDeliveryMutex sync.Mutex
 	BroadcastFeed        chan broadcaster.BroadcastFeedMessage
+
+	safeMessageCountMutex sync.Mutex
+	safeMessageCount      *big.Int
 }
 
 func NewInboxReader(
@@ -156,6 +159,24 @@ func (ir *InboxReader) GetSequencerInboxWatcher() *ethbridge.SequencerInboxWatch
 	return ir.sequencerInbox
 }
 
+func (ir *InboxReader) setSafeMessageCount(count *big.Int) {
+	ir.safeMessageCountMutex.Lock()
+	defer ir.safeMessageCountMutex.Unlock()
+	ir.safeMessageCount = new(big.Int).Set(count)
+}
+
+// SafeMessageCount returns the number of inbox messages which were read from
+// sequencer batches in L1 blocks older than the inbox reader delay, or nil if
+// no batches have been read yet
+func (ir *InboxReader) SafeMessageCount() *big.Int {
+	ir.safeMessageCountMutex.Lock()
+	defer ir.safeMessageCountMutex.Unlock()
+	if ir.safeMessageCount == nil {
+		return nil
+	}
+	return new(big.Int).Set(ir.safeMessageCount)
+}
+
 func (ir *InboxReader) isValidSignature(ctx context.Context, message broadcaster.BroadcastFeedMessage) bool {
 	if message.FeedItem.BatchItem.Accumulator.Equals(common.Hash{}) {
 		// Nitro feed message, ignore
@@ -300,6 +321,10 @@ func (ir *InboxReader) getMessages(ctx context.Context, temporarilyParanoid bool
 			if err != nil {
 				return err
 			}
+			var l1MessageCount *big.Int
+			if len(sequencerBatches) > 0 {
+				l1MessageCount = sequencerBatches[len(sequencerBatches)-1].GetAfterCount()
+			}
 			if to.Cmp(currentHeight) == 0 && !reorgingDelayed && !reorgingSequencer {
 				var newCaughtUpTarget *big.Int
 				if len(sequencerBatches) > 0 {
@@ -399,6 +424,10 @@ func (ir *InboxReader) getMessages(ctx context.Context, temporarilyParanoid bool
 					return err
 				}
 			} else {
+				if l1MessageCount != nil {
+					// Everything up to currentHeight is already past the inbox reader delay
+					ir.setSafeMessageCount(l1MessageCount)
+				}
 				delta := new(big.Int).SetUint64(blocksToFetch)
 				if new(big.Int).Add(to, delta).Cmp(currentHeight) >= 0 {
 					delta = delta.Div(delta, big.NewInt(2))
@@ -30,13 +30,13 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
 )
 
-func PrepareArbCore(t *testing.T) (*Monitor, func()) {
+func PrepareArbCore(t testing.TB) (*Monitor, func()) {
 	arbosPath, err := arbos.Path(false)
 	test.FailIfError(t, err)
 	return PrepareArbCoreWithMexe(t, arbosPath)
 }
 
-func PrepareArbCoreWithMexe(t *testing.T, mexe string) (*Monitor, func()) {
+func PrepareArbCoreWithMexe(t testing.TB, mexe string) (*Monitor, func()) {
 	coreConfig := configuration.DefaultCoreSettingsNoMaxExecution()
 	monitor, err := NewInitializedMonitor(t.TempDir(), mexe, coreConfig)
 	test.FailIfError(t, err)
@@ -0,0 +1,287 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package addressindex
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+const (
+	RoleSender    byte = 1
+	RoleRecipient byte = 2
+)
+
+var (
+	headKey         = []byte("h")
+	addressPrefix   = []byte("a")
+	blockListPrefix = []byte("b")
+)
+
+// Entry is a transaction sent or received by an address
+type Entry struct {
+	Block   uint64
+	TxIndex uint64
+	Role    byte
+}
+
+// Index records the transactions each address sent or received. Blocks are
+// indexed as the TxDB adds them, and blocks from before the index was
+// enabled are indexed in the background
+type Index struct {
+	db     ethdb.Database
+	driver *txdb.IndexDriver
+}
+
+// builder indexes blocks for the index's driver
+type builder struct {
+	txDB *txdb.TxDB
+	db   ethdb.Database
+}
+
+func New(txDB *txdb.TxDB, path string) (*Index, error) {
+	db, err := rawdb.NewLevelDBDatabase(path, 0, 0, "", false)
+	if err != nil {
+		return nil, err
+	}
+	next := uint64(0)
+	head, err := db.Get(headKey)
+	if err == nil && len(head) == 8 {
+		next = binary.BigEndian.Uint64(head)
+	}
+	b := &builder{
+		txDB: txDB,
+		db:   db,
+	}
+	return &Index{
+		db:     db,
+		driver: txdb.NewIndexDriver(txDB, b, db, "address", next),
+	}, nil
+}
+
+func encodeUint64(val uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, val)
+	return data
+}
+
+func addressKeyPrefix(account common.Address) []byte {
+	return append(append([]byte{}, addressPrefix...), account.Bytes()...)
+}
+
+func addressKey(account common.Address, block uint64, txIndex uint64) []byte {
+	key := addressKeyPrefix(account)
+	key = append(key, encodeUint64(block)...)
+	return append(key, encodeUint64(txIndex)...)
+}
+
+func blockListKey(block uint64) []byte {
+	return append(append([]byte{}, blockListPrefix...), encodeUint64(block)...)
+}
+
+// IndexedHeight returns the number of the first block which hasn't been
+// indexed yet
+func (i *Index) IndexedHeight() uint64 {
+	return i.driver.Next()
+}
+
+type blockEntries struct {
+	accounts []common.Address
+	roles    map[common.Address]map[uint64]byte
+}
+
+func (e *blockEntries) add(account common.Address, txIndex uint64, role byte) {
+	txRoles, ok := e.roles[account]
+	if !ok {
+		txRoles = make(map[uint64]byte)
+		e.roles[account] = txRoles
+		e.accounts = append(e.accounts, account)
+	}
+	txRoles[txIndex] |= role
+}
+
+func getBlockEntries(txResults []*evm.TxResult) *blockEntries {
+	entries := &blockEntries{roles: make(map[common.Address]map[uint64]byte)}
+	for _, tx := range evm.FilterEthTxResults(txResults) {
+		txIndex := tx.Result.TxIndex.Uint64()
+		entries.add(tx.Result.IncomingRequest.Sender.ToEthAddress(), txIndex, RoleSender)
+		if tx.Tx.To() != nil {
+			entries.add(*tx.Tx.To(), txIndex, RoleRecipient)
+		} else if tx.Result.ResultCode == evm.ReturnCode {
+			if created, ok := tx.Result.GetCreatedContractAddress(); ok {
+				entries.add(created, txIndex, RoleRecipient)
+			}
+		}
+	}
+	return entries
+}
+
+// writeBlock returns a function storing the block's entries for the driver
+func writeBlock(db ethdb.Database, height uint64, blockHash common.Hash, entries *blockEntries) func() error {
+	return func() error {
+		batch := db.NewBatch()
+		blockList := append([]byte{}, blockHash.Bytes()...)
+		for _, account := range entries.accounts {
+			blockList = append(blockList, account.Bytes()...)
+			for txIndex, role := range entries.roles[account] {
+				if err := batch.Put(addressKey(account, height, txIndex), []byte{role}); err != nil {
+					return err
+				}
+			}
+		}
+		if err := batch.Put(blockListKey(height), blockList); err != nil {
+			return err
+		}
+		if err := batch.Put(headKey, encodeUint64(height+1)); err != nil {
+			return err
+		}
+		return batch.Write()
+	}
+}
+
+// AddBlock indexes the block immediately if it's the next one, otherwise it
+// wakes up the background thread to catch up
+func (i *Index) AddBlock(block *machine.BlockInfo, _ *evm.BlockInfo, txResults []*evm.TxResult) error {
+	height := block.Header.Number.Uint64()
+	return i.driver.AddUnit(height, writeBlock(i.db, height, block.Header.Hash(), getBlockEntries(txResults)))
+}
+
+func (i *Index) Reorg(height uint64) error {
+	return i.driver.Reorg(height)
+}
+
+func (i *Index) Start(ctx context.Context) error {
+	return i.driver.Start(ctx, i)
+}
+
+func (b *builder) UnitsAvailable(blockCount uint64) uint64 {
+	return blockCount
+}
+
+func (b *builder) ReorgUnit(height uint64) uint64 {
+	return height
+}
+
+func (b *builder) Truncate(start, end uint64) error {
+	batch := b.db.NewBatch()
+	for block := start; block < end; block++ {
+		blockList, err := b.db.Get(blockListKey(block))
+		if err != nil {
+			continue
+		}
+		for offset := common.HashLength; offset+common.AddressLength <= len(blockList); offset += common.AddressLength {
+			prefix := addressKeyPrefix(common.BytesToAddress(blockList[offset : offset+common.AddressLength]))
+			prefix = append(prefix, encodeUint64(block)...)
+			it := b.db.NewIterator(prefix, nil)
+			for it.Next() {
+				if err := batch.Delete(it.Key()); err != nil {
+					it.Release()
+					return err
+				}
+			}
+			it.Release()
+		}
+		if err := batch.Delete(blockListKey(block)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Put(headKey, encodeUint64(start)); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+func (b *builder) Valid(block uint64) (bool, error) {
+	blockList, err := b.db.Get(blockListKey(block))
+	if err != nil || len(blockList) < common.HashLength {
+		return false, nil
+	}
+	info, err := b.txDB.GetBlock(block)
+	if err != nil {
+		return false, err
+	}
+	return info != nil && info.Header.Hash() == common.BytesToHash(blockList[:common.HashLength]), nil
+}
+
+func (b *builder) Build(height uint64) (func() error, error) {
+	block, err := b.txDB.GetBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errors.Errorf("block %v not found", height)
+	}
+	blockLog, txResults, err := b.txDB.GetBlockResults(block)
+	if err != nil {
+		return nil, err
+	}
+	if blockLog == nil {
+		return nil, errors.New("block reorged while indexing")
+	}
+	return writeBlock(b.db, height, block.Header.Hash(), getBlockEntries(txResults)), nil
+}
+
+// Transactions returns up to limit transactions sent or received by the
+// account, ordered by block and index, starting at the given position and
+// ending at block end inclusive. The second return value is the position
+// to continue from, or nil if there are no more entries
+func (i *Index) Transactions(account common.Address, startBlock, startTxIndex, end uint64, limit int) ([]Entry, *Entry) {
+	var entries []Entry
+	var more *Entry
+	i.driver.View(func(next uint64) {
+		entries, more = i.transactions(account, startBlock, startTxIndex, end, limit, next)
+	})
+	return entries, more
+}
+
+// transactions must be called from within View so that a reorg can't remove
+// the entries as they're read
+func (i *Index) transactions(account common.Address, startBlock, startTxIndex, end uint64, limit int, next uint64) ([]Entry, *Entry) {
+	prefix := addressKeyPrefix(account)
+	start := append(encodeUint64(startBlock), encodeUint64(startTxIndex)...)
+	it := i.db.NewIterator(prefix, start)
+	defer it.Release()
+	entries := make([]Entry, 0)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+16 || len(it.Value()) != 1 {
+			continue
+		}
+		entry := Entry{
+			Block:   binary.BigEndian.Uint64(key[len(prefix) : len(prefix)+8]),
+			TxIndex: binary.BigEndian.Uint64(key[len(prefix)+8:]),
+			Role:    it.Value()[0],
+		}
+		if entry.Block > end || entry.Block >= next {
+			break
+		}
+		if len(entries) >= limit {
+			return entries, &entry
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/arblog"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/bloomindex"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
@@ -47,6 +48,9 @@ type Server struct {
 	batch   batcher.TransactionBatcher
 	db      *txdb.TxDB
 	scope   event.SubscriptionScope
+
+	finality   *FinalityTracker
+	bloomIndex *bloomindex.Index
 }
 
 // NewServer returns a new instance of the Server class
@@ -62,6 +66,18 @@ func NewServer(
 	}
 }
 
+// SetFinalityTracker enables the safe and finalized block tags. It must be
+// called before the server starts handling requests
+func (m *Server) SetFinalityTracker(finality *FinalityTracker) {
+	m.finality = finality
+}
+
+// SetBloomIndex makes log filters use the given bloombits. It must be called
+// before the server starts handling requests
+func (m *Server) SetBloomIndex(bloomIndex *bloomindex.Index) {
+	m.bloomIndex = bloomIndex
+}
+
 // SendTransaction takes a request signed transaction l2message from a Client
 // and puts it in a queue to be included in the next transaction batch
 func (m *Server) SendTransaction(ctx context.Context, tx *types.Transaction) error {
@@ -89,6 +105,24 @@ func (m *Server) BlockNum(block *rpc.BlockNumber) (uint64, error) {
 			return 0, err
 		}
 		return latest.Header.Number.Uint64(), nil
+	} else if *block == SafeBlockNumber {
+		var safe *uint64
+		if m.finality != nil {
+			safe = m.finality.SafeBlock()
+		}
+		if safe == nil {
+			return 0, errors.New("safe block not found")
+		}
+		return *safe, nil
+	} else if *block == FinalizedBlockNumber {
+		var finalized *uint64
+		if m.finality != nil {
+			finalized = m.finality.FinalizedBlock()
+		}
+		if finalized == nil {
+			return 0, errors.New("finalized block not found")
+		}
+		return *finalized, nil
 	} else if *block >= 0 {
 		return uint64(*block), nil
 	} else {
@@ -121,6 +155,19 @@ func (m *Server) GetL2ToL1Proof(batchNumber *big.Int, index uint64) (*evm.Merkle
 	return batch.GenerateProof(index)
 }
 
+// TxPoolContent returns the transactions the batcher hasn't sequenced yet
+func (m *Server) TxPoolContent() (*batcher.TxPoolContent, error) {
+	reader, ok := m.batch.(batcher.TxPoolReader)
+	if !ok {
+		return nil, errors.New("transaction pool not available")
+	}
+	content := reader.TxPoolContent()
+	if content == nil {
+		return nil, errors.New("transaction pool not available")
+	}
+	return content, nil
+}
+
 func (m *Server) ChainId() *big.Int {
 	return m.chainId
 }
@@ -265,11 +312,16 @@ func (m *Server) PendingBlockAndReceipts() (*types.Block, types.Receipts) {
 }
 
 func (m *Server) BloomStatus() (uint64, uint64) {
-	return 0, 0
+	if m.bloomIndex == nil {
+		return 0, 0
+	}
+	return m.bloomIndex.Status()
 }
 
-func (m *Server) ServiceFilter(_ context.Context, _ *bloombits.MatcherSession) {
-	// Currently not implemented
+func (m *Server) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
+	if m.bloomIndex != nil {
+		m.bloomIndex.ServiceFilter(ctx, session)
+	}
 }
 
 func (m *Server) SubscribeNewTxsEvent(ch chan<- ethcore.NewTxsEvent) event.Subscription {
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregator
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
+)
+
+// Upstream go-ethereum parses the safe and finalized block tags as these
+// block numbers
+const (
+	SafeBlockNumber      = rpc.BlockNumber(-4)
+	FinalizedBlockNumber = rpc.BlockNumber(-3)
+)
+
+const finalityUpdateInterval = 5 * time.Second
+
+// FinalityTracker follows the latest L2 block whose sequencer batch is
+// past the inbox reader delay on L1 and the latest L2 block covered by a
+// confirmed rollup node
+type FinalityTracker struct {
+	db          *txdb.TxDB
+	inboxReader *monitor.InboxReader
+	rollup      *ethbridge.RollupWatcher
+
+	// Only accessed by the update thread
+	confirmedNode     *big.Int
+	confirmedLogCount *big.Int
+
+	mutex          sync.Mutex
+	safeBlock      *uint64
+	finalizedBlock *uint64
+}
+
+// NewFinalityTracker creates a tracker. Either inboxReader or rollup may be
+// nil, in which case the corresponding block tag is never available
+func NewFinalityTracker(db *txdb.TxDB, inboxReader *monitor.InboxReader, rollup *ethbridge.RollupWatcher) *FinalityTracker {
+	return &FinalityTracker{
+		db:          db,
+		inboxReader: inboxReader,
+		rollup:      rollup,
+	}
+}
+
+func (f *FinalityTracker) SafeBlock() *uint64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.safeBlock
+}
+
+func (f *FinalityTracker) FinalizedBlock() *uint64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.finalizedBlock
+}
+
+func (f *FinalityTracker) updateSafe() error {
+	if f.inboxReader == nil {
+		return nil
+	}
+	messageCount := f.inboxReader.SafeMessageCount()
+	if messageCount == nil {
+		return nil
+	}
+	block, err := f.db.LatestBlockWithMessageCount(messageCount)
+	if err != nil || block == nil {
+		return err
+	}
+	height := block.Header.Number.Uint64()
+	f.mutex.Lock()
+	f.safeBlock = &height
+	f.mutex.Unlock()
+	return nil
+}
+
+func (f *FinalityTracker) updateFinalized(ctx context.Context) error {
+	if f.rollup == nil {
+		return nil
+	}
+	confirmedNode, err := f.rollup.LatestConfirmedNode(ctx)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get latest confirmed node")
+	}
+	if f.confirmedNode == nil || f.confirmedNode.Cmp(confirmedNode) != 0 {
+		nodeInfo, err := f.rollup.LookupNode(ctx, confirmedNode)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't lookup confirmed node %v", confirmedNode)
+		}
+		f.confirmedNode = confirmedNode
+		f.confirmedLogCount = nodeInfo.AfterState().TotalLogCount
+	}
+	// The node may be ahead of what this node has processed so far, so keep
+	// checking even if the confirmed node hasn't changed
+	block, err := f.db.LatestBlockWithLogCount(f.confirmedLogCount)
+	if err != nil || block == nil {
+		return err
+	}
+	height := block.Header.Number.Uint64()
+	f.mutex.Lock()
+	f.finalizedBlock = &height
+	f.mutex.Unlock()
+	return nil
+}
+
+func (f *FinalityTracker) Start(ctx context.Context) {
+	go func() {
+		for {
+			if err := f.updateSafe(); err != nil {
+				logger.Warn().Err(err).Msg("failed to update safe block")
+			}
+			if err := f.updateFinalized(ctx); err != nil {
+				logger.Warn().Err(err).Msg("failed to update finalized block")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(finalityUpdateInterval):
+			}
+		}
+	}()
+}
@@ -97,6 +97,7 @@ type Batcher struct {
 	pendingBatch       batch
 	pendingSentBatches *list.List
 	newTxFeed          event.Feed
+	txFilter           TxFilter
 }
 
 func NewStatefulBatcher(
@@ -321,6 +322,12 @@ func (m *Batcher) PendingTransactionCount(_ context.Context, account common.Addr
 	return &count, nil
 }
 
+// SetTxFilter sets the filter checked before accepting transactions. It must
+// be called before the batcher starts receiving transactions
+func (m *Batcher) SetTxFilter(filter TxFilter) {
+	m.txFilter = filter
+}
+
 // SendTransaction takes a request signed transaction l2message from a client
 // and puts it in a queue to be included in the next transaction batch
 func (m *Batcher) SendTransaction(ctx context.Context, tx *types.Transaction) error {
@@ -329,6 +336,9 @@ func (m *Batcher) SendTransaction(ctx context.Context, tx *types.Transaction) er
 		logger.Warn().Err(err).Msg("error processing user transaction")
 		return err
 	}
+	if err := filterTransaction(ctx, m.txFilter, tx, sender); err != nil {
+		return err
+	}
 
 	monitor.GlobalMonitor.GotTransactionFromUser(common.NewHashFromEth(tx.Hash()))
 
@@ -19,11 +19,17 @@ package batcher
 import (
 	"context"
 	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum"
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/pkg/errors"
 
@@ -32,9 +38,75 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
 )
 
+const forwarderHealthCheckTimeout = 5 * time.Second
+
+var metricNameSanitizer = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+type forwardTarget struct {
+	url           string
+	client        *ethclient.Client
+	healthyAtomic int32
+	latency       metrics.Timer
+	errors        metrics.Meter
+}
+
+func newForwardTarget(ctx context.Context, url string) (*forwardTarget, error) {
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.Trim(metricNameSanitizer.ReplaceAllString(url, "_"), "_")
+	return &forwardTarget{
+		url:           url,
+		client:        client,
+		healthyAtomic: 1,
+		latency:       metrics.GetOrRegisterTimer("arbitrum/forwarder/target/"+name+"/latency", nil),
+		errors:        metrics.GetOrRegisterMeter("arbitrum/forwarder/target/"+name+"/errors", nil),
+	}, nil
+}
+
+func (t *forwardTarget) healthy() bool {
+	return atomic.LoadInt32(&t.healthyAtomic) != 0
+}
+
+func (t *forwardTarget) setHealthy(healthy bool) {
+	var val int32
+	if healthy {
+		val = 1
+	}
+	if atomic.SwapInt32(&t.healthyAtomic, val) != val {
+		logger.Info().Str("target", t.url).Bool("healthy", healthy).Msg("forwarding target health changed")
+	}
+}
+
+// observe records the outcome of a request to the target. Errors returned
+// by the target's RPC handler don't count against its health
+func (t *forwardTarget) observe(start time.Time, err error) {
+	t.latency.UpdateSince(start)
+	if err != nil && !isRPCError(err) {
+		t.errors.Mark(1)
+		t.setHealthy(false)
+	}
+}
+
+func isRPCError(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr)
+}
+
+// Forwarder sends transactions to another node. With several targets, it
+// prefers the one holding the sequencer lockout if that can be looked up,
+// then healthy targets in the order they were configured, and retries on
+// the next target if one can't be reached
 type Forwarder struct {
-	client     *ethclient.Client
+	mutex         sync.RWMutex
+	targets       []*forwardTarget
+	activeTarget  func(ctx context.Context) string
+	activeURL     string
+	checkInterval time.Duration
+
 	aggregator *common.Address
+	txFilter   TxFilter
 }
 
 type AggregatorInfo struct {
@@ -42,9 +114,20 @@ type AggregatorInfo struct {
 }
 
 func NewForwarder(ctx context.Context, config configuration.Forwarder) (*Forwarder, error) {
-	client, err := ethclient.DialContext(ctx, config.Target)
-	if err != nil {
-		return nil, err
+	urls := append([]string{config.Target}, config.Targets...)
+	targets := make([]*forwardTarget, 0, len(urls))
+	for _, url := range urls {
+		if len(url) == 0 {
+			continue
+		}
+		target, err := newForwardTarget(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("no forwarding target")
 	}
 
 	var agg *common.Address
@@ -52,7 +135,7 @@ func NewForwarder(ctx context.Context, config configuration.Forwarder) (*Forward
 		tmp := common.HexToAddress(config.Submitter)
 		agg = &tmp
 	} else {
-		rpcClient, err := rpc.DialContext(ctx, config.Target)
+		rpcClient, err := rpc.DialContext(ctx, targets[0].url)
 		if err != nil {
 			return nil, err
 		}
@@ -73,21 +156,97 @@ func NewForwarder(ctx context.Context, config configuration.Forwarder) (*Forward
 		}
 	}
 
-	return &Forwarder{client: client, aggregator: agg}, nil
+	return &Forwarder{
+		targets:       targets,
+		checkInterval: config.HealthCheckInterval,
+		aggregator:    agg,
+	}, nil
+}
+
+// SetActiveTargetSource sets a function returning the URL of the sequencer
+// holding the lockout, which is then preferred over the configured order.
+// It must be called before Start
+func (b *Forwarder) SetActiveTargetSource(activeTarget func(ctx context.Context) string) {
+	b.activeTarget = activeTarget
+}
+
+// orderedTargets returns the targets in the order they should be tried
+func (b *Forwarder) orderedTargets() []*forwardTarget {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	ordered := make([]*forwardTarget, 0, len(b.targets))
+	var unhealthy []*forwardTarget
+	for _, target := range b.targets {
+		if target.url == b.activeURL && target.healthy() {
+			ordered = append([]*forwardTarget{target}, ordered...)
+		} else if target.healthy() {
+			ordered = append(ordered, target)
+		} else {
+			unhealthy = append(unhealthy, target)
+		}
+	}
+	// Still try unhealthy targets as a last resort
+	return append(ordered, unhealthy...)
+}
+
+// withTarget calls f on each target in turn until one can be reached
+func (b *Forwarder) withTarget(f func(target *forwardTarget) error) error {
+	var err error
+	for i, target := range b.orderedTargets() {
+		if i > 0 {
+			logger.Warn().Err(err).Str("target", target.url).Msg("retrying on next forwarding target")
+		}
+		start := time.Now()
+		err = f(target)
+		target.observe(start, err)
+		if err == nil || isRPCError(err) {
+			return err
+		}
+	}
+	return err
 }
 
 // Return nil if no pending transaction count is available
 func (b *Forwarder) PendingTransactionCount(ctx context.Context, account common.Address) (*uint64, error) {
-	nonce, err := b.client.PendingNonceAt(ctx, account.ToEthAddress())
+	var nonce uint64
+	err := b.withTarget(func(target *forwardTarget) error {
+		var err error
+		nonce, err = target.client.PendingNonceAt(ctx, account.ToEthAddress())
+		return err
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "error fetching pending nonce from forwarding target")
 	}
 	return &nonce, nil
 }
 
+// SetTxFilter sets the filter checked before forwarding transactions. It must
+// be called before the forwarder starts receiving transactions
+func (b *Forwarder) SetTxFilter(filter TxFilter) {
+	b.txFilter = filter
+}
+
 func (b *Forwarder) SendTransaction(ctx context.Context, tx *types.Transaction) error {
 	logger.Info().Str("hash", tx.Hash().String()).Msg("got user tx")
-	return b.client.SendTransaction(ctx, tx)
+	if b.txFilter != nil {
+		sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			return err
+		}
+		if err := filterTransaction(ctx, b.txFilter, tx, sender); err != nil {
+			return err
+		}
+	}
+	attempts := 0
+	return b.withTarget(func(target *forwardTarget) error {
+		attempts++
+		err := target.client.SendTransaction(ctx, tx)
+		if err != nil && attempts > 1 && isRPCError(err) && strings.Contains(err.Error(), "already known") {
+			// An earlier target received the transaction before failing
+			return nil
+		}
+		return err
+	})
 }
 
 func (b *Forwarder) PendingSnapshot(_ context.Context) (*snapshot.Snapshot, error) {
@@ -98,5 +257,80 @@ func (b *Forwarder) Aggregator() *common.Address {
 	return b.aggregator
 }
 
-func (m *Forwarder) Start(ctx context.Context) {
+// Start health checks the targets if there's more than one or the active
+// sequencer can be looked up
+func (b *Forwarder) Start(ctx context.Context) {
+	if b.checkInterval <= 0 || (len(b.targets) < 2 && b.activeTarget == nil) {
+		return
+	}
+	for {
+		b.checkTargets(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.checkInterval):
+		}
+	}
+}
+
+// Must be called with the mutex held
+func (b *Forwarder) hasTarget(url string) bool {
+	for _, target := range b.targets {
+		if target.url == url {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Forwarder) checkTargets(ctx context.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx, forwarderHealthCheckTimeout)
+	defer cancel()
+	if b.activeTarget != nil {
+		activeURL := b.activeTarget(checkCtx)
+		b.mutex.Lock()
+		if activeURL != b.activeURL {
+			logger.Info().Str("target", activeURL).Msg("active sequencer changed")
+			b.activeURL = activeURL
+		}
+		known := b.hasTarget(activeURL)
+		b.mutex.Unlock()
+
+		// Dial without the mutex held so that transactions can still be
+		// forwarded to the other targets in the meantime
+		if !known && len(activeURL) != 0 {
+			target, err := newForwardTarget(checkCtx, activeURL)
+			if err != nil {
+				logger.Warn().Err(err).Str("target", activeURL).Msg("failed to connect to active sequencer")
+			} else {
+				b.mutex.Lock()
+				if b.hasTarget(activeURL) {
+					target.client.Close()
+				} else {
+					b.targets = append(b.targets, target)
+				}
+				b.mutex.Unlock()
+			}
+		}
+	}
+
+	b.mutex.RLock()
+	targets := append([]*forwardTarget{}, b.targets...)
+	b.mutex.RUnlock()
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target *forwardTarget) {
+			defer wg.Done()
+			start := time.Now()
+			_, err := target.client.ChainID(checkCtx)
+			target.latency.UpdateSince(start)
+			if err != nil {
+				target.errors.Mark(1)
+				logger.Warn().Err(err).Str("target", target.url).Msg("forwarding target health check failed")
+			}
+			target.setHealthy(err == nil)
+		}(target)
+	}
+	wg.Wait()
 }
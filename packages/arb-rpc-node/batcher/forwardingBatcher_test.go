@@ -0,0 +1,222 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+type forwarderTestService struct {
+	received int32
+	err      error
+}
+
+func (s *forwarderTestService) SendRawTransaction(_ context.Context, data hexutil.Bytes) (ethcommon.Hash, error) {
+	atomic.AddInt32(&s.received, 1)
+	if s.err != nil {
+		return ethcommon.Hash{}, s.err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(data); err != nil {
+		return ethcommon.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+func (s *forwarderTestService) ChainId() hexutil.Big {
+	return hexutil.Big(*big.NewInt(42161))
+}
+
+func newForwarderTestServer(t *testing.T, service *forwarderTestService) *httptest.Server {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(server)
+}
+
+func TestForwarderFailover(t *testing.T) {
+	ctx := context.Background()
+	down := newForwarderTestServer(t, &forwarderTestService{})
+	down.Close()
+	standbyService := &forwarderTestService{}
+	standby := newForwarderTestServer(t, standbyService)
+	defer standby.Close()
+
+	forwarder, err := NewForwarder(ctx, configuration.Forwarder{
+		Target:    down.URL,
+		Targets:   []string{standby.URL},
+		Submitter: "0x0000000000000000000000000000000000000001",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, Gas: 21000, GasPrice: big.NewInt(1)})
+	if err := forwarder.SendTransaction(ctx, tx); err != nil {
+		t.Fatal("failed to forward transaction", err)
+	}
+	if atomic.LoadInt32(&standbyService.received) != 1 {
+		t.Error("standby didn't receive transaction")
+	}
+	if forwarder.targets[0].healthy() {
+		t.Error("unreachable target still healthy")
+	}
+	if ordered := forwarder.orderedTargets(); ordered[0].url != standby.URL {
+		t.Error("healthy target not tried first")
+	}
+
+	// A health check marks the standby healthy and the unreachable target not
+	forwarder.checkTargets(ctx)
+	if !forwarder.targets[1].healthy() || forwarder.targets[0].healthy() {
+		t.Error("wrong target health after check")
+	}
+}
+
+func TestForwarderRPCErrorNotRetried(t *testing.T) {
+	ctx := context.Background()
+	primaryService := &forwarderTestService{err: errors.New("nonce too low")}
+	primary := newForwarderTestServer(t, primaryService)
+	defer primary.Close()
+	standbyService := &forwarderTestService{}
+	standby := newForwarderTestServer(t, standbyService)
+	defer standby.Close()
+
+	forwarder, err := NewForwarder(ctx, configuration.Forwarder{
+		Target:    primary.URL,
+		Targets:   []string{standby.URL},
+		Submitter: "0x0000000000000000000000000000000000000001",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, Gas: 21000, GasPrice: big.NewInt(1)})
+	if err := forwarder.SendTransaction(ctx, tx); err == nil {
+		t.Error("expected error from target")
+	}
+	if atomic.LoadInt32(&standbyService.received) != 0 {
+		t.Error("transaction retried after target rejected it")
+	}
+	if !forwarder.targets[0].healthy() {
+		t.Error("target rejecting transaction marked unhealthy")
+	}
+}
+
+func TestForwarderActiveTarget(t *testing.T) {
+	ctx := context.Background()
+	primary := newForwarderTestServer(t, &forwarderTestService{})
+	defer primary.Close()
+	activeService := &forwarderTestService{}
+	active := newForwarderTestServer(t, activeService)
+	defer active.Close()
+
+	forwarder, err := NewForwarder(ctx, configuration.Forwarder{
+		Target:    primary.URL,
+		Submitter: "0x0000000000000000000000000000000000000001",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarder.SetActiveTargetSource(func(context.Context) string {
+		return active.URL
+	})
+	forwarder.checkTargets(ctx)
+
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, Gas: 21000, GasPrice: big.NewInt(1)})
+	if err := forwarder.SendTransaction(ctx, tx); err != nil {
+		t.Fatal("failed to forward transaction", err)
+	}
+	if atomic.LoadInt32(&activeService.received) != 1 {
+		t.Error("transaction not sent to lockout holder")
+	}
+}
+
+func TestForwarderDialsActiveTargetUnlocked(t *testing.T) {
+	ctx := context.Background()
+	primaryService := &forwarderTestService{}
+	primary := newForwarderTestServer(t, primaryService)
+	defer primary.Close()
+
+	// The active sequencer accepts connections but never completes the
+	// websocket handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	forwarder, err := NewForwarder(ctx, configuration.Forwarder{
+		Target:    primary.URL,
+		Submitter: "0x0000000000000000000000000000000000000001",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarder.SetActiveTargetSource(func(context.Context) string {
+		return "ws://" + listener.Addr().String()
+	})
+	checked := make(chan struct{})
+	go func() {
+		forwarder.checkTargets(ctx)
+		close(checked)
+	}()
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("active sequencer wasn't dialed")
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, Gas: 21000, GasPrice: big.NewInt(1)})
+	if err := forwarder.SendTransaction(sendCtx, tx); err != nil {
+		t.Fatal("transaction blocked while dialing active sequencer", err)
+	}
+	if atomic.LoadInt32(&primaryService.received) != 1 {
+		t.Error("transaction not sent to primary target")
+	}
+
+	// The dial gives up with the health check rather than hanging
+	select {
+	case <-checked:
+	case <-time.After(2 * forwarderHealthCheckTimeout):
+		t.Fatal("health check didn't time out dialing active sequencer")
+	}
+}
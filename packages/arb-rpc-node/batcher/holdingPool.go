@@ -0,0 +1,227 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"bytes"
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+// ErrTxHeld is returned for a transaction with a nonce ahead of its sender's,
+// which the sequencer is holding until the transactions before it arrive.
+// The transaction has been accepted, so the RPC server reports it as queued
+// rather than failed
+var ErrTxHeld = errors.New("transaction queued until its sender's earlier nonces arrive")
+
+// TxPoolContent lists the transactions a batcher hasn't sequenced yet.
+// Pending transactions are waiting to be sequenced and queued transactions
+// are waiting for an earlier nonce from the same sender
+type TxPoolContent struct {
+	Pending map[ethcommon.Address][]*types.Transaction
+	Queued  map[ethcommon.Address][]*types.Transaction
+}
+
+// TxPoolReader is implemented by batchers that can report their unsequenced
+// transactions
+type TxPoolReader interface {
+	TxPoolContent() *TxPoolContent
+}
+
+type heldAccount struct {
+	txes      TxHeap
+	byNonce   map[uint64]*txQueueItem
+	expiresAt map[uint64]time.Time
+}
+
+func (a *heldAccount) remove(nonce uint64) {
+	delete(a.byNonce, nonce)
+	delete(a.expiresAt, nonce)
+	a.txes = a.txes[:0]
+	for _, item := range a.byNonce {
+		a.txes = append(a.txes, item.tx)
+	}
+	heap.Init(&a.txes)
+}
+
+// holdingPool keeps transactions with a nonce ahead of their sender's
+// current nonce until the missing transactions arrive, so that a burst of
+// transactions received out of order is still sequenced
+type holdingPool struct {
+	mutex        sync.Mutex
+	timeout      time.Duration
+	maxTxs       int
+	maxPerSender int
+	accounts     map[ethcommon.Address]*heldAccount
+	count        int
+}
+
+func newHoldingPool(config configuration.HoldingPool) *holdingPool {
+	return &holdingPool{
+		timeout:      config.Timeout,
+		maxTxs:       config.MaxTxs,
+		maxPerSender: config.MaxPerSender,
+		accounts:     make(map[ethcommon.Address]*heldAccount),
+	}
+}
+
+func (p *holdingPool) enabled() bool {
+	return p.timeout > 0 && p.maxTxs > 0 && p.maxPerSender > 0
+}
+
+// Must be called with the mutex held
+func (p *holdingPool) expire(now time.Time) {
+	for sender, account := range p.accounts {
+		for nonce, expiresAt := range account.expiresAt {
+			if now.Before(expiresAt) {
+				continue
+			}
+			logger.Info().
+				Str("hash", account.byNonce[nonce].tx.Hash().String()).
+				Msg("dropping held transaction as the nonce gap wasn't filled")
+			account.remove(nonce)
+			p.count--
+		}
+		if len(account.byNonce) == 0 {
+			delete(p.accounts, sender)
+		}
+	}
+}
+
+// hold returns false if the transaction can't be held, either because its
+// nonce isn't ahead of currentNonce or because the pool is full
+func (p *holdingPool) hold(item *txQueueItem, currentNonce uint64) bool {
+	if !p.enabled() {
+		return false
+	}
+	nonce := item.tx.Nonce()
+	if nonce <= currentNonce || nonce-currentNonce > uint64(p.maxPerSender) {
+		return false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	p.expire(now)
+	account, ok := p.accounts[item.sender]
+	if !ok {
+		account = &heldAccount{
+			byNonce:   make(map[uint64]*txQueueItem),
+			expiresAt: make(map[uint64]time.Time),
+		}
+		p.accounts[item.sender] = account
+	}
+	if _, ok := account.byNonce[nonce]; ok {
+		// Replace the existing transaction with the same nonce
+		account.remove(nonce)
+		p.count--
+	} else if p.count >= p.maxTxs || len(account.byNonce) >= p.maxPerSender {
+		if len(account.byNonce) == 0 {
+			delete(p.accounts, item.sender)
+		}
+		return false
+	}
+	account.byNonce[nonce] = item
+	account.expiresAt[nonce] = now.Add(p.timeout)
+	heap.Push(&account.txes, item.tx)
+	p.count++
+	return true
+}
+
+// release removes and returns the held transaction from sender with the
+// given nonce, or nil if there isn't one
+func (p *holdingPool) release(sender ethcommon.Address, nonce uint64) *txQueueItem {
+	if !p.enabled() {
+		return nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	account, ok := p.accounts[sender]
+	if !ok {
+		return nil
+	}
+	if len(account.txes) == 0 || account.txes[0].Nonce() != nonce {
+		return nil
+	}
+	item := account.byNonce[nonce]
+	if !time.Now().Before(account.expiresAt[nonce]) {
+		return nil
+	}
+	heap.Pop(&account.txes)
+	delete(account.byNonce, nonce)
+	delete(account.expiresAt, nonce)
+	p.count--
+	if len(account.byNonce) == 0 {
+		delete(p.accounts, sender)
+	}
+	return item
+}
+
+// drain removes and returns every held transaction, ordered by sender and
+// then nonce
+func (p *holdingPool) drain() []*types.Transaction {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.expire(time.Now())
+	senders := make([]ethcommon.Address, 0, len(p.accounts))
+	for sender := range p.accounts {
+		senders = append(senders, sender)
+	}
+	sort.Slice(senders, func(i, j int) bool {
+		return bytes.Compare(senders[i].Bytes(), senders[j].Bytes()) < 0
+	})
+	txes := make([]*types.Transaction, 0, p.count)
+	for _, sender := range senders {
+		account := p.accounts[sender]
+		start := len(txes)
+		txes = append(txes, account.txes...)
+		held := txes[start:]
+		sort.Slice(held, func(i, j int) bool { return held[i].Nonce() < held[j].Nonce() })
+	}
+	p.accounts = make(map[ethcommon.Address]*heldAccount)
+	p.count = 0
+	return txes
+}
+
+func (p *holdingPool) len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.expire(time.Now())
+	return p.count
+}
+
+// contents returns the held transactions of each sender ordered by nonce
+func (p *holdingPool) contents() map[ethcommon.Address][]*types.Transaction {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.expire(time.Now())
+	contents := make(map[ethcommon.Address][]*types.Transaction, len(p.accounts))
+	for sender, account := range p.accounts {
+		txes := make([]*types.Transaction, 0, len(account.txes))
+		txes = append(txes, account.txes...)
+		sort.Slice(txes, func(i, j int) bool { return txes[i].Nonce() < txes[j].Nonce() })
+		contents[sender] = txes
+	}
+	return contents
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+func TestHoldingPool(t *testing.T) {
+	pool := newHoldingPool(configuration.HoldingPool{
+		Timeout:      time.Minute,
+		MaxTxs:       3,
+		MaxPerSender: 2,
+	})
+	a := ethcommon.Address{1}
+	b := ethcommon.Address{2}
+	now := time.Now()
+
+	if pool.hold(newOrderingTestItem(a, 5, 1, now), 5) {
+		t.Error("held transaction with current nonce")
+	}
+	if pool.hold(newOrderingTestItem(a, 8, 1, now), 5) {
+		t.Error("held transaction past max nonce gap")
+	}
+	a7 := newOrderingTestItem(a, 7, 1, now)
+	a6 := newOrderingTestItem(a, 6, 1, now)
+	if !pool.hold(a7, 5) || !pool.hold(a6, 5) {
+		t.Fatal("failed to hold transactions")
+	}
+	if pool.hold(newOrderingTestItem(a, 8, 1, now), 6) {
+		t.Error("held transaction past per sender limit")
+	}
+	b1 := newOrderingTestItem(b, 1, 1, now)
+	if !pool.hold(b1, 0) {
+		t.Fatal("failed to hold transaction")
+	}
+	if pool.hold(newOrderingTestItem(b, 2, 1, now), 0) {
+		t.Error("held transaction past pool limit")
+	}
+	if pool.len() != 3 {
+		t.Error("wrong pool size", pool.len())
+	}
+
+	// Replacing a held transaction is allowed even when the pool is full
+	a6 = newOrderingTestItem(a, 6, 2, now)
+	if !pool.hold(a6, 5) {
+		t.Error("failed to replace held transaction")
+	}
+
+	content := pool.contents()
+	if len(content[a]) != 2 || content[a][0] != a6.tx || content[a][1] != a7.tx {
+		t.Error("wrong held transactions for sender")
+	}
+
+	if pool.release(a, 7) != nil {
+		t.Error("released transaction before gap was filled")
+	}
+	if pool.release(a, 6) != a6 || pool.release(a, 7) != a7 {
+		t.Error("failed to release transactions in order")
+	}
+	if pool.release(b, 1) != b1 {
+		t.Error("failed to release transaction")
+	}
+	if pool.len() != 0 {
+		t.Error("pool not empty", pool.len())
+	}
+}
+
+func TestHoldingPoolExpiry(t *testing.T) {
+	pool := newHoldingPool(configuration.HoldingPool{
+		Timeout:      10 * time.Millisecond,
+		MaxTxs:       10,
+		MaxPerSender: 10,
+	})
+	a := ethcommon.Address{1}
+	if !pool.hold(newOrderingTestItem(a, 1, 1, time.Now()), 0) {
+		t.Fatal("failed to hold transaction")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if pool.release(a, 1) != nil {
+		t.Error("released expired transaction")
+	}
+	if pool.len() != 0 {
+		t.Error("expired transaction not dropped")
+	}
+}
+
+func TestHoldingPoolDrain(t *testing.T) {
+	pool := newHoldingPool(configuration.HoldingPool{
+		Timeout:      time.Minute,
+		MaxTxs:       10,
+		MaxPerSender: 10,
+	})
+	a := ethcommon.Address{1}
+	b := ethcommon.Address{2}
+	now := time.Now()
+	b3 := newOrderingTestItem(b, 3, 1, now)
+	a5 := newOrderingTestItem(a, 5, 1, now)
+	a4 := newOrderingTestItem(a, 4, 1, now)
+	if !pool.hold(b3, 1) || !pool.hold(a5, 2) || !pool.hold(a4, 2) {
+		t.Fatal("failed to hold transactions")
+	}
+
+	txes := pool.drain()
+	if len(txes) != 3 || txes[0] != a4.tx || txes[1] != a5.tx || txes[2] != b3.tx {
+		t.Error("wrong drained transactions")
+	}
+	if pool.len() != 0 {
+		t.Error("pool not empty after drain", pool.len())
+	}
+}
+
+func TestHoldingPoolDisabled(t *testing.T) {
+	pool := newHoldingPool(configuration.HoldingPool{})
+	if pool.hold(newOrderingTestItem(ethcommon.Address{1}, 1, 1, time.Now()), 0) {
+		t.Error("disabled pool held transaction")
+	}
+}
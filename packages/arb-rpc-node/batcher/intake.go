@@ -0,0 +1,181 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+var (
+	intakePendingGauge  = metrics.NewRegisteredGauge("arbitrum/sequencer/intake/pending", nil)
+	intakeBlockedMeter  = metrics.NewRegisteredMeter("arbitrum/sequencer/intake/blocked", nil)
+	intakeRejectedMeter = metrics.NewRegisteredMeter("arbitrum/sequencer/intake/rejected", nil)
+	intakeCheckTimer    = metrics.NewRegisteredTimer("arbitrum/sequencer/intake/check", nil)
+	intakeStallTimer    = metrics.NewRegisteredTimer("arbitrum/sequencer/intake/queue-stall", nil)
+)
+
+const defaultIntakeQueueSize = 1024
+
+// txCheck recovers a transaction's sender and performs the checks that
+// don't depend on chain state
+type txCheck func(ctx context.Context, tx *types.Transaction) (ethcommon.Address, error)
+
+type intakeJob struct {
+	item *txQueueItem
+	err  error
+	done chan struct{}
+}
+
+// txIntake checks incoming transactions on a pool of workers, then hands
+// them to the sequencer queue in the order they were submitted. When the
+// queue is full the pipeline fills up and submissions block
+type txIntake struct {
+	ctx   context.Context
+	check txCheck
+	queue *sequencerQueue
+
+	submitMutex sync.Mutex
+	work        chan *intakeJob
+	ordered     chan *intakeJob
+}
+
+func newTxIntake(ctx context.Context, config configuration.SequencerIntake, check txCheck, queue *sequencerQueue) *txIntake {
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultIntakeQueueSize
+	}
+	in := &txIntake{
+		ctx:     ctx,
+		check:   check,
+		queue:   queue,
+		work:    make(chan *intakeJob, queueSize),
+		ordered: make(chan *intakeJob, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go in.worker()
+	}
+	go in.deliver()
+	return in
+}
+
+// submit queues tx to be checked, blocking while the pipeline is full. The
+// returned channel receives the result of sequencing tx
+func (in *txIntake) submit(ctx context.Context, tx *types.Transaction) (chan error, error) {
+	resultChan := make(chan error, 1)
+	job := &intakeJob{
+		item: &txQueueItem{
+			tx:         tx,
+			ctx:        ctx,
+			resultChan: resultChan,
+		},
+		done: make(chan struct{}),
+	}
+
+	// Jobs must enter both channels in the same order
+	in.submitMutex.Lock()
+	defer in.submitMutex.Unlock()
+	select {
+	case in.ordered <- job:
+	default:
+		intakeBlockedMeter.Mark(1)
+		select {
+		case in.ordered <- job:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-in.ctx.Done():
+			return nil, errors.New("sequencer shutting down")
+		}
+	}
+	intakePendingGauge.Inc(1)
+	select {
+	case in.work <- job:
+	case <-in.ctx.Done():
+		job.err = errors.New("sequencer shutting down")
+		close(job.done)
+	}
+	return resultChan, nil
+}
+
+// wait returns the result of sequencing a submitted transaction, giving up
+// if ctx is done first. A transaction whose ctx is done is dropped when it
+// reaches the front of the queue
+func (in *txIntake) wait(ctx context.Context, resultChan chan error) error {
+	select {
+	case err := <-resultChan:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-in.ctx.Done():
+		return errors.New("sequencer shutting down")
+	}
+}
+
+func (in *txIntake) worker() {
+	for {
+		select {
+		case <-in.ctx.Done():
+			return
+		case job := <-in.work:
+			start := time.Now()
+			job.item.sender, job.err = in.check(job.item.ctx, job.item.tx)
+			intakeCheckTimer.UpdateSince(start)
+			close(job.done)
+		}
+	}
+}
+
+// deliver is the pipeline's ordered stage, waiting for each job's checks in
+// submission order before queueing it to be sequenced
+func (in *txIntake) deliver() {
+	for {
+		var job *intakeJob
+		select {
+		case <-in.ctx.Done():
+			return
+		case job = <-in.ordered:
+		}
+		select {
+		case <-in.ctx.Done():
+			return
+		case <-job.done:
+		}
+		intakePendingGauge.Dec(1)
+		if job.err != nil {
+			intakeRejectedMeter.Mark(1)
+			job.item.resultChan <- job.err
+			continue
+		}
+		start := time.Now()
+		job.item.queuedAt = start
+		in.queue.push(job.item)
+		intakeStallTimer.UpdateSince(start)
+	}
+}
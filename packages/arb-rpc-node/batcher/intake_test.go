@@ -0,0 +1,231 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+var intakeTestSigner = types.NewEIP155Signer(big.NewInt(42161))
+
+// newIntakeTestTxs returns count signed transactions from a few senders.
+// They're decoded from their encoding so that no sender is cached yet
+func newIntakeTestTxs(t testing.TB, count int) []*types.Transaction {
+	var encoded [][]byte
+	for i := 0; i < 16 && i < count; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := types.SignNewTx(key, intakeTestSigner, &types.LegacyTx{
+			Nonce:    uint64(i),
+			GasPrice: big.NewInt(1),
+			Gas:      21000,
+			To:       &ethcommon.Address{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded = append(encoded, data)
+	}
+	txs := make([]*types.Transaction, 0, count)
+	for i := 0; i < count; i++ {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(encoded[i%len(encoded)]); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+func recoverSender(_ context.Context, tx *types.Transaction) (ethcommon.Address, error) {
+	return types.Sender(intakeTestSigner, tx)
+}
+
+// drainQueue stands in for the sequencing loop, popping queued items and
+// reporting success until ctx is done
+func drainQueue(ctx context.Context, q *sequencerQueue, popped chan<- *txQueueItem) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.ready:
+		}
+		for {
+			item := q.pop()
+			if item == nil {
+				break
+			}
+			if popped != nil {
+				popped <- item
+			}
+			if item.resultChan != nil {
+				item.resultChan <- nil
+			}
+		}
+	}
+}
+
+func TestTxIntakeOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q, err := newSequencerQueue(FIFOOrdering, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := errors.New("rejected")
+	check := func(ctx context.Context, tx *types.Transaction) (ethcommon.Address, error) {
+		// Finish checks out of order
+		time.Sleep(time.Duration(rand.Intn(2000)) * time.Microsecond)
+		if tx.Nonce()%5 == 4 {
+			return ethcommon.Address{}, rejected
+		}
+		return recoverSender(ctx, tx)
+	}
+	intake := newTxIntake(ctx, configuration.SequencerIntake{Workers: 8, QueueSize: 4}, check, q)
+	popped := make(chan *txQueueItem, 100)
+	go drainQueue(ctx, q, popped)
+
+	txs := newIntakeTestTxs(t, 100)
+	var resultChans []chan error
+	for _, tx := range txs {
+		resultChan, err := intake.submit(ctx, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resultChans = append(resultChans, resultChan)
+	}
+	for i, resultChan := range resultChans {
+		err := intake.wait(ctx, resultChan)
+		if txs[i].Nonce()%5 == 4 {
+			if err != rejected {
+				t.Error("expected transaction to be rejected", i, err)
+			}
+		} else if err != nil {
+			t.Error("unexpected error", i, err)
+		}
+	}
+
+	close(popped)
+	var next int
+	for item := range popped {
+		for txs[next].Nonce()%5 == 4 {
+			next++
+		}
+		if item.tx != txs[next] {
+			t.Fatal("transaction queued out of order", next)
+		}
+		expectedSender, err := types.Sender(intakeTestSigner, item.tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.sender != expectedSender {
+			t.Error("wrong sender recovered")
+		}
+		next++
+	}
+}
+
+func TestTxIntakeCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q, err := newSequencerQueue(FIFOOrdering, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := make(chan struct{})
+	check := func(ctx context.Context, tx *types.Transaction) (ethcommon.Address, error) {
+		<-block
+		return ethcommon.Address{}, nil
+	}
+	intake := newTxIntake(ctx, configuration.SequencerIntake{Workers: 1, QueueSize: 1}, check, q)
+	txs := newIntakeTestTxs(t, 3)
+	resultChan, err := intake.submit(ctx, txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := intake.submit(ctx, txs[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Waiting gives up once the caller is done, even though the transaction
+	// hasn't been checked
+	waitCtx, waitCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer waitCancel()
+	if err := intake.wait(waitCtx, resultChan); err != context.DeadlineExceeded {
+		t.Error("expected wait to time out", err)
+	}
+
+	// The pipeline is full, so this blocks until the submission is canceled
+	submitCtx, submitCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer submitCancel()
+	if _, err := intake.submit(submitCtx, txs[2]); err != context.DeadlineExceeded {
+		t.Error("expected submission to time out", err)
+	}
+	close(block)
+}
+
+// benchmarkIntakeTxs is large enough that sender recovery dominates
+const benchmarkIntakeTxs = 2048
+
+// BenchmarkTxIntakePipeline measures the intake pipeline with a worker per CPU
+func BenchmarkTxIntakePipeline(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q, err := newSequencerQueue(FIFOOrdering, 0, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	go drainQueue(ctx, q, nil)
+	intake := newTxIntake(ctx, configuration.SequencerIntake{Workers: runtime.NumCPU()}, recoverSender, q)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		txs := newIntakeTestTxs(b, benchmarkIntakeTxs)
+		b.StartTimer()
+		resultChans := make([]chan error, 0, len(txs))
+		for _, tx := range txs {
+			resultChan, err := intake.submit(ctx, tx)
+			if err != nil {
+				b.Fatal(err)
+			}
+			resultChans = append(resultChans, resultChan)
+		}
+		for _, resultChan := range resultChans {
+			if err := intake.wait(ctx, resultChan); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,458 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+// journalRecord is a run of batch items delivered together, following the
+// message count and accumulator they were delivered after
+type journalRecord struct {
+	prevMsgCount *big.Int
+	prevAcc      common.Hash
+	items        []inbox.SequencerBatchItem
+}
+
+func (r journalRecord) lastItem() inbox.SequencerBatchItem {
+	return r.items[len(r.items)-1]
+}
+
+func (r journalRecord) encode() []byte {
+	var payload []byte
+	payload = append(payload, math.U256Bytes(new(big.Int).Set(r.prevMsgCount))...)
+	payload = append(payload, r.prevAcc.Bytes()...)
+	for _, item := range r.items {
+		itemData := item.ToBytesWithSeqNum()
+		payload = append(payload, uint32Bytes(uint32(len(itemData)))...)
+		payload = append(payload, itemData...)
+	}
+	frame := make([]byte, 0, 8+len(payload))
+	frame = append(frame, uint32Bytes(uint32(len(payload)))...)
+	frame = append(frame, uint32Bytes(crc32.ChecksumIEEE(payload))...)
+	return append(frame, payload...)
+}
+
+func decodeJournalRecord(payload []byte) (journalRecord, error) {
+	if len(payload) < 64 {
+		return journalRecord{}, errors.New("journal record too short")
+	}
+	record := journalRecord{prevMsgCount: new(big.Int).SetBytes(payload[:32])}
+	copy(record.prevAcc[:], payload[32:64])
+	payload = payload[64:]
+	for len(payload) > 0 {
+		if len(payload) < 4 {
+			return journalRecord{}, errors.New("truncated journal item length")
+		}
+		itemLen := binary.BigEndian.Uint32(payload[:4])
+		payload = payload[4:]
+		if uint64(len(payload)) < uint64(itemLen) {
+			return journalRecord{}, errors.New("truncated journal item")
+		}
+		item, err := inbox.NewSequencerBatchItemFromData(payload[:itemLen])
+		if err != nil {
+			return journalRecord{}, err
+		}
+		record.items = append(record.items, item)
+		payload = payload[itemLen:]
+	}
+	if len(record.items) == 0 {
+		return journalRecord{}, errors.New("empty journal record")
+	}
+	return record, nil
+}
+
+func uint32Bytes(val uint32) []byte {
+	var data [4]byte
+	binary.BigEndian.PutUint32(data[:], val)
+	return data[:]
+}
+
+// sequencerJournal durably records batch items the sequencer has sequenced
+// but not yet seen posted on L1, so they can be replayed after a crash
+type sequencerJournal struct {
+	mutex   sync.Mutex
+	path    string
+	file    *os.File
+	records []journalRecord
+}
+
+// openSequencerJournal loads the journal at path, creating it if it doesn't
+// exist. A partially written record at the end of the file, left by a crash
+// while appending, is discarded
+func openSequencerJournal(path string) (*sequencerJournal, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "error reading sequencer journal")
+	}
+	var records []journalRecord
+	validLen := 0
+	for len(data)-validLen >= 8 {
+		payloadLen := int(binary.BigEndian.Uint32(data[validLen : validLen+4]))
+		checksum := binary.BigEndian.Uint32(data[validLen+4 : validLen+8])
+		if len(data)-validLen-8 < payloadLen {
+			break
+		}
+		payload := data[validLen+8 : validLen+8+payloadLen]
+		if crc32.ChecksumIEEE(payload) != checksum {
+			break
+		}
+		record, err := decodeJournalRecord(payload)
+		if err != nil {
+			break
+		}
+		records = append(records, record)
+		validLen += 8 + payloadLen
+	}
+	if validLen < len(data) {
+		logger.Warn().
+			Str("path", path).
+			Int("discardedBytes", len(data)-validLen).
+			Msg("discarding incomplete record at end of sequencer journal")
+		if err := os.Truncate(path, int64(validLen)); err != nil {
+			return nil, errors.Wrap(err, "error truncating sequencer journal")
+		}
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening sequencer journal")
+	}
+	return &sequencerJournal{path: path, file: file, records: records}, nil
+}
+
+// append durably records items, delivered after prevMsgCount messages with
+// accumulator prevAcc, returning once they're synced to disk
+func (j *sequencerJournal) append(prevMsgCount *big.Int, prevAcc common.Hash, items []inbox.SequencerBatchItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	record := journalRecord{
+		prevMsgCount: new(big.Int).Set(prevMsgCount),
+		prevAcc:      prevAcc,
+		items:        items,
+	}
+	if _, err := j.file.Write(record.encode()); err != nil {
+		return errors.Wrap(err, "error writing sequencer journal")
+	}
+	if err := j.file.Sync(); err != nil {
+		return errors.Wrap(err, "error syncing sequencer journal")
+	}
+	j.records = append(j.records, record)
+	return nil
+}
+
+// trim drops items that have been posted, given the count of messages
+// included on L1
+func (j *sequencerJournal) trim(postedCount *big.Int) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	var records []journalRecord
+	changed := false
+	for _, record := range j.records {
+		if record.lastItem().LastSeqNum.Cmp(postedCount) < 0 {
+			changed = true
+			continue
+		}
+		for record.items[0].LastSeqNum.Cmp(postedCount) < 0 {
+			record.prevMsgCount = new(big.Int).Add(record.items[0].LastSeqNum, big.NewInt(1))
+			record.prevAcc = record.items[0].Accumulator
+			record.items = record.items[1:]
+			changed = true
+		}
+		records = append(records, record)
+	}
+	if !changed {
+		return nil
+	}
+	return j.rewrite(records)
+}
+
+// replaceFrom replaces the items from msgCount onwards, for when the
+// sequencer has reorganized its own unposted messages
+func (j *sequencerJournal) replaceFrom(msgCount *big.Int, prevAcc common.Hash, items []inbox.SequencerBatchItem) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	var records []journalRecord
+	for _, record := range j.records {
+		if record.prevMsgCount.Cmp(msgCount) >= 0 {
+			break
+		}
+		var kept []inbox.SequencerBatchItem
+		for _, item := range record.items {
+			if item.LastSeqNum.Cmp(msgCount) >= 0 {
+				break
+			}
+			kept = append(kept, item)
+		}
+		if len(kept) == 0 {
+			break
+		}
+		record.items = kept
+		records = append(records, record)
+	}
+	if len(items) > 0 {
+		records = append(records, journalRecord{
+			prevMsgCount: new(big.Int).Set(msgCount),
+			prevAcc:      prevAcc,
+			items:        items,
+		})
+	}
+	return j.rewrite(records)
+}
+
+// unposted returns the journal's records in the order they were sequenced
+func (j *sequencerJournal) unposted() []journalRecord {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return append([]journalRecord(nil), j.records...)
+}
+
+// rewrite atomically replaces the journal file's contents with records.
+// Must be called with the mutex held
+func (j *sequencerJournal) rewrite(records []journalRecord) error {
+	tmpPath := j.path + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "error creating sequencer journal")
+	}
+	for _, record := range records {
+		if _, err := tmpFile.Write(record.encode()); err != nil {
+			_ = tmpFile.Close()
+			return errors.Wrap(err, "error writing sequencer journal")
+		}
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return errors.Wrap(err, "error syncing sequencer journal")
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := j.file.Close(); err != nil {
+		logger.Warn().Err(err).Msg("error closing sequencer journal")
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return errors.Wrap(err, "error replacing sequencer journal")
+	}
+	j.file, err = os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "error opening sequencer journal")
+	}
+	j.records = records
+	return nil
+}
+
+func (j *sequencerJournal) close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.file.Close()
+}
+
+// batchItemPostingCost estimates the L1 gas used to post item, matching the
+// estimates added to pendingBatchGasEstimateAtomic when it's sequenced
+func batchItemPostingCost(item inbox.SequencerBatchItem) (int, error) {
+	if len(item.SequencerMessage) == 0 {
+		return gasCostDelayedMessages, nil
+	}
+	seqMsg, err := inbox.NewInboxMessageFromData(item.SequencerMessage)
+	if err != nil {
+		return 0, err
+	}
+	return gasCostPerMessage + gasCostPerMessageByte*len(seqMsg.Data), nil
+}
+
+// journalItems records items in the journal, if enabled. It must be called
+// before the items are broadcast on the feed
+func (b *SequencerBatcher) journalItems(prevMsgCount *big.Int, prevAcc common.Hash, items []inbox.SequencerBatchItem) error {
+	if b.journal == nil {
+		return nil
+	}
+	return b.journal.append(prevMsgCount, prevAcc, items)
+}
+
+// rejournalFrom replaces the journal's items from prevMsgCount onwards with
+// the database's, after the sequencer reorganizes its unposted messages.
+// Must be called with the MessageDeliveryMutex held
+func (b *SequencerBatcher) rejournalFrom(prevMsgCount *big.Int, prevAcc common.Hash) error {
+	if b.journal == nil {
+		return nil
+	}
+	batchItems, err := b.db.GetSequencerBatchItems(prevMsgCount)
+	if err != nil {
+		return err
+	}
+	return b.journal.replaceFrom(prevMsgCount, prevAcc, batchItems)
+}
+
+// trimJournal drops journal items once postedCount messages are on L1
+func (b *SequencerBatcher) trimJournal(postedCount *big.Int) {
+	if b.journal == nil {
+		return
+	}
+	if err := b.journal.trim(postedCount); err != nil {
+		logger.Warn().Err(err).Msg("error trimming sequencer journal")
+	}
+}
+
+// ReplayJournal delivers any journaled items missing from the database, so
+// that messages already broadcast on the feed are posted even if the node
+// crashed before posting them, and rebroadcasts the unposted items. It must
+// be called after the feed broadcaster starts and before transactions are
+// accepted. When a sequencer lockout is configured, it must only be called
+// once this node holds the lockout
+func (b *SequencerBatcher) ReplayJournal(ctx context.Context) error {
+	if b.journal == nil {
+		return nil
+	}
+	postedCount, err := b.sequencerInbox.MessageCount(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return err
+	}
+
+	b.inboxReader.MessageDeliveryMutex.Lock()
+	defer b.inboxReader.MessageDeliveryMutex.Unlock()
+
+	return b.replayJournal(ctx, postedCount)
+}
+
+// replayJournal implements ReplayJournal given the count of messages posted
+// on L1. Must be called with the MessageDeliveryMutex held
+func (b *SequencerBatcher) replayJournal(ctx context.Context, postedCount *big.Int) error {
+	if err := b.journal.trim(postedCount); err != nil {
+		return err
+	}
+
+	records := b.journal.unposted()
+	if len(records) == 0 {
+		return nil
+	}
+	var items []inbox.SequencerBatchItem
+	for i, record := range records {
+		if i > 0 {
+			prev := records[i-1].lastItem()
+			if record.prevAcc != prev.Accumulator || record.prevMsgCount.Cmp(new(big.Int).Add(prev.LastSeqNum, big.NewInt(1))) != 0 {
+				logger.Error().
+					Str("prevMsgCount", record.prevMsgCount.String()).
+					Msg("sequencer journal isn't contiguous, discarding the rest")
+				if err := b.journal.replaceFrom(record.prevMsgCount, record.prevAcc, nil); err != nil {
+					return err
+				}
+				break
+			}
+		}
+		items = append(items, record.items...)
+	}
+	firstPrevCount := records[0].prevMsgCount
+	firstPrevAcc := records[0].prevAcc
+
+	msgCount, err := b.db.GetMessageCount()
+	if err != nil {
+		return err
+	}
+	prevCount := firstPrevCount
+	prevAcc := firstPrevAcc
+	replayFrom := len(items)
+	for i, item := range items {
+		if item.LastSeqNum.Cmp(msgCount) >= 0 {
+			replayFrom = i
+			break
+		}
+		acc, err := b.db.GetInboxAcc(item.LastSeqNum)
+		if err != nil {
+			return err
+		}
+		if acc != item.Accumulator {
+			// The database's messages take precedence over the journal's
+			logger.Warn().
+				Str("seqNum", item.LastSeqNum.String()).
+				Msg("sequencer journal conflicts with database, discarding the rest")
+			items = items[:i]
+			if err := b.journal.replaceFrom(prevCount, prevAcc, nil); err != nil {
+				return err
+			}
+			break
+		}
+		prevCount = new(big.Int).Add(item.LastSeqNum, big.NewInt(1))
+		prevAcc = item.Accumulator
+	}
+
+	if replayFrom < len(items) {
+		var dbAcc common.Hash
+		if prevCount.Sign() > 0 {
+			dbAcc, err = b.db.GetInboxAcc(new(big.Int).Sub(prevCount, big.NewInt(1)))
+			if err != nil {
+				return err
+			}
+		}
+		if prevCount.Cmp(msgCount) != 0 || dbAcc != prevAcc {
+			logger.Error().
+				Str("journalCount", prevCount.String()).
+				Str("msgCount", msgCount.String()).
+				Msg("sequencer journal doesn't follow database, discarding the rest")
+			items = items[:replayFrom]
+			if err := b.journal.replaceFrom(prevCount, prevAcc, nil); err != nil {
+				return err
+			}
+		} else {
+			replayed := items[replayFrom:]
+			logger.Warn().
+				Str("prevMsgCount", prevCount.String()).
+				Int("items", len(replayed)).
+				Msg("replaying sequenced items from journal")
+			err = core.DeliverMessagesAndWait(ctx, b.db, prevCount, prevAcc, replayed, []inbox.DelayedMessage{}, nil)
+			if err != nil {
+				return errors.Wrap(err, "error replaying sequencer journal")
+			}
+			core.WaitForMachineIdle(b.db)
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	var postingCostEstimate int
+	for _, item := range items {
+		cost, err := batchItemPostingCost(item)
+		if err != nil {
+			return err
+		}
+		postingCostEstimate += cost
+	}
+	atomic.AddInt64(&b.pendingBatchGasEstimateAtomic, int64(postingCostEstimate))
+
+	if b.feedBroadcaster != nil {
+		return b.feedBroadcaster.Broadcast(firstPrevAcc, items, b.dataSigner)
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func newJournalTestItems(firstSeqNum int64, count int) []inbox.SequencerBatchItem {
+	items := make([]inbox.SequencerBatchItem, 0, count)
+	for i := 0; i < count; i++ {
+		seqNum := firstSeqNum + int64(i)
+		items = append(items, inbox.SequencerBatchItem{
+			LastSeqNum:        big.NewInt(seqNum),
+			Accumulator:       common.Hash{byte(seqNum)},
+			TotalDelayedCount: big.NewInt(1),
+			SequencerMessage:  []byte{byte(seqNum), 1, 2, 3},
+		})
+	}
+	return items
+}
+
+func journalSeqNums(journal *sequencerJournal) []int64 {
+	var seqNums []int64
+	for _, record := range journal.unposted() {
+		for _, item := range record.items {
+			seqNums = append(seqNums, item.LastSeqNum.Int64())
+		}
+	}
+	return seqNums
+}
+
+func checkJournalSeqNums(t *testing.T, journal *sequencerJournal, expected []int64) {
+	t.Helper()
+	seqNums := journalSeqNums(journal)
+	if len(seqNums) != len(expected) {
+		t.Fatal("wrong journal items", seqNums, "expected", expected)
+	}
+	for i := range seqNums {
+		if seqNums[i] != expected[i] {
+			t.Fatal("wrong journal items", seqNums, "expected", expected)
+		}
+	}
+}
+
+func TestSequencerJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	journal, err := openSequencerJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.append(big.NewInt(10), common.Hash{9}, newJournalTestItems(10, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.append(big.NewInt(13), common.Hash{12}, newJournalTestItems(13, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err = openSequencerJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJournalSeqNums(t, journal, []int64{10, 11, 12, 13, 14})
+	record := journal.unposted()[0]
+	if record.prevMsgCount.Int64() != 10 || record.prevAcc != (common.Hash{9}) {
+		t.Error("wrong record prefix")
+	}
+	if string(record.items[1].SequencerMessage) != string([]byte{11, 1, 2, 3}) {
+		t.Error("wrong item contents")
+	}
+
+	// Trimming part of a record keeps it chained to the posted items
+	if err := journal.trim(big.NewInt(12)); err != nil {
+		t.Fatal(err)
+	}
+	checkJournalSeqNums(t, journal, []int64{12, 13, 14})
+	record = journal.unposted()[0]
+	if record.prevMsgCount.Int64() != 12 || record.prevAcc != (common.Hash{11}) {
+		t.Error("wrong record prefix after trim")
+	}
+
+	if err := journal.replaceFrom(big.NewInt(14), common.Hash{13}, newJournalTestItems(14, 3)); err != nil {
+		t.Fatal(err)
+	}
+	checkJournalSeqNums(t, journal, []int64{12, 13, 14, 15, 16})
+	if err := journal.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err = openSequencerJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJournalSeqNums(t, journal, []int64{12, 13, 14, 15, 16})
+	if err := journal.trim(big.NewInt(17)); err != nil {
+		t.Fatal(err)
+	}
+	checkJournalSeqNums(t, journal, nil)
+	if err := journal.close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSequencerJournalTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	journal, err := openSequencerJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.append(big.NewInt(0), common.Hash{}, newJournalTestItems(0, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash partway through appending a record
+	partial := journalRecord{
+		prevMsgCount: big.NewInt(2),
+		prevAcc:      common.Hash{1},
+		items:        newJournalTestItems(2, 2),
+	}.encode()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(partial[:len(partial)-5]); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err = openSequencerJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJournalSeqNums(t, journal, []int64{0, 1})
+	if err := journal.append(big.NewInt(2), common.Hash{1}, newJournalTestItems(2, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err = openSequencerJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.close()
+	checkJournalSeqNums(t, journal, []int64{0, 1, 2})
+}
+
+// newReplayTestItems returns count end of block items, chained from prevAcc,
+// that the database will accept. Different forks produce different
+// accumulators for the same sequence numbers
+func newReplayTestItems(prevCount int64, prevAcc common.Hash, count int, fork byte) []inbox.SequencerBatchItem {
+	items := make([]inbox.SequencerBatchItem, 0, count)
+	for i := 0; i < count; i++ {
+		msg := message.NewInboxMessage(
+			message.EndBlockMessage{},
+			common.Address{fork},
+			big.NewInt(prevCount+int64(i)),
+			big.NewInt(0),
+			inbox.ChainTime{
+				BlockNum:  common.NewTimeBlocksInt(1),
+				Timestamp: big.NewInt(1),
+			},
+		)
+		item := inbox.NewSequencerItem(big.NewInt(0), msg, prevAcc)
+		items = append(items, item)
+		prevAcc = item.Accumulator
+	}
+	return items
+}
+
+// prepareJournalReplay returns a sequencer batcher whose database contains
+// dbItems and whose journal contains journalItems, both starting from the
+// first message
+func prepareJournalReplay(t *testing.T, dbItems []inbox.SequencerBatchItem, journalItems [][]inbox.SequencerBatchItem) (*SequencerBatcher, func()) {
+	mon, shutdown := monitor.PrepareArbCore(t)
+	if len(dbItems) > 0 {
+		err := core.DeliverMessagesAndWait(context.Background(), mon.Core, big.NewInt(0), common.Hash{}, dbItems, nil, nil)
+		test.FailIfError(t, err)
+	}
+
+	journal, err := openSequencerJournal(filepath.Join(t.TempDir(), "journal"))
+	test.FailIfError(t, err)
+	prevCount := big.NewInt(0)
+	var prevAcc common.Hash
+	for _, items := range journalItems {
+		test.FailIfError(t, journal.append(prevCount, prevAcc, items))
+		last := items[len(items)-1]
+		prevCount = new(big.Int).Add(last.LastSeqNum, big.NewInt(1))
+		prevAcc = last.Accumulator
+	}
+
+	b := &SequencerBatcher{
+		db:      mon.Core,
+		journal: journal,
+	}
+	return b, func() {
+		_ = journal.close()
+		shutdown()
+	}
+}
+
+func checkDatabaseItems(t *testing.T, db core.ArbCore, expected []inbox.SequencerBatchItem) {
+	t.Helper()
+	msgCount, err := db.GetMessageCount()
+	test.FailIfError(t, err)
+	if msgCount.Cmp(big.NewInt(int64(len(expected)))) != 0 {
+		t.Fatal("wrong database message count", msgCount, "expected", len(expected))
+	}
+	for _, item := range expected {
+		acc, err := db.GetInboxAcc(item.LastSeqNum)
+		test.FailIfError(t, err)
+		if acc != item.Accumulator {
+			t.Fatal("wrong database accumulator for message", item.LastSeqNum)
+		}
+	}
+}
+
+func TestReplayJournalCrashBeforePost(t *testing.T) {
+	items := newReplayTestItems(0, common.Hash{}, 5, 0)
+	b, shutdown := prepareJournalReplay(t, items, [][]inbox.SequencerBatchItem{items[:3], items[3:]})
+	defer shutdown()
+
+	// Everything was delivered locally but only the first two were posted
+	if err := b.replayJournal(context.Background(), big.NewInt(2)); err != nil {
+		t.Fatal(err)
+	}
+	checkDatabaseItems(t, b.db, items)
+	checkJournalSeqNums(t, b.journal, []int64{2, 3, 4})
+
+	// The unposted items still need to be posted
+	var expectedEstimate int
+	for _, item := range items[2:] {
+		cost, err := batchItemPostingCost(item)
+		test.FailIfError(t, err)
+		expectedEstimate += cost
+	}
+	if estimate := atomic.LoadInt64(&b.pendingBatchGasEstimateAtomic); estimate != int64(expectedEstimate) {
+		t.Error("wrong pending batch gas estimate", estimate, "expected", expectedEstimate)
+	}
+}
+
+func TestReplayJournalAheadOfDatabase(t *testing.T) {
+	items := newReplayTestItems(0, common.Hash{}, 5, 0)
+	b, shutdown := prepareJournalReplay(t, items[:3], [][]inbox.SequencerBatchItem{items[:2], items[2:]})
+	defer shutdown()
+
+	// The last two items were broadcast but the database lost them
+	if err := b.replayJournal(context.Background(), big.NewInt(0)); err != nil {
+		t.Fatal(err)
+	}
+	checkDatabaseItems(t, b.db, items)
+	checkJournalSeqNums(t, b.journal, []int64{0, 1, 2, 3, 4})
+}
+
+func TestReplayJournalDatabaseConflict(t *testing.T) {
+	items := newReplayTestItems(0, common.Hash{}, 5, 0)
+	forked := newReplayTestItems(3, items[2].Accumulator, 1, 1)
+	dbItems := append(append([]inbox.SequencerBatchItem{}, items[:3]...), forked...)
+	b, shutdown := prepareJournalReplay(t, dbItems, [][]inbox.SequencerBatchItem{items})
+	defer shutdown()
+
+	// The database's version of the fourth message wins
+	if err := b.replayJournal(context.Background(), big.NewInt(0)); err != nil {
+		t.Fatal(err)
+	}
+	checkDatabaseItems(t, b.db, dbItems)
+	checkJournalSeqNums(t, b.journal, []int64{0, 1, 2})
+}
@@ -0,0 +1,406 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/pkg/errors"
+)
+
+const (
+	FIFOOrdering       = "fifo"
+	PriorityOrdering   = "priority"
+	RoundRobinOrdering = "round-robin"
+)
+
+// Default maximum number of transactions waiting to be sequenced before
+// SendTransaction blocks. Priority ordering needs room for every
+// transaction arriving within its window, since a full queue is released
+// without waiting the window out
+const (
+	sequencerQueueSize = 10
+	priorityQueueSize  = 1024
+)
+
+// orderingPolicy decides which queued transaction is sequenced next. It is
+// only accessed with the sequencerQueue mutex held
+type orderingPolicy interface {
+	push(item *txQueueItem)
+	// hold returns how long to wait before the next transaction may be
+	// popped, giving later arrivals a chance to be ordered ahead of it
+	hold(now time.Time) time.Duration
+	// pop returns nil if no transactions are queued
+	pop() *txQueueItem
+	len() int
+	// items returns the queued transactions without removing them
+	items() []*txQueueItem
+}
+
+func newOrderingPolicy(name string, priorityWindow time.Duration) (orderingPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", FIFOOrdering:
+		return &fifoPolicy{}, nil
+	case PriorityOrdering:
+		if priorityWindow <= 0 {
+			return nil, errors.New("sequencer priority ordering window must be positive")
+		}
+		return newPriorityPolicy(priorityWindow), nil
+	case RoundRobinOrdering:
+		return newRoundRobinPolicy(), nil
+	default:
+		return nil, errors.Errorf("unknown sequencer ordering policy %v", name)
+	}
+}
+
+// fifoPolicy sequences transactions in arrival order
+type fifoPolicy struct {
+	queue []*txQueueItem
+}
+
+func (p *fifoPolicy) push(item *txQueueItem) {
+	p.queue = append(p.queue, item)
+}
+
+func (p *fifoPolicy) hold(time.Time) time.Duration {
+	return 0
+}
+
+func (p *fifoPolicy) pop() *txQueueItem {
+	if len(p.queue) == 0 {
+		return nil
+	}
+	item := p.queue[0]
+	p.queue[0] = nil
+	p.queue = p.queue[1:]
+	return item
+}
+
+func (p *fifoPolicy) len() int {
+	return len(p.queue)
+}
+
+func (p *fifoPolicy) items() []*txQueueItem {
+	return append([]*txQueueItem{}, p.queue...)
+}
+
+// priorityPolicy sequences the highest gas price bid out of the transactions
+// that arrived within window of the oldest queued transaction, so no
+// transaction can be overtaken by one that arrived more than window later.
+// Each sender's transactions are kept in nonce order and only the lowest
+// nonce of each sender competes, like TxHeap. Transactions are held until
+// window has passed since the oldest arrived, or the sequencerQueue is full
+type priorityPolicy struct {
+	window time.Duration
+	queues map[ethcommon.Address][]*txQueueItem
+	count  int
+}
+
+func newPriorityPolicy(window time.Duration) *priorityPolicy {
+	return &priorityPolicy{
+		window: window,
+		queues: make(map[ethcommon.Address][]*txQueueItem),
+	}
+}
+
+func (p *priorityPolicy) push(item *txQueueItem) {
+	queue := p.queues[item.sender]
+	i := len(queue)
+	for i > 0 && queue[i-1].tx.Nonce() > item.tx.Nonce() {
+		i--
+	}
+	queue = append(queue, nil)
+	copy(queue[i+1:], queue[i:])
+	queue[i] = item
+	p.queues[item.sender] = queue
+	p.count++
+}
+
+// arrival is when a sender's earliest queued transaction arrived
+func arrival(queue []*txQueueItem) time.Time {
+	first := queue[0].queuedAt
+	for _, item := range queue[1:] {
+		if item.queuedAt.Before(first) {
+			first = item.queuedAt
+		}
+	}
+	return first
+}
+
+func (p *priorityPolicy) oldest() time.Time {
+	var oldest time.Time
+	for _, queue := range p.queues {
+		if first := arrival(queue); oldest.IsZero() || first.Before(oldest) {
+			oldest = first
+		}
+	}
+	return oldest
+}
+
+func (p *priorityPolicy) hold(now time.Time) time.Duration {
+	if p.count == 0 {
+		return 0
+	}
+	wait := p.oldest().Add(p.window).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+func (p *priorityPolicy) pop() *txQueueItem {
+	if p.count == 0 {
+		return nil
+	}
+	cutoff := p.oldest().Add(p.window)
+	var best ethcommon.Address
+	var bestQueue []*txQueueItem
+	var bestArrival time.Time
+	for sender, queue := range p.queues {
+		first := arrival(queue)
+		if first.After(cutoff) {
+			continue
+		}
+		if bestQueue != nil {
+			cmp := queue[0].tx.GasPrice().Cmp(bestQueue[0].tx.GasPrice())
+			if cmp < 0 {
+				continue
+			}
+			// Break ties by arrival, then sender so the order is deterministic
+			if cmp == 0 && (first.After(bestArrival) || (first.Equal(bestArrival) && bytes.Compare(sender.Bytes(), best.Bytes()) > 0)) {
+				continue
+			}
+		}
+		best = sender
+		bestQueue = queue
+		bestArrival = first
+	}
+	item := bestQueue[0]
+	if len(bestQueue) == 1 {
+		delete(p.queues, best)
+	} else {
+		p.queues[best] = bestQueue[1:]
+	}
+	p.count--
+	return item
+}
+
+func (p *priorityPolicy) len() int {
+	return p.count
+}
+
+func (p *priorityPolicy) items() []*txQueueItem {
+	items := make([]*txQueueItem, 0, p.count)
+	for _, queue := range p.queues {
+		items = append(items, queue...)
+	}
+	return items
+}
+
+// roundRobinPolicy takes one transaction from each sender in turn, so a
+// single sender submitting many transactions can't starve the others
+type roundRobinPolicy struct {
+	queues  map[ethcommon.Address][]*txQueueItem
+	senders []ethcommon.Address
+	next    int
+	count   int
+}
+
+func newRoundRobinPolicy() *roundRobinPolicy {
+	return &roundRobinPolicy{queues: make(map[ethcommon.Address][]*txQueueItem)}
+}
+
+func (p *roundRobinPolicy) push(item *txQueueItem) {
+	queue, ok := p.queues[item.sender]
+	if !ok {
+		p.senders = append(p.senders, item.sender)
+	}
+	p.queues[item.sender] = append(queue, item)
+	p.count++
+}
+
+func (p *roundRobinPolicy) hold(time.Time) time.Duration {
+	return 0
+}
+
+func (p *roundRobinPolicy) pop() *txQueueItem {
+	if len(p.senders) == 0 {
+		return nil
+	}
+	if p.next >= len(p.senders) {
+		p.next = 0
+	}
+	sender := p.senders[p.next]
+	queue := p.queues[sender]
+	item := queue[0]
+	if len(queue) == 1 {
+		delete(p.queues, sender)
+		p.senders = append(p.senders[:p.next], p.senders[p.next+1:]...)
+	} else {
+		p.queues[sender] = queue[1:]
+		p.next++
+	}
+	p.count--
+	return item
+}
+
+func (p *roundRobinPolicy) len() int {
+	return p.count
+}
+
+func (p *roundRobinPolicy) items() []*txQueueItem {
+	items := make([]*txQueueItem, 0, p.count)
+	for _, sender := range p.senders {
+		items = append(items, p.queues[sender]...)
+	}
+	return items
+}
+
+// sequencerQueue holds transactions between SendTransaction and the
+// sequencing loop, handing them out in the order chosen by the policy
+type sequencerQueue struct {
+	mutex  sync.Mutex
+	policy orderingPolicy
+	slots  chan struct{}
+	// ready is signaled when a transaction is pushed or a held one can be
+	// popped
+	ready     chan struct{}
+	holdTimer *time.Timer
+	clock     func() time.Time
+
+	waitTimer metrics.Timer
+}
+
+// newSequencerQueue returns a queue holding up to size transactions, or the
+// policy's default if size is 0
+func newSequencerQueue(name string, priorityWindow time.Duration, size int) (*sequencerQueue, error) {
+	policy, err := newOrderingPolicy(name, priorityWindow)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = FIFOOrdering
+	}
+	if size < 0 {
+		return nil, errors.New("sequencer queue size must not be negative")
+	}
+	if size == 0 {
+		size = sequencerQueueSize
+		if _, ok := policy.(*priorityPolicy); ok {
+			size = priorityQueueSize
+		}
+	}
+	return &sequencerQueue{
+		policy:    policy,
+		slots:     make(chan struct{}, size),
+		ready:     make(chan struct{}, 1),
+		clock:     time.Now,
+		waitTimer: metrics.GetOrRegisterTimer("arbitrum/sequencer/ordering/"+strings.ToLower(name)+"/wait", nil),
+	}, nil
+}
+
+// push blocks until there's room in the queue
+func (q *sequencerQueue) push(item *txQueueItem) {
+	q.slots <- struct{}{}
+	q.mutex.Lock()
+	q.policy.push(item)
+	q.mutex.Unlock()
+	q.signalReady()
+}
+
+// tryPush returns false instead of blocking if the queue is full
+func (q *sequencerQueue) tryPush(item *txQueueItem) bool {
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		return false
+	}
+	q.mutex.Lock()
+	q.policy.push(item)
+	q.mutex.Unlock()
+	q.signalReady()
+	return true
+}
+
+func (q *sequencerQueue) signalReady() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop returns nil if nothing is queued or the policy is holding the queued
+// transactions, in which case ready is signaled once the hold ends. Nothing
+// is held once the queue is full since no other transaction can arrive
+func (q *sequencerQueue) pop() *txQueueItem {
+	q.mutex.Lock()
+	if len(q.slots) < cap(q.slots) {
+		if wait := q.policy.hold(q.clock()); wait > 0 {
+			q.scheduleReady(wait)
+			q.mutex.Unlock()
+			return nil
+		}
+	}
+	item := q.policy.pop()
+	q.mutex.Unlock()
+	if item == nil {
+		return nil
+	}
+	<-q.slots
+	return item
+}
+
+// scheduleReady signals ready after wait, must be called with the mutex held
+func (q *sequencerQueue) scheduleReady(wait time.Duration) {
+	if q.holdTimer != nil {
+		return
+	}
+	q.holdTimer = time.AfterFunc(wait, func() {
+		q.mutex.Lock()
+		q.holdTimer = nil
+		q.mutex.Unlock()
+		q.signalReady()
+	})
+}
+
+// observeWait records how long a transaction waited before being sequenced
+func (q *sequencerQueue) observeWait(item *txQueueItem) {
+	q.waitTimer.UpdateSince(item.queuedAt)
+}
+
+func (q *sequencerQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.policy.len()
+}
+
+// contents returns the queued transactions grouped by sender
+func (q *sequencerQueue) contents() map[ethcommon.Address][]*types.Transaction {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	contents := make(map[ethcommon.Address][]*types.Transaction)
+	for _, item := range q.policy.items() {
+		contents[item.sender] = append(contents[item.sender], item.tx)
+	}
+	return contents
+}
@@ -0,0 +1,250 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func newOrderingTestItem(sender ethcommon.Address, nonce uint64, gasPrice int64, queuedAt time.Time) *txQueueItem {
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: big.NewInt(gasPrice),
+	})
+	return &txQueueItem{tx: tx, sender: sender, queuedAt: queuedAt}
+}
+
+func popAll(t *testing.T, q *sequencerQueue) []*txQueueItem {
+	var items []*txQueueItem
+	for {
+		item := q.pop()
+		if item == nil {
+			break
+		}
+		items = append(items, item)
+	}
+	if q.len() != 0 {
+		t.Error("queue not empty after popping everything")
+	}
+	return items
+}
+
+func checkOrder(t *testing.T, items []*txQueueItem, expected []*txQueueItem) {
+	t.Helper()
+	if len(items) != len(expected) {
+		t.Fatal("wrong item count", len(items))
+	}
+	for i := range items {
+		if items[i] != expected[i] {
+			t.Error("wrong item at", i)
+		}
+	}
+}
+
+func TestFIFOOrdering(t *testing.T) {
+	q, err := newSequencerQueue(FIFOOrdering, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	sender := ethcommon.Address{1}
+	items := []*txQueueItem{
+		newOrderingTestItem(sender, 0, 1, now),
+		newOrderingTestItem(sender, 1, 5, now),
+		newOrderingTestItem(sender, 2, 3, now),
+	}
+	for _, item := range items {
+		q.push(item)
+	}
+	checkOrder(t, popAll(t, q), items)
+}
+
+func TestPriorityOrdering(t *testing.T) {
+	q, err := newSequencerQueue(PriorityOrdering, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	q.clock = func() time.Time { return now.Add(3 * time.Second) }
+	low := newOrderingTestItem(ethcommon.Address{1}, 0, 1, now)
+	high := newOrderingTestItem(ethcommon.Address{2}, 0, 10, now.Add(500*time.Millisecond))
+	late := newOrderingTestItem(ethcommon.Address{3}, 0, 100, now.Add(2*time.Second))
+	q.push(low)
+	q.push(high)
+	q.push(late)
+	// late bid the most but arrived outside the window of low
+	checkOrder(t, popAll(t, q), []*txQueueItem{high, low, late})
+
+	if _, err := newSequencerQueue(PriorityOrdering, 0, 0); err == nil {
+		t.Error("expected error for empty priority window")
+	}
+}
+
+func TestPriorityOrderingSenderNonces(t *testing.T) {
+	q, err := newSequencerQueue(PriorityOrdering, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	q.clock = func() time.Time { return now.Add(2 * time.Second) }
+	a := ethcommon.Address{1}
+	b := ethcommon.Address{2}
+	a1 := newOrderingTestItem(a, 1, 100, now)
+	a0 := newOrderingTestItem(a, 0, 1, now.Add(100*time.Millisecond))
+	b0 := newOrderingTestItem(b, 0, 10, now.Add(200*time.Millisecond))
+	for _, item := range []*txQueueItem{a1, a0, b0} {
+		q.push(item)
+	}
+	// a1 bid the most but can't be sequenced before a0
+	checkOrder(t, popAll(t, q), []*txQueueItem{b0, a0, a1})
+}
+
+func TestPriorityOrderingHold(t *testing.T) {
+	q, err := newSequencerQueue(PriorityOrdering, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	q.clock = func() time.Time { return now }
+	low := newOrderingTestItem(ethcommon.Address{1}, 0, 1, now)
+	q.push(low)
+	<-q.ready
+	if q.pop() != nil {
+		t.Fatal("transaction should be held until the window has passed")
+	}
+
+	// A higher bid arriving within the window goes first
+	high := newOrderingTestItem(ethcommon.Address{2}, 0, 10, now.Add(500*time.Millisecond))
+	q.push(high)
+	<-q.ready
+	if q.pop() != nil {
+		t.Fatal("transaction should be held until the window has passed")
+	}
+	q.clock = func() time.Time { return now.Add(time.Second) }
+	checkOrder(t, popAll(t, q), []*txQueueItem{high, low})
+
+	// Nothing is held once the queue is full
+	q.clock = func() time.Time { return now }
+	for i := 0; i < cap(q.slots); i++ {
+		q.push(newOrderingTestItem(ethcommon.Address{3}, uint64(i), 1, now))
+	}
+	if item := q.pop(); item == nil || item.tx.Nonce() != 0 {
+		t.Error("expected full queue to release its first transaction")
+	}
+	if q.pop() != nil {
+		t.Error("transaction should be held once there's room in the queue")
+	}
+}
+
+func TestPriorityOrderingQueueSize(t *testing.T) {
+	q, err := newSequencerQueue(PriorityOrdering, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cap(q.slots) != priorityQueueSize {
+		t.Fatal("wrong default priority queue size", cap(q.slots))
+	}
+
+	// More transactions than the other policies queue arrive within the
+	// window, and the last one still overtakes all of them
+	now := time.Now()
+	q.clock = func() time.Time { return now }
+	var items []*txQueueItem
+	for i := 0; i < 5*sequencerQueueSize; i++ {
+		item := newOrderingTestItem(ethcommon.Address{byte(i + 1)}, 0, int64(i+1), now.Add(time.Duration(i)*time.Millisecond))
+		q.push(item)
+		items = append(items, item)
+	}
+	if q.pop() != nil {
+		t.Fatal("transaction should be held until the window has passed")
+	}
+	q.clock = func() time.Time { return now.Add(2 * time.Second) }
+	popped := popAll(t, q)
+	if len(popped) != len(items) || popped[0] != items[len(items)-1] {
+		t.Error("expected the highest bid in the window to be sequenced first")
+	}
+
+	// A configured size bounds the window under load
+	q, err = newSequencerQueue(PriorityOrdering, time.Second, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.clock = func() time.Time { return now }
+	for i := 0; i < 4; i++ {
+		q.push(newOrderingTestItem(ethcommon.Address{byte(i + 1)}, 0, int64(i+1), now))
+	}
+	if item := q.pop(); item == nil || item.tx.GasPrice().Int64() != 4 {
+		t.Error("expected full queue to release its highest bid")
+	}
+	if q.pop() != nil {
+		t.Error("transaction should be held once there's room in the queue")
+	}
+
+	if _, err := newSequencerQueue(PriorityOrdering, time.Second, -1); err == nil {
+		t.Error("expected error for negative queue size")
+	}
+}
+
+func TestRoundRobinOrdering(t *testing.T) {
+	q, err := newSequencerQueue(RoundRobinOrdering, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	a := ethcommon.Address{1}
+	b := ethcommon.Address{2}
+	a0 := newOrderingTestItem(a, 0, 1, now)
+	a1 := newOrderingTestItem(a, 1, 1, now)
+	a2 := newOrderingTestItem(a, 2, 1, now)
+	b0 := newOrderingTestItem(b, 0, 1, now)
+	b1 := newOrderingTestItem(b, 1, 1, now)
+	for _, item := range []*txQueueItem{a0, a1, a2, b0, b1} {
+		q.push(item)
+	}
+	checkOrder(t, popAll(t, q), []*txQueueItem{a0, b0, a1, b1, a2})
+}
+
+func TestOrderingQueueFull(t *testing.T) {
+	q, err := newSequencerQueue(FIFOOrdering, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < sequencerQueueSize; i++ {
+		if !q.tryPush(newOrderingTestItem(ethcommon.Address{}, uint64(i), 1, now)) {
+			t.Fatal("queue full too early")
+		}
+	}
+	if q.tryPush(newOrderingTestItem(ethcommon.Address{}, sequencerQueueSize, 1, now)) {
+		t.Error("expected queue to be full")
+	}
+	q.pop()
+	if !q.tryPush(newOrderingTestItem(ethcommon.Address{}, sequencerQueueSize, 1, now)) {
+		t.Error("expected room after pop")
+	}
+}
+
+func TestUnknownOrdering(t *testing.T) {
+	if _, err := newSequencerQueue("random", 0, 0); err == nil {
+		t.Error("expected error for unknown ordering policy")
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+var (
+	batchPostingDelayedCounter = metrics.NewRegisteredCounter("arbitrum/sequencer/batchposting/delayed", nil)
+	batchPostingUrgentCounter  = metrics.NewRegisteredCounter("arbitrum/sequencer/batchposting/urgent", nil)
+	batchPostingSavedCounter   = metrics.NewRegisteredCounter("arbitrum/sequencer/batchposting/estimated-saved-gwei", nil)
+)
+
+var gweiInWei = big.NewInt(1e9)
+
+// batchPostingPolicy decides whether a batch due to be posted should wait
+// for L1 gas to come down, and whether one should be posted before it's due
+type batchPostingPolicy struct {
+	highGasThreshold   *big.Int
+	highGasDelayBlocks *big.Int
+	smallBacklogGas    int64
+	urgentDelayBlocks  *big.Int
+
+	// L1 base fee when posting was first delayed, or nil if it isn't
+	delayedAtBaseFee *big.Int
+}
+
+func newBatchPostingPolicy(config *configuration.Sequencer, maxDelayBlocks *big.Int) *batchPostingPolicy {
+	thresholdGwei := new(big.Float).SetFloat64(config.L1PostingStrategy.HighGasThreshold)
+	highGasThreshold, _ := new(big.Float).Mul(thresholdGwei, new(big.Float).SetInt(gweiInWei)).Int(nil)
+	urgentDelayBlocks, _ := new(big.Float).Mul(
+		new(big.Float).SetInt(maxDelayBlocks),
+		big.NewFloat(config.BatchPosting.UrgentDelayFraction),
+	).Int(nil)
+	return &batchPostingPolicy{
+		highGasThreshold:   highGasThreshold,
+		highGasDelayBlocks: big.NewInt(config.L1PostingStrategy.HighGasDelayBlocks),
+		smallBacklogGas:    int64(float64(config.MaxBatchGasCost) * config.BatchPosting.SmallBacklogFraction),
+		urgentDelayBlocks:  urgentDelayBlocks,
+	}
+}
+
+// urgent returns true if the oldest unposted message, sequenced at L1 block
+// firstUnpostedAt, is close enough to the max delay that the next batch
+// shouldn't wait for the batch interval. firstUnpostedAt is nil if there's
+// nothing to post
+func (p *batchPostingPolicy) urgent(blockNum *big.Int, firstUnpostedAt *big.Int) bool {
+	if p.urgentDelayBlocks.Sign() <= 0 || firstUnpostedAt == nil {
+		return false
+	}
+	return new(big.Int).Sub(blockNum, firstUnpostedAt).Cmp(p.urgentDelayBlocks) >= 0
+}
+
+// shouldDelay returns true if a batch due at targetCreateBatch should wait
+// because L1 gas is high and there isn't much to post. baseFee may be nil
+// if it's unknown, in which case posting isn't delayed
+func (p *batchPostingPolicy) shouldDelay(
+	blockNum *big.Int,
+	targetCreateBatch *big.Int,
+	firstUnpostedAt *big.Int,
+	backlogGas int64,
+	baseFee *big.Int,
+) bool {
+	if baseFee == nil || baseFee.Cmp(p.highGasThreshold) < 0 {
+		return false
+	}
+	if backlogGas >= p.smallBacklogGas {
+		return false
+	}
+	if blockNum.Cmp(new(big.Int).Add(targetCreateBatch, p.highGasDelayBlocks)) >= 0 {
+		return false
+	}
+	if p.urgent(blockNum, firstUnpostedAt) {
+		return false
+	}
+	if p.delayedAtBaseFee == nil {
+		p.delayedAtBaseFee = baseFee
+		batchPostingDelayedCounter.Inc(1)
+	}
+	return true
+}
+
+// batchPosted records a posted batch, returning the estimated cost saved in
+// wei if it was delayed for high gas. batchGas is the batch's estimated L1
+// gas usage and baseFee the current L1 base fee, which may be nil
+func (p *batchPostingPolicy) batchPosted(batchGas int64, baseFee *big.Int) *big.Int {
+	delayedAtBaseFee := p.delayedAtBaseFee
+	p.delayedAtBaseFee = nil
+	if delayedAtBaseFee == nil || baseFee == nil || baseFee.Cmp(delayedAtBaseFee) >= 0 {
+		return big.NewInt(0)
+	}
+	saved := new(big.Int).Sub(delayedAtBaseFee, baseFee)
+	saved.Mul(saved, big.NewInt(batchGas))
+	batchPostingSavedCounter.Inc(new(big.Int).Div(saved, gweiInWei).Int64())
+	return saved
+}
+
+// l1BaseFee returns the base fee of the latest L1 block, falling back to
+// the suggested gas price before London
+func l1BaseFee(ctx context.Context, client ethutils.EthClient) (*big.Int, error) {
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if header.BaseFee != nil {
+		return header.BaseFee, nil
+	}
+	return client.SuggestGasPrice(ctx)
+}
+
+// firstUnpostedBlock returns the L1 block number the oldest sequencer message
+// not yet posted as of blockNum was sequenced at, or nil if there's nothing
+// to post. Delayed messages are skipped as they're already on L1. Only called
+// from the Start loop, which caches the result until more messages are posted
+func (b *SequencerBatcher) firstUnpostedBlock(ctx context.Context, blockNum *big.Int) (*big.Int, error) {
+	postedCount, err := b.sequencerInbox.MessageCount(&bind.CallOpts{
+		Context:     ctx,
+		BlockNumber: blockNum,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if b.firstUnpostedAt != nil && b.firstUnpostedCount.Cmp(postedCount) == 0 {
+		return b.firstUnpostedAt, nil
+	}
+
+	b.inboxReader.MessageDeliveryMutex.Lock()
+	batchItems, err := b.db.GetSequencerBatchItems(postedCount)
+	b.inboxReader.MessageDeliveryMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	b.firstUnpostedAt = nil
+	b.firstUnpostedCount = postedCount
+	for _, item := range batchItems {
+		if len(item.SequencerMessage) == 0 {
+			continue
+		}
+		msg, err := inbox.NewInboxMessageFromData(item.SequencerMessage)
+		if err != nil {
+			return nil, err
+		}
+		b.firstUnpostedAt = msg.ChainTime.BlockNum.AsInt()
+		break
+	}
+	return b.firstUnpostedAt, nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+func newTestPostingPolicy() *batchPostingPolicy {
+	config := &configuration.Sequencer{
+		MaxBatchGasCost: 2_000_000,
+		L1PostingStrategy: configuration.L1PostingStrategy{
+			HighGasThreshold:   150,
+			HighGasDelayBlocks: 270,
+		},
+		BatchPosting: configuration.BatchPosting{
+			SmallBacklogFraction: 0.5,
+			UrgentDelayFraction:  0.75,
+		},
+	}
+	return newBatchPostingPolicy(config, big.NewInt(5760))
+}
+
+func gwei(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), gweiInWei)
+}
+
+func TestBatchPostingPolicyDelay(t *testing.T) {
+	p := newTestPostingPolicy()
+	firstUnposted := big.NewInt(1000)
+	target := big.NewInt(1240)
+	blockNum := big.NewInt(1250)
+
+	if p.shouldDelay(blockNum, target, firstUnposted, 100_000, gwei(100)) {
+		t.Error("delayed posting with low gas price")
+	}
+	if p.shouldDelay(blockNum, target, firstUnposted, 100_000, nil) {
+		t.Error("delayed posting with unknown gas price")
+	}
+	if p.shouldDelay(blockNum, target, firstUnposted, 1_500_000, gwei(200)) {
+		t.Error("delayed posting with large backlog")
+	}
+	if p.shouldDelay(big.NewInt(1510), target, firstUnposted, 100_000, gwei(200)) {
+		t.Error("delayed posting past high gas delay")
+	}
+	if !p.shouldDelay(blockNum, target, firstUnposted, 100_000, gwei(200)) {
+		t.Error("didn't delay small batch with high gas price")
+	}
+	if !p.shouldDelay(big.NewInt(1260), target, firstUnposted, 100_000, gwei(300)) {
+		t.Error("didn't keep delaying small batch with high gas price")
+	}
+
+	// Savings are measured from the base fee when posting was first delayed
+	saved := p.batchPosted(100_000, gwei(120))
+	if saved.Cmp(gwei(80*100_000)) != 0 {
+		t.Error("wrong estimated savings", saved)
+	}
+	if p.batchPosted(100_000, gwei(100)).Sign() != 0 {
+		t.Error("estimated savings for batch that wasn't delayed")
+	}
+}
+
+func TestBatchPostingPolicyNoSavingsIfGasRose(t *testing.T) {
+	p := newTestPostingPolicy()
+	if !p.shouldDelay(big.NewInt(1250), big.NewInt(1240), big.NewInt(1000), 100_000, gwei(200)) {
+		t.Fatal("didn't delay small batch with high gas price")
+	}
+	if p.batchPosted(100_000, gwei(250)).Sign() != 0 {
+		t.Error("estimated savings when gas price rose")
+	}
+}
+
+func TestBatchPostingPolicyUrgent(t *testing.T) {
+	p := newTestPostingPolicy()
+	firstUnposted := big.NewInt(1000)
+	if p.urgent(big.NewInt(5000), firstUnposted) {
+		t.Error("urgent well before max delay")
+	}
+	if !p.urgent(big.NewInt(5320), firstUnposted) {
+		t.Error("not urgent close to max delay")
+	}
+	if p.shouldDelay(big.NewInt(5320), big.NewInt(5300), firstUnposted, 100_000, gwei(200)) {
+		t.Error("delayed urgent batch")
+	}
+	if p.urgent(big.NewInt(5320), nil) {
+		t.Error("urgent with nothing to post")
+	}
+
+	p = newBatchPostingPolicy(&configuration.Sequencer{}, big.NewInt(5760))
+	if p.urgent(big.NewInt(1_000_000), firstUnposted) {
+		t.Error("urgent with urgency disabled")
+	}
+}
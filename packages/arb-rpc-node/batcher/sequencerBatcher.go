@@ -53,6 +53,8 @@ type SequencerLockoutManager interface {
 
 type txQueueItem struct {
 	tx         *types.Transaction
+	sender     ethcommon.Address
+	queuedAt   time.Time
 	ctx        context.Context
 	resultChan chan error
 }
@@ -76,28 +78,47 @@ type SequencerBatcher struct {
 	sequenceDelayedMessagesInterval *big.Int
 	createBatchBlockInterval        *big.Int
 	LockoutManager                  SequencerLockoutManager
+	txFilter                        TxFilter
 	config                          *configuration.Config
 	fb                              *fireblocks.Fireblocks
 	consecutiveShouldReorgGaps      int
 	gasRefunderAddress              ethcommon.Address
 	gasRefunder                     *ethbridgecontracts.GasRefunder
 
-	signer  types.Signer
-	txQueue chan txQueueItem
+	signer        types.Signer
+	intake        *txIntake
+	txQueue       *sequencerQueue
+	heldTxs       *holdingPool
+	postingPolicy *batchPostingPolicy
+	journal       *sequencerJournal
 
 	latestChainTime        inbox.ChainTime
 	lastCreatedBatchAt     *big.Int
 	lastSequencedDelayedAt *big.Int
+	// L1 block number the oldest unposted message was sequenced at, as of
+	// firstUnpostedCount posted messages. Only accessed by the Start loop
+	firstUnpostedAt    *big.Int
+	firstUnpostedCount *big.Int
 	// 1 if we've published a batch to the L1 mempool,
 	// but it hasn't been included in an L1 block yet.
 	publishingBatchesAtomic int32
 	// The total estimate of unpublished transactions' gas usage.
 	// Added to every time something is sequenced, zeroed when batch posted.
 	pendingBatchGasEstimateAtomic int64
+	// 1 if user transactions shouldn't be sequenced
+	pausedAtomic int32
+	// 1 if batches shouldn't be posted to L1
+	batchPostingDisabledAtomic int32
+	// 1 if a batch should be created without waiting for the batch interval
+	forceBatchAtomic int32
+	// The number of SendTransaction calls waiting for a result
+	pendingTxsAtomic int64
 }
 
 var refundGasCostsDeniedEventID ethcommon.Hash
 
+var errBatchPostingDisabled = errors.New("batch posting is disabled")
+
 func init() {
 	parsedGasRefunderABI, err := abi.JSON(strings.NewReader(ethbridgecontracts.GasRefunderABI))
 	if err != nil {
@@ -129,6 +150,7 @@ func NewSequencerBatcher(
 	auth *bind.TransactOpts,
 	dataSigner func([]byte) ([]byte, error),
 	broadcaster *broadcaster.Broadcaster,
+	txFilter TxFilter,
 	config *configuration.Config,
 	walletConfig *configuration.Wallet,
 ) (*SequencerBatcher, error) {
@@ -175,6 +197,15 @@ func NewSequencerBatcher(
 		return nil, errors.New("invalid batch creation block interval")
 	}
 
+	txQueue, err := newSequencerQueue(
+		config.Node.Sequencer.Ordering,
+		config.Node.Sequencer.OrderingPriorityWindow,
+		config.Node.Sequencer.OrderingQueueSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	var gasRefunderAddr ethcommon.Address
 	var gasRefunder *ethbridgecontracts.GasRefunder
 	if len(config.Node.Sequencer.GasRefunderAddress) > 0 {
@@ -195,6 +226,14 @@ func NewSequencerBatcher(
 		}
 	}
 
+	var journal *sequencerJournal
+	if len(config.Node.Sequencer.JournalFile) > 0 {
+		journal, err = openSequencerJournal(config.Node.Sequencer.JournalFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	batcher := &SequencerBatcher{
 		db:                         db,
 		inboxReader:                inboxReader,
@@ -207,6 +246,7 @@ func NewSequencerBatcher(
 		chainTimeCheckInterval:     time.Second,
 		feedBroadcaster:            broadcaster,
 		dataSigner:                 dataSigner,
+		txFilter:                   txFilter,
 		maxDelayBlocks:             maxDelayBlocks,
 		maxDelaySeconds:            maxDelaySeconds,
 		config:                     config,
@@ -219,7 +259,10 @@ func NewSequencerBatcher(
 		createBatchBlockInterval:        big.NewInt(config.Node.Sequencer.CreateBatchBlockInterval),
 
 		signer:                        types.NewEIP155Signer(chainId),
-		txQueue:                       make(chan txQueueItem, 10),
+		txQueue:                       txQueue,
+		heldTxs:                       newHoldingPool(config.Node.Sequencer.HoldingPool),
+		postingPolicy:                 newBatchPostingPolicy(&config.Node.Sequencer, maxDelayBlocks),
+		journal:                       journal,
 		latestChainTime:               chainTime,
 		lastSequencedDelayedAt:        chainTime.BlockNum.AsInt(),
 		lastCreatedBatchAt:            chainTime.BlockNum.AsInt(),
@@ -227,6 +270,9 @@ func NewSequencerBatcher(
 		pendingBatchGasEstimateAtomic: int64(gasCostBase),
 		fb:                            fb,
 	}
+	batcher.SetBatchPostingEnabled(!config.Node.Sequencer.Dangerous.DisableBatchPosting)
+	batcher.intake = newTxIntake(ctx, config.Node.Sequencer.Intake, batcher.checkTransaction, txQueue)
+	go batcher.sequenceLoop(ctx)
 
 	return batcher, nil
 }
@@ -267,23 +313,56 @@ func txLogsToResults(logs []core.ValueAndInbox) (map[common.Hash]*evm.TxResult,
 
 const maxTxDataSize int = 100_000
 
-func (b *SequencerBatcher) SendTransaction(startCtx context.Context, startTx *types.Transaction) error {
+func (b *SequencerBatcher) SendTransaction(ctx context.Context, tx *types.Transaction) error {
 	if b.config.Node.Sequencer.Dangerous.DisableUserMessageSequencing {
 		return errors.New("Arbitrum is temporarily unavailable while migrating to Nitro")
 	}
+	if b.SequencingPaused() {
+		return errors.New("sequencing is paused")
+	}
 
-	_, err := types.Sender(b.signer, startTx)
+	atomic.AddInt64(&b.pendingTxsAtomic, 1)
+	defer atomic.AddInt64(&b.pendingTxsAtomic, -1)
+	resultChan, err := b.intake.submit(ctx, tx)
 	if err != nil {
-		logger.Warn().Err(err).Msg("error processing user transaction")
 		return err
 	}
-	if len(startTx.Data()) > maxTxDataSize {
-		return errors.New("oversized data")
+	return b.intake.wait(ctx, resultChan)
+}
+
+// checkTransaction is run by the intake workers on each incoming transaction
+func (b *SequencerBatcher) checkTransaction(ctx context.Context, tx *types.Transaction) (ethcommon.Address, error) {
+	sender, err := types.Sender(b.signer, tx)
+	if err != nil {
+		logger.Warn().Err(err).Msg("error processing user transaction")
+		return ethcommon.Address{}, err
+	}
+	if err := filterTransaction(ctx, b.txFilter, tx, sender); err != nil {
+		return ethcommon.Address{}, err
+	}
+	if len(tx.Data()) > maxTxDataSize {
+		return ethcommon.Address{}, errors.New("oversized data")
 	}
-	logger.Info().Str("hash", startTx.Hash().String()).Msg("got user tx")
+	logger.Info().Str("hash", tx.Hash().String()).Msg("got user tx")
+	return sender, nil
+}
+
+// sequenceLoop is the final stage of the intake pipeline, sequencing queued
+// transactions whenever any are pushed
+func (b *SequencerBatcher) sequenceLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.txQueue.ready:
+		}
+		b.sequenceQueued()
+	}
+}
 
-	startResultChan := make(chan error, 1)
-	b.txQueue <- txQueueItem{tx: startTx, resultChan: startResultChan, ctx: startCtx}
+// sequenceQueued sequences batches of queued transactions until the queue
+// is empty
+func (b *SequencerBatcher) sequenceQueued() {
 	b.inboxReader.MessageDeliveryMutex.Lock()
 	defer b.inboxReader.MessageDeliveryMutex.Unlock()
 
@@ -297,287 +376,396 @@ func (b *SequencerBatcher) SendTransaction(startCtx context.Context, startTx *ty
 	}
 
 	if b.LockoutManager != nil && !b.LockoutManager.ShouldSequence() {
-		return errors.New("sequencer missing lockout")
-	}
-
-	if len(startResultChan) > 0 {
-		// startTx was already picked up by another thread
-		err = <-startResultChan
-		if err != nil {
-			core.WaitForMachineIdle(b.db)
+		err := errors.New("sequencer missing lockout")
+		for {
+			queueItem := b.txQueue.pop()
+			if queueItem == nil {
+				break
+			}
+			queueItem.resultChan <- err
 		}
-		return err
+		return
 	}
 
-	// We don't want to cancel the whole batch if one user's context got canceled.
-	// Unfortunately, there's no good way to take a union of contexts,
-	// so we just use a background context for this.
-	bgCtx := context.Background()
-
+	// Held transactions whose nonce gap was filled by a sequenced transaction
+	var released []*txQueueItem
 	for {
-		var batchTxs []*types.Transaction
-		var resultChans []chan error
-		var l2BatchContents []message.AbstractL2Message
+		var batch []*txQueueItem
 		var batchDataSize int
-		seenOwnTx := false
 		emptiedQueue := true
 		txHashesSet := make(map[ethcommon.Hash]struct{})
+		var notReleased []*txQueueItem
+		for _, item := range released {
+			txHash := item.tx.Hash()
+			if _, txAlreadyInBatch := txHashesSet[txHash]; txAlreadyInBatch {
+				continue
+			}
+			if batchDataSize+len(item.tx.Data()) > maxTxDataSize {
+				notReleased = append(notReleased, item)
+				continue
+			}
+			b.txQueue.observeWait(item)
+			batch = append(batch, item)
+			batchDataSize += len(item.tx.Data())
+			txHashesSet[txHash] = struct{}{}
+		}
+		released = notReleased
 		// This pattern is safe as we acquired a lock so we are the exclusive reader
-		for len(b.txQueue) > 0 {
-			queueItem := <-b.txQueue
-			err = queueItem.ctx.Err()
-			if err != nil {
-				if queueItem.tx == startTx {
-					seenOwnTx = true
-				}
+		for {
+			queueItem := b.txQueue.pop()
+			if queueItem == nil {
+				break
+			}
+			if err := queueItem.ctx.Err(); err != nil {
 				queueItem.resultChan <- err
 				continue
 			}
 			if batchDataSize+len(queueItem.tx.Data()) > maxTxDataSize {
 				// This batch would be too large to publish with this tx added.
 				// Put the tx back in the queue so it can be included later.
-				select {
-				case b.txQueue <- queueItem:
-				default:
+				if !b.txQueue.tryPush(queueItem) {
 					queueItem.resultChan <- errors.New("sequencer overloaded")
-					if queueItem.tx == startTx {
-						seenOwnTx = true
-					}
 				}
 				emptiedQueue = false
 				break
 			}
-			if queueItem.tx == startTx {
-				seenOwnTx = true
-			}
 			txHash := queueItem.tx.Hash()
 			_, txAlreadyInBatch := txHashesSet[txHash]
 			if txAlreadyInBatch {
 				queueItem.resultChan <- errors.New("already known")
 				continue
 			}
-			batchTxs = append(batchTxs, queueItem.tx)
-			resultChans = append(resultChans, queueItem.resultChan)
-			l2BatchContents = append(l2BatchContents, message.NewCompressedECDSAFromEth(queueItem.tx))
+			b.txQueue.observeWait(queueItem)
+			batch = append(batch, queueItem)
 			batchDataSize += len(queueItem.tx.Data())
 			txHashesSet[txHash] = struct{}{}
 		}
-		if !seenOwnTx && emptiedQueue && batchDataSize+len(startTx.Data()) <= maxTxDataSize {
-			// Another thread must have encountered an internal error attempting to process startTx
-			// Let's try again ourselves (if we fail this time we won't try again)
-			batchTxs = append(batchTxs, startTx)
-			resultChans = append(resultChans, startResultChan)
-			l2BatchContents = append(l2BatchContents, message.NewCompressedECDSAFromEth(startTx))
-			seenOwnTx = true
+
+		if len(batch) > 0 {
+			newlyReleased, err := b.sequenceBatch(batch, debugTiming, start)
+			if err != nil {
+				logger.Error().Err(err).Int("txs", len(batch)).Msg("error sequencing transactions")
+			}
+			released = append(released, newlyReleased...)
 		}
-		if len(batchTxs) == 0 {
+
+		if emptiedQueue && len(released) == 0 {
 			break
 		}
-		logger.Info().Int("count", len(l2BatchContents)).Msg("gather user txes")
+	}
+}
 
-		if debugTiming {
-			logger.Info().Str("elapsed", time.Since(start).String()).Msg("preparing first sequencer message")
-		}
-		msgCount, err := b.db.GetMessageCount()
-		if err != nil {
-			return err
+// sequenceBatch sequences batch in a single L2 block, responding to each
+// transaction once the block has been executed. It returns held transactions
+// released by the batch. Must be called with the MessageDeliveryMutex held
+func (b *SequencerBatcher) sequenceBatch(batch []*txQueueItem, debugTiming bool, start time.Time) (released []*txQueueItem, err error) {
+	// We don't want to cancel the whole batch if one user's context got canceled.
+	// Unfortunately, there's no good way to take a union of contexts,
+	// so we just use a background context for this.
+	bgCtx := context.Background()
+
+	answered := make([]bool, len(batch))
+	respond := func(i int, err error) {
+		if !answered[i] {
+			answered[i] = true
+			batch[i].resultChan <- err
 		}
-		var prevAcc common.Hash
-		if msgCount.Cmp(big.NewInt(0)) > 0 {
-			prevAcc, err = b.db.GetInboxAcc(new(big.Int).Sub(msgCount, big.NewInt(1)))
-			if err != nil {
-				return err
-			}
+	}
+	// Transactions that have been sequenced, which are responded to once
+	// their block is complete
+	var sequenced []int
+	defer func() {
+		for _, i := range sequenced {
+			respond(i, nil)
 		}
-		originalAcc := prevAcc
-		totalDelayedCount, err := b.db.GetTotalDelayedMessagesSequenced()
 		if err != nil {
-			return err
-		}
-		if totalDelayedCount.Cmp(big.NewInt(0)) == 0 {
-			return errors.New("chain not yet initialized")
+			for i := range batch {
+				respond(i, err)
+			}
 		}
+	}()
 
-		batch, err := message.NewTransactionBatchFromMessages(l2BatchContents)
-		if err != nil {
-			return err
-		}
-		l2Message := message.NewSafeL2Message(batch)
-		seqMsg := message.NewInboxMessage(l2Message, b.fromAddress, new(big.Int).Set(msgCount), big.NewInt(0), b.latestChainTime.Clone())
+	var l2BatchContents []message.AbstractL2Message
+	for _, item := range batch {
+		l2BatchContents = append(l2BatchContents, message.NewCompressedECDSAFromEth(item.tx))
+	}
 
-		logCount, err := b.db.GetLogCount()
+	if debugTiming {
+		logger.Info().Str("elapsed", time.Since(start).String()).Msg("preparing first sequencer message")
+	}
+	msgCount, err := b.db.GetMessageCount()
+	if err != nil {
+		return nil, err
+	}
+	var prevAcc common.Hash
+	if msgCount.Cmp(big.NewInt(0)) > 0 {
+		prevAcc, err = b.db.GetInboxAcc(new(big.Int).Sub(msgCount, big.NewInt(1)))
 		if err != nil {
-			return err
+			return nil, err
 		}
+	}
+	originalAcc := prevAcc
+	originalMsgCount := new(big.Int).Set(msgCount)
+	totalDelayedCount, err := b.db.GetTotalDelayedMessagesSequenced()
+	if err != nil {
+		return nil, err
+	}
+	if totalDelayedCount.Cmp(big.NewInt(0)) == 0 {
+		return nil, errors.New("chain not yet initialized")
+	}
+
+	l2Batch, err := message.NewTransactionBatchFromMessages(l2BatchContents)
+	if err != nil {
+		return nil, err
+	}
+	l2Message := message.NewSafeL2Message(l2Batch)
+	seqMsg := message.NewInboxMessage(l2Message, b.fromAddress, new(big.Int).Set(msgCount), big.NewInt(0), b.latestChainTime.Clone())
+
+	logCount, err := b.db.GetLogCount()
+	if err != nil {
+		return nil, err
+	}
+
+	txBatchItem := inbox.NewSequencerItem(totalDelayedCount, seqMsg, prevAcc)
+	if debugTiming {
+		logger.Info().Str("elapsed", time.Since(start).String()).Msg("before deliver messages")
+	}
+	err = core.DeliverMessagesAndWait(bgCtx, b.db, msgCount, prevAcc, []inbox.SequencerBatchItem{txBatchItem}, []inbox.DelayedMessage{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if debugTiming {
+		logger.Info().Str("elapsed", time.Since(start).String()).Msg("after deliver messages, before machine idle")
+	}
+	core.WaitForMachineIdle(b.db)
+	if debugTiming {
+		logger.Info().Str("elapsed", time.Since(start).String()).Msg("after machine idle")
+	}
+
+	var sequencedBatchItems []inbox.SequencerBatchItem
 
-		txBatchItem := inbox.NewSequencerItem(totalDelayedCount, seqMsg, prevAcc)
+	newLogCount, err := b.db.GetLogCount()
+	if err != nil {
+		return nil, err
+	}
+	txLogs, err := b.db.GetLogs(logCount, new(big.Int).Sub(newLogCount, logCount))
+	if err != nil {
+		return nil, err
+	}
+	txResults, err := txLogsToResults(txLogs)
+	if err != nil {
+		return nil, err
+	}
+
+	txHashes := make([]common.Hash, 0, len(batch))
+	for _, item := range batch {
+		txHashes = append(txHashes, common.NewHashFromEth(item.tx.Hash()))
+	}
+
+	successCount := 0
+	for _, hash := range txHashes {
+		if shouldIncludeTxResult(txResults[hash]) {
+			successCount++
+		}
+	}
+	if successCount == len(batch) {
+		msgCount = new(big.Int).Add(msgCount, big.NewInt(1))
+		prevAcc = txBatchItem.Accumulator
+		sequencedBatchItems = append(sequencedBatchItems, txBatchItem)
+		postingCostEstimate := gasCostPerMessage + gasCostPerMessageByte*len(seqMsg.Data)
+		atomic.AddInt64(&b.pendingBatchGasEstimateAtomic, int64(postingCostEstimate))
+		for i, item := range batch {
+			sequenced = append(sequenced, i)
+			released = b.releaseHeldTx(released, item.sender, item.tx.Nonce())
+		}
+	} else {
 		if debugTiming {
-			logger.Info().Str("elapsed", time.Since(start).String()).Msg("before deliver messages")
+			logger.Info().Str("elapsed", time.Since(start).String()).Msg("reorging as tx failed")
 		}
-		err = core.DeliverMessagesAndWait(bgCtx, b.db, msgCount, prevAcc, []inbox.SequencerBatchItem{txBatchItem}, []inbox.DelayedMessage{}, nil)
+		// Reorg to before we processed the batch and re-process the messages individually
+		err = core.DeliverMessagesAndWait(bgCtx, b.db, msgCount, prevAcc, nil, nil, msgCount)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if debugTiming {
-			logger.Info().Str("elapsed", time.Since(start).String()).Msg("after deliver messages, before machine idle")
+			logger.Info().Str("elapsed", time.Since(start).String()).Msg("after deliver reorg, before machine idle")
 		}
 		core.WaitForMachineIdle(b.db)
 		if debugTiming {
-			logger.Info().Str("elapsed", time.Since(start).String()).Msg("after machine idle")
-		}
-
-		var sequencedBatchItems []inbox.SequencerBatchItem
-
-		newLogCount, err := b.db.GetLogCount()
-		if err != nil {
-			return err
-		}
-		txLogs, err := b.db.GetLogs(logCount, new(big.Int).Sub(newLogCount, logCount))
-		if err != nil {
-			return err
+			logger.Info().Str("elapsed", time.Since(start).String()).Msg("after reorg machine idle")
 		}
-		txResults, err := txLogsToResults(txLogs)
-		if err != nil {
-			return err
-		}
-
-		txHashes := make([]common.Hash, 0, len(batchTxs))
-		for _, tx := range batchTxs {
-			txHashes = append(txHashes, common.NewHashFromEth(tx.Hash()))
-		}
-
-		successCount := 0
-		for _, hash := range txHashes {
-			if shouldIncludeTxResult(txResults[hash]) {
-				successCount++
+		if successCount == 0 {
+			// All of the transactions failed
+			for i, item := range batch {
+				respond(i, b.txFailed(bgCtx, item.tx, item.sender, txResults[txHashes[i]]))
 			}
-		}
-		if successCount == len(batchTxs) {
-			msgCount = new(big.Int).Add(msgCount, big.NewInt(1))
-			prevAcc = txBatchItem.Accumulator
-			sequencedBatchItems = append(sequencedBatchItems, txBatchItem)
-			postingCostEstimate := gasCostPerMessage + gasCostPerMessageByte*len(seqMsg.Data)
-			atomic.AddInt64(&b.pendingBatchGasEstimateAtomic, int64(postingCostEstimate))
-			for _, c := range resultChans {
-				c <- nil
-			}
-		} else {
-			if debugTiming {
-				logger.Info().Str("elapsed", time.Since(start).String()).Msg("reorging as tx failed")
+			return nil, nil
+		}
+		// At least one of the transactions failed and one of the transactions succeeded
+		for i, item := range batch {
+			tx := item.tx
+			txHash := txHashes[i]
+			if !shouldIncludeTxResult(txResults[txHash]) {
+				respond(i, b.txFailed(bgCtx, tx, item.sender, txResults[txHash]))
+				continue
 			}
-			// Reorg to before we processed the batch and re-process the messages individually
-			err = core.DeliverMessagesAndWait(bgCtx, b.db, msgCount, prevAcc, nil, nil, msgCount)
+			l2Msg := message.NewCompressedECDSAFromEth(tx)
+			l2Batch, err = message.NewTransactionBatchFromMessages([]message.AbstractL2Message{l2Msg})
 			if err != nil {
-				return err
+				return released, err
 			}
-			if debugTiming {
-				logger.Info().Str("elapsed", time.Since(start).String()).Msg("after deliver reorg, before machine idle")
+			l2Message := message.NewSafeL2Message(l2Batch)
+			seqMsg := message.NewInboxMessage(l2Message, b.fromAddress, new(big.Int).Set(msgCount), big.NewInt(0), b.latestChainTime.Clone())
+			txBatchItem := inbox.NewSequencerItem(totalDelayedCount, seqMsg, prevAcc)
+			err = core.DeliverMessagesAndWait(bgCtx, b.db, msgCount, prevAcc, []inbox.SequencerBatchItem{txBatchItem}, []inbox.DelayedMessage{}, nil)
+			if err != nil {
+				return released, err
 			}
 			core.WaitForMachineIdle(b.db)
-			if debugTiming {
-				logger.Info().Str("elapsed", time.Since(start).String()).Msg("after reorg machine idle")
+			newLogCount, err = b.db.GetLogCount()
+			if err != nil {
+				return released, err
 			}
-			if successCount == 0 {
-				// All of the transactions failed
-				for i, c := range resultChans {
-					c <- evm.HandleCallError(txResults[txHashes[i]], false)
-				}
-				return <-startResultChan
+			txLogs, err = b.db.GetLogs(logCount, new(big.Int).Sub(newLogCount, logCount))
+			if err != nil {
+				return released, err
 			}
-			// At least one of the transactions failed and one of the transactions succeeded
-			for i, tx := range batchTxs {
-				txHash := txHashes[i]
-				if !shouldIncludeTxResult(txResults[txHash]) {
-					resultChans[i] <- evm.HandleCallError(txResults[txHash], false)
-					continue
-				}
-				l2Msg := message.NewCompressedECDSAFromEth(tx)
-				batch, err = message.NewTransactionBatchFromMessages([]message.AbstractL2Message{l2Msg})
-				if err != nil {
-					return err
-				}
-				l2Message := message.NewSafeL2Message(batch)
-				seqMsg := message.NewInboxMessage(l2Message, b.fromAddress, new(big.Int).Set(msgCount), big.NewInt(0), b.latestChainTime.Clone())
-				txBatchItem := inbox.NewSequencerItem(totalDelayedCount, seqMsg, prevAcc)
-				err = core.DeliverMessagesAndWait(bgCtx, b.db, msgCount, prevAcc, []inbox.SequencerBatchItem{txBatchItem}, []inbox.DelayedMessage{}, nil)
-				if err != nil {
-					return err
-				}
-				core.WaitForMachineIdle(b.db)
-				newLogCount, err = b.db.GetLogCount()
-				if err != nil {
-					return err
-				}
-				txLogs, err = b.db.GetLogs(logCount, new(big.Int).Sub(newLogCount, logCount))
-				if err != nil {
-					return err
-				}
-				newTxResults, err := txLogsToResults(txLogs)
+			newTxResults, err := txLogsToResults(txLogs)
+			if err != nil {
+				return released, err
+			}
+			txResult := newTxResults[txHash]
+			if !shouldIncludeTxResult(txResult) {
+				err = core.DeliverMessagesAndWait(bgCtx, b.db, msgCount, prevAcc, nil, nil, msgCount)
 				if err != nil {
-					return err
+					return released, err
 				}
-				txResult := newTxResults[txHash]
-				if !shouldIncludeTxResult(txResult) {
-					err = core.DeliverMessagesAndWait(bgCtx, b.db, msgCount, prevAcc, nil, nil, msgCount)
-					if err != nil {
-						return err
-					}
-					resultChans[i] <- evm.HandleCallError(txResult, false)
-					continue
-				}
-				msgCount = new(big.Int).Add(msgCount, big.NewInt(1))
-				prevAcc = txBatchItem.Accumulator
-				sequencedBatchItems = append(sequencedBatchItems, txBatchItem)
-				postingCostEstimate := gasCostPerMessage + gasCostPerMessageByte*len(seqMsg.Data)
-				atomic.AddInt64(&b.pendingBatchGasEstimateAtomic, int64(postingCostEstimate))
-				logCount = newLogCount
-				resultChans[i] <- nil
-			}
-			if debugTiming {
-				logger.Info().Str("elapsed", time.Since(start).String()).Msg("after individually processing txs")
+				respond(i, b.txFailed(bgCtx, tx, item.sender, txResult))
+				continue
 			}
+			msgCount = new(big.Int).Add(msgCount, big.NewInt(1))
+			prevAcc = txBatchItem.Accumulator
+			sequencedBatchItems = append(sequencedBatchItems, txBatchItem)
+			postingCostEstimate := gasCostPerMessage + gasCostPerMessageByte*len(seqMsg.Data)
+			atomic.AddInt64(&b.pendingBatchGasEstimateAtomic, int64(postingCostEstimate))
+			logCount = newLogCount
+			sequenced = append(sequenced, i)
+			released = b.releaseHeldTx(released, item.sender, tx.Nonce())
 		}
-
-		newBlockMessage := message.NewInboxMessage(
-			message.EndBlockMessage{},
-			b.fromAddress,
-			new(big.Int).Set(msgCount),
-			big.NewInt(0),
-			b.latestChainTime.Clone(),
-		)
-
-		newBlockBatchItem := inbox.NewSequencerItem(totalDelayedCount, newBlockMessage, prevAcc)
-		sequencedBatchItems = append(sequencedBatchItems, newBlockBatchItem)
 		if debugTiming {
-			logger.Info().Str("elapsed", time.Since(start).String()).Msg("before deliver new block message")
+			logger.Info().Str("elapsed", time.Since(start).String()).Msg("after individually processing txs")
 		}
-		err = core.DeliverMessagesAndWait(bgCtx, b.db, msgCount, prevAcc, []inbox.SequencerBatchItem{newBlockBatchItem}, []inbox.DelayedMessage{}, nil)
+	}
+
+	newBlockMessage := message.NewInboxMessage(
+		message.EndBlockMessage{},
+		b.fromAddress,
+		new(big.Int).Set(msgCount),
+		big.NewInt(0),
+		b.latestChainTime.Clone(),
+	)
+
+	newBlockBatchItem := inbox.NewSequencerItem(totalDelayedCount, newBlockMessage, prevAcc)
+	sequencedBatchItems = append(sequencedBatchItems, newBlockBatchItem)
+	if debugTiming {
+		logger.Info().Str("elapsed", time.Since(start).String()).Msg("before deliver new block message")
+	}
+	err = core.DeliverMessagesAndWait(bgCtx, b.db, msgCount, prevAcc, []inbox.SequencerBatchItem{newBlockBatchItem}, []inbox.DelayedMessage{}, nil)
+	if err != nil {
+		return released, err
+	}
+	atomic.AddInt64(&b.pendingBatchGasEstimateAtomic, int64(gasCostPerMessage))
+
+	err = b.journalItems(originalMsgCount, originalAcc, sequencedBatchItems)
+	if err != nil {
+		return released, err
+	}
+	if b.feedBroadcaster != nil {
+		err = b.feedBroadcaster.Broadcast(originalAcc, sequencedBatchItems, b.dataSigner)
 		if err != nil {
-			return err
+			return released, err
 		}
-		atomic.AddInt64(&b.pendingBatchGasEstimateAtomic, int64(gasCostPerMessage))
+	}
 
-		if b.feedBroadcaster != nil {
-			err = b.feedBroadcaster.Broadcast(originalAcc, sequencedBatchItems, b.dataSigner)
-			if err != nil {
-				return err
-			}
-		}
+	if debugTiming {
+		logger.Info().Str("elapsed", time.Since(start).String()).Msg("after deliver new block message, before machine idle")
+	}
+	core.WaitForMachineIdle(b.db)
+	if debugTiming {
+		logger.Info().Str("elapsed", time.Since(start).String()).Msg("after final machine idle")
+	}
 
-		if debugTiming {
-			logger.Info().Str("elapsed", time.Since(start).String()).Msg("after deliver new block message, before machine idle")
-		}
-		core.WaitForMachineIdle(b.db)
-		if debugTiming {
-			logger.Info().Str("elapsed", time.Since(start).String()).Msg("after final machine idle")
-		}
+	return released, nil
+}
 
-		if seenOwnTx {
-			break
-		}
+// txFailed returns the result for a transaction that couldn't be sequenced.
+// If its nonce is ahead of its sender's it's held until the gap is filled,
+// and ErrTxHeld is returned as it hasn't been sequenced yet
+func (b *SequencerBatcher) txFailed(ctx context.Context, tx *types.Transaction, sender ethcommon.Address, txResult *evm.TxResult) error {
+	if txResult != nil && txResult.ResultCode == evm.BadSequenceCode && b.heldTxs.enabled() {
+		nonce, err := b.accountNonce(ctx, sender)
+		if err != nil {
+			logger.Warn().Err(err).Msg("error getting nonce to hold transaction")
+		} else if b.heldTxs.hold(&txQueueItem{
+			tx:         tx,
+			sender:     sender,
+			queuedAt:   time.Now(),
+			ctx:        context.Background(),
+			resultChan: make(chan error, 1),
+		}, nonce) {
+			logger.Info().
+				Str("hash", tx.Hash().String()).
+				Uint64("nonce", tx.Nonce()).
+				Uint64("accountNonce", nonce).
+				Msg("holding transaction until nonce gap is filled")
+			return ErrTxHeld
+		}
+	}
+	return evm.HandleCallError(txResult, false)
+}
+
+// releaseHeldTx adds the held transaction following a sequenced one to released
+func (b *SequencerBatcher) releaseHeldTx(released []*txQueueItem, sender ethcommon.Address, nonce uint64) []*txQueueItem {
+	item := b.heldTxs.release(sender, nonce+1)
+	if item == nil {
+		return released
 	}
+	logger.Info().Str("hash", item.tx.Hash().String()).Msg("releasing held transaction")
+	return append(released, item)
+}
+
+// accountNonce must be called with the MessageDeliveryMutex held
+func (b *SequencerBatcher) accountNonce(ctx context.Context, account ethcommon.Address) (uint64, error) {
+	core.WaitForMachineIdle(b.db)
+	mach, err := b.db.GetLastMachine()
+	if err != nil {
+		return 0, err
+	}
+	snap, err := snapshot.NewSnapshot(ctx, mach, b.latestChainTime.Clone(), big.NewInt(1<<60))
+	if err != nil {
+		return 0, err
+	}
+	nonce, err := snap.GetTransactionCount(ctx, common.NewAddressFromEth(account))
+	if err != nil {
+		return 0, err
+	}
+	return nonce.Uint64(), nil
+}
 
-	return <-startResultChan
+// TakeHeldTransactions removes and returns the transactions held waiting for
+// an earlier nonce, ordered by sender and then nonce, so they can be passed
+// on once this node stops sequencing
+func (b *SequencerBatcher) TakeHeldTransactions() []*types.Transaction {
+	return b.heldTxs.drain()
+}
+
+// TxPoolContent returns the transactions waiting to be sequenced and those
+// held waiting for an earlier nonce
+func (b *SequencerBatcher) TxPoolContent() *TxPoolContent {
+	return &TxPoolContent{
+		Pending: b.txQueue.contents(),
+		Queued:  b.heldTxs.contents(),
+	}
 }
 
 func (b *SequencerBatcher) PendingSnapshot(_ context.Context) (*snapshot.Snapshot, error) {
@@ -675,6 +863,10 @@ func (b *SequencerBatcher) deliverDelayedMessages(ctx context.Context, chainTime
 
 	core.WaitForMachineIdle(b.db)
 
+	err = b.journalItems(msgCount, prevAcc, seqBatchItems)
+	if err != nil {
+		return false, err
+	}
 	if b.feedBroadcaster != nil {
 		err = b.feedBroadcaster.Broadcast(prevAcc, seqBatchItems, b.dataSigner)
 		if err != nil {
@@ -706,8 +898,8 @@ const maxL1BackwardsReorg int64 = 12
 
 // Updates both prevMsgCount and nonce on success
 func (b *SequencerBatcher) publishBatch(ctx context.Context, dontPublishBlockNum *big.Int, prevMsgCount *big.Int, nonce *big.Int) (bool, error) {
-	if b.config.Node.Sequencer.Dangerous.DisableBatchPosting {
-		return true, nil
+	if !b.BatchPostingEnabled() {
+		return false, errBatchPostingDisabled
 	}
 
 	b.inboxReader.MessageDeliveryMutex.Lock()
@@ -971,6 +1163,8 @@ func (b *SequencerBatcher) publishBatch(ctx context.Context, dontPublishBlockNum
 			}
 		}
 
+		b.trimJournal(newMsgCount)
+
 		if b.feedBroadcaster != nil {
 			// Confirm feed messages that are already on chain
 			b.feedBroadcaster.ConfirmedAccumulator(lastAcc)
@@ -1042,7 +1236,7 @@ func (b *SequencerBatcher) reorgAndModifySequencerMessages(ctx context.Context,
 		return err
 	}
 
-	return nil
+	return b.rejournalFrom(prevMsgCount, previousSeqBatchAcc)
 }
 
 func (b *SequencerBatcher) reorgToNewTimestamp(ctx context.Context, prevMsgCount *big.Int, newChainTime inbox.ChainTime) error {
@@ -1086,7 +1280,7 @@ func (b *SequencerBatcher) reorgOutHugeMsg(ctx context.Context, prevMsgCount *bi
 		return err
 	}
 
-	return nil
+	return b.rejournalFrom(prevMsgCount, previousSeqBatchAcc)
 }
 
 func (b *SequencerBatcher) getLastSequencedChainTime() (inbox.ChainTime, error) {
@@ -1118,6 +1312,93 @@ func (b *SequencerBatcher) getLastSequencedChainTime() (inbox.ChainTime, error)
 
 var parallelPublishingBatches int32 = 8
 
+// PauseSequencing makes SendTransaction reject user transactions until
+// ResumeSequencing is called. Delayed messages are still sequenced
+func (b *SequencerBatcher) PauseSequencing() {
+	atomic.StoreInt32(&b.pausedAtomic, 1)
+}
+
+func (b *SequencerBatcher) ResumeSequencing() {
+	atomic.StoreInt32(&b.pausedAtomic, 0)
+}
+
+func (b *SequencerBatcher) SequencingPaused() bool {
+	return atomic.LoadInt32(&b.pausedAtomic) != 0
+}
+
+func (b *SequencerBatcher) SetBatchPostingEnabled(enabled bool) {
+	disabled := int32(1)
+	if enabled {
+		disabled = 0
+	}
+	atomic.StoreInt32(&b.batchPostingDisabledAtomic, disabled)
+}
+
+func (b *SequencerBatcher) BatchPostingEnabled() bool {
+	return atomic.LoadInt32(&b.batchPostingDisabledAtomic) == 0
+}
+
+// ForceBatch makes the batch thread create a batch at its next check,
+// ignoring the batch interval and the high gas price delay
+func (b *SequencerBatcher) ForceBatch() {
+	atomic.StoreInt32(&b.forceBatchAtomic, 1)
+}
+
+func (b *SequencerBatcher) BatchForced() bool {
+	return atomic.LoadInt32(&b.forceBatchAtomic) != 0
+}
+
+// QueueDepth returns the number of transactions waiting to be checked or
+// sequenced and the number held waiting for an earlier nonce
+func (b *SequencerBatcher) QueueDepth() (int, int) {
+	return int(atomic.LoadInt64(&b.pendingTxsAtomic)), b.heldTxs.len()
+}
+
+func (b *SequencerBatcher) PendingBatchGasEstimate() int64 {
+	return atomic.LoadInt64(&b.pendingBatchGasEstimateAtomic)
+}
+
+// BatchesPosted returns true if every sequenced message is in a batch that
+// has been included on L1. It doesn't acquire the MessageDeliveryMutex, so
+// the caller should hold it if nothing may be sequenced in the meantime
+func (b *SequencerBatcher) BatchesPosted(ctx context.Context) (bool, error) {
+	if atomic.LoadInt32(&b.publishingBatchesAtomic) != 0 {
+		return false, nil
+	}
+	msgCount, err := b.db.GetMessageCount()
+	if err != nil {
+		return false, err
+	}
+	postedCount, err := b.sequencerInbox.MessageCount(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return false, err
+	}
+	return postedCount.Cmp(msgCount) >= 0, nil
+}
+
+// WaitForBatchesPosted forces batches to be created until everything
+// sequenced so far has been posted to L1
+func (b *SequencerBatcher) WaitForBatchesPosted(ctx context.Context) error {
+	for {
+		if !b.BatchPostingEnabled() {
+			return errBatchPostingDisabled
+		}
+		posted, err := b.BatchesPosted(ctx)
+		if err != nil {
+			logger.Warn().Err(err).Msg("error checking if batches are posted")
+		} else if posted {
+			return nil
+		} else if atomic.LoadInt32(&b.publishingBatchesAtomic) == 0 {
+			b.ForceBatch()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.chainTimeCheckInterval):
+		}
+	}
+}
+
 func (b *SequencerBatcher) Start(ctx context.Context) {
 	logger.Log().Msg("Starting sequencer batch submission thread")
 	firstBatchCreation := true
@@ -1171,7 +1452,7 @@ MainLoop:
 				Str("newBlockNumber", newChainTime.BlockNum.String()).
 				Msg("chain time moved backwards")
 			continue
-		} else if chainTimeCmp == 0 {
+		} else if chainTimeCmp == 0 && atomic.LoadInt32(&b.forceBatchAtomic) == 0 {
 			// Chain time hasn't changed
 			continue
 		}
@@ -1181,33 +1462,57 @@ MainLoop:
 		// Determine if we should create a batch
 		shouldSequence := b.LockoutManager == nil || b.LockoutManager.ShouldSequence()
 		targetCreateBatch := new(big.Int).Add(b.lastCreatedBatchAt, b.createBatchBlockInterval)
-		creatingBatch := blockNum.Cmp(targetCreateBatch) >= 0 || firstBatchCreation
+		forceBatch := atomic.LoadInt32(&b.forceBatchAtomic) != 0
+		creatingBatch := blockNum.Cmp(targetCreateBatch) >= 0 || firstBatchCreation || forceBatch
 		onlyCreateFullBatches := false
-		if !creatingBatch && atomic.LoadInt64(&b.pendingBatchGasEstimateAtomic) >= batchFullThreshold {
+		backlogGas := atomic.LoadInt64(&b.pendingBatchGasEstimateAtomic)
+		if !creatingBatch && backlogGas >= batchFullThreshold {
 			creatingBatch = true
 			onlyCreateFullBatches = true
 		}
+		var firstUnpostedAt *big.Int
+		if backlogGas > int64(gasCostBase) {
+			firstUnpostedAt, err = b.firstUnpostedBlock(ctx, blockNum)
+			if err != nil {
+				// Fall back to measuring from the last batch
+				logger.Warn().Err(err).Msg("error finding first unposted message")
+				firstUnpostedAt = b.lastCreatedBatchAt
+			}
+		}
+		if !creatingBatch && b.postingPolicy.urgent(blockNum, firstUnpostedAt) {
+			// Post before the batch interval so we don't come close to the max delay
+			creatingBatch = true
+			batchPostingUrgentCounter.Inc(1)
+		}
 		if creatingBatch && !shouldSequence && !b.config.Node.Sequencer.Dangerous.PublishBatchesWithoutLockout {
 			// We don't have the lockout and publishing batches without the lockout is disabled
 			creatingBatch = false
 		}
+		if creatingBatch && !b.BatchPostingEnabled() {
+			// Batch posting has been disabled by an operator
+			creatingBatch = false
+		}
 		if creatingBatch && atomic.LoadInt32(&b.publishingBatchesAtomic) >= parallelPublishingBatches {
 			// The previous batch is still waiting on confirmation; don't attempt to create another yet
 			creatingBatch = false
 		}
-		if creatingBatch && blockNum.Cmp(new(big.Int).Add(targetCreateBatch, big.NewInt(b.config.Node.Sequencer.L1PostingStrategy.HighGasDelayBlocks))) < 0 {
-			// Check if gas price is too high, and if so, hold off on creating a batch
-			gasPrice, err := b.client.SuggestGasPrice(ctx)
+		var baseFee *big.Int
+		if creatingBatch {
+			baseFee, err = l1BaseFee(ctx, b.client)
 			if err != nil {
-				logger.Warn().Err(err).Msg("error getting gas price")
-			} else {
-				gasPriceFloat := float64(gasPrice.Int64()) / 1e9
-				if gasPriceFloat >= b.config.Node.Sequencer.L1PostingStrategy.HighGasThreshold {
-					logger.Info().Float64("gasPrice", gasPriceFloat).Float64("highGasPriceConfig", b.config.Node.Sequencer.L1PostingStrategy.HighGasThreshold).Msg("not posting batch yet as gas price is high")
-					creatingBatch = false
-				}
+				logger.Warn().Err(err).Msg("error getting L1 base fee")
+				baseFee = nil
 			}
 		}
+		if creatingBatch && !forceBatch && b.postingPolicy.shouldDelay(blockNum, targetCreateBatch, firstUnpostedAt, backlogGas, baseFee) {
+			// Hold off on posting a small batch while L1 gas is expensive
+			logger.Info().
+				Str("baseFee", baseFee.String()).
+				Float64("highGasPriceConfig", b.config.Node.Sequencer.L1PostingStrategy.HighGasThreshold).
+				Int64("backlogGas", backlogGas).
+				Msg("not posting batch yet as gas price is high")
+			creatingBatch = false
+		}
 
 		// Maybe sequence delayed messages
 		sequencedDelayed := false
@@ -1261,7 +1566,10 @@ MainLoop:
 			for atomic.LoadInt32(&b.publishingBatchesAtomic) < parallelPublishingBatches {
 				// Updates both prevMsgCount and nonce on success
 				complete, err := b.publishBatch(ctx, dontPublishBlockNum, prevMsgCount, nonce)
-				if err != nil {
+				if err == errBatchPostingDisabled {
+					// Disabled while we were posting, nothing was posted
+					break
+				} else if err != nil {
 					if common.IsFatalError(err) {
 						logger.Error().Err(err).Msg("aborting sequencer batch thread")
 						break MainLoop
@@ -1270,7 +1578,12 @@ MainLoop:
 					logger.Error().Err(err).Msg("error creating batch")
 					break
 				} else if complete {
+					saved := b.postingPolicy.batchPosted(backlogGas, baseFee)
+					if saved.Sign() > 0 {
+						logger.Info().Str("savedWei", saved.String()).Msg("posted batch delayed for high gas")
+					}
 					b.lastCreatedBatchAt = blockNum
+					atomic.StoreInt32(&b.forceBatchAtomic, 0)
 					firstBatchCreation = false
 					break
 				}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+func TestSequencerControls(t *testing.T) {
+	txQueue, err := newSequencerQueue(FIFOOrdering, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &SequencerBatcher{
+		config:  &configuration.Config{},
+		signer:  types.NewEIP155Signer(big.NewInt(1)),
+		txQueue: txQueue,
+		heldTxs: newHoldingPool(configuration.HoldingPool{}),
+	}
+
+	b.PauseSequencing()
+	if !b.SequencingPaused() {
+		t.Error("expected sequencing to be paused")
+	}
+	if err := b.SendTransaction(context.Background(), types.NewTx(&types.LegacyTx{})); err == nil {
+		t.Error("expected paused sequencer to reject transaction")
+	}
+	if queued, held := b.QueueDepth(); queued != 0 || held != 0 {
+		t.Error("paused sequencer queued transaction")
+	}
+	b.ResumeSequencing()
+	if b.SequencingPaused() {
+		t.Error("expected sequencing to be resumed")
+	}
+
+	if !b.BatchPostingEnabled() {
+		t.Error("expected batch posting to be enabled by default")
+	}
+	b.SetBatchPostingEnabled(false)
+	if b.BatchPostingEnabled() {
+		t.Error("expected batch posting to be disabled")
+	}
+	complete, err := b.publishBatch(context.Background(), nil, big.NewInt(0), big.NewInt(0))
+	if err != errBatchPostingDisabled || complete {
+		t.Error("expected publishing to fail while batch posting is disabled")
+	}
+
+	b.ForceBatch()
+	if !b.BatchForced() {
+		t.Error("expected batch to be forced")
+	}
+}
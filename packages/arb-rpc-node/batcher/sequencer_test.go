@@ -19,8 +19,11 @@ package batcher
 import (
 	"context"
 	"crypto/ecdsa"
+	"fmt"
 	"math/big"
 	"math/rand"
+	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -48,7 +51,7 @@ import (
 )
 
 func deployRollup(
-	t *testing.T,
+	t testing.TB,
 	auth *bind.TransactOpts,
 	client *ethutils.SimulatedEthClient,
 	machineHash [32]byte,
@@ -99,7 +102,7 @@ func deployRollup(
 	return createEv.RollupAddress, createEv.Inbox, receipt.BlockNumber
 }
 
-func generateTxs(t *testing.T, totalCount int, dataSizePerTx int, chainId *big.Int) []*types.Transaction {
+func generateTxs(t testing.TB, totalCount int, dataSizePerTx int, chainId *big.Int) []*types.Transaction {
 	rand.Seed(4537345)
 	signer := types.NewEIP155Signer(chainId)
 	randomKeys := make([]*ecdsa.PrivateKey, 0, 10)
@@ -128,10 +131,22 @@ func generateTxs(t *testing.T, totalCount int, dataSizePerTx int, chainId *big.I
 	return txes
 }
 
-func TestSequencerBatcher(t *testing.T) {
-	zerolog.SetGlobalLevel(zerolog.WarnLevel)
-	defer zerolog.SetGlobalLevel(zerolog.InfoLevel)
+// sequencerTestChain is a rollup on a simulated L1 with a sequencer and a
+// second node following the sequencer's inbox
+type sequencerTestChain struct {
+	client       *ethutils.SimulatedEthClient
+	l2ChainId    *big.Int
+	seqMon       *monitor.Monitor
+	otherMon     *monitor.Monitor
+	seqInbox     *ethbridgecontracts.SequencerInbox
+	delayedInbox *ethbridge.StandardInbox
+	batcher      *SequencerBatcher
+}
 
+// newSequencerTestChain deploys a rollup and starts its sequencer, returning
+// once the sequencer has posted its first batch. The sequencer runs until the
+// returned shutdown function is called
+func newSequencerTestChain(t testing.TB, config configuration.Config) (*sequencerTestChain, context.Context, func()) {
 	arbosPath, err := arbos.Path(false)
 	test.FailIfError(t, err)
 
@@ -180,22 +195,25 @@ func TestSequencerBatcher(t *testing.T) {
 	gasRefunderAddr, _, _, err := ethbridgecontracts.DeployGasRefunder(auth, clnt)
 	test.FailIfError(t, err)
 
-	config := configuration.Config{
-		Node: *configuration.DefaultNodeSettings(),
-	}
 	config.Node.Sequencer.GasRefunderAddress = gasRefunderAddr.String()
 
 	bridgeUtilsAddr, _, _, err := ethbridgecontracts.DeployBridgeUtils(auth, client)
 	test.FailIfError(t, err)
 
 	seqMon, shutdown := monitor.PrepareArbCore(t)
-	defer shutdown()
-
 	otherMon, shutdown2 := monitor.PrepareArbCore(t)
-	defer shutdown2()
-
 	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	returning := false
+	shutdownAll := func() {
+		cancel()
+		shutdown2()
+		shutdown()
+	}
+	defer func() {
+		if !returning {
+			shutdownAll()
+		}
+	}()
 
 	rollup, err := ethbridge.NewRollupWatcher(rollupAddr, rollupBlock.Int64(), client, bind.CallOpts{})
 	test.FailIfError(t, err)
@@ -255,6 +273,7 @@ func TestSequencerBatcher(t *testing.T) {
 		auth,
 		dummyDataSigner,
 		nil,
+		nil,
 		&config,
 		&config.Wallet,
 	)
@@ -297,6 +316,35 @@ func TestSequencerBatcher(t *testing.T) {
 		}
 	}
 
+	returning = true
+	return &sequencerTestChain{
+		client:       client,
+		l2ChainId:    l2ChainId,
+		seqMon:       seqMon,
+		otherMon:     otherMon,
+		seqInbox:     seqInbox,
+		delayedInbox: delayedInbox,
+		batcher:      batcher,
+	}, ctx, shutdownAll
+}
+
+func TestSequencerBatcher(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	defer zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	config := configuration.Config{
+		Node: *configuration.DefaultNodeSettings(),
+	}
+	chain, ctx, shutdown := newSequencerTestChain(t, config)
+	defer shutdown()
+	client := chain.client
+	l2ChainId := chain.l2ChainId
+	seqMon := chain.seqMon
+	otherMon := chain.otherMon
+	seqInbox := chain.seqInbox
+	delayedInbox := chain.delayedInbox
+	batcher := chain.batcher
+
 	txs := generateTxs(t, 10, 10, l2ChainId)
 	totalDelayedCount := big.NewInt(1)
 	for i, tx := range txs {
@@ -309,7 +357,7 @@ func TestSequencerBatcher(t *testing.T) {
 		}
 		errors := 0
 		for j := 0; j < dupTxCount; j++ {
-			err = <-results
+			err := <-results
 			if err != nil {
 				if err.Error() != "already known" && err.Error() != "invalid transaction nonce" {
 					t.Fatal("unexpected error from sequencer:", err)
@@ -331,7 +379,7 @@ func TestSequencerBatcher(t *testing.T) {
 		}
 		totalDelayedCount.Add(totalDelayedCount, big.NewInt(int64(delayedCount)))
 		for i := 0; i < delayedCount; i++ {
-			_, err = delayedInbox.SendL2MessageFromOrigin(ctx, []byte{})
+			_, err := delayedInbox.SendL2MessageFromOrigin(ctx, []byte{})
 			test.FailIfError(t, err)
 		}
 		client.Commit()
@@ -388,3 +436,46 @@ func TestSequencerBatcher(t *testing.T) {
 		t.Fatal("accumulators differ between monitors")
 	}
 }
+
+// BenchmarkSequencerBatcherSendTransaction measures concurrent SendTransaction
+// calls through the whole sequencer, from checking each transaction to
+// executing its block. With a single intake worker transactions are checked
+// one at a time, which shows what checking them in parallel buys
+func BenchmarkSequencerBatcherSendTransaction(b *testing.B) {
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	defer zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	for _, workers := range []int{1, runtime.NumCPU()} {
+		config := configuration.Config{
+			Node: *configuration.DefaultNodeSettings(),
+		}
+		config.Node.Sequencer.Intake.Workers = workers
+		chain, ctx, shutdown := newSequencerTestChain(b, config)
+		signer := types.NewEIP155Signer(chain.l2ChainId)
+		b.Run(fmt.Sprintf("workers-%v", workers), func(b *testing.B) {
+			// Each transaction has its own sender so that they can be sent in
+			// any order
+			txs := make([]*types.Transaction, 0, b.N)
+			for i := 0; i < b.N; i++ {
+				key, err := crypto.GenerateKey()
+				test.FailIfError(b, err)
+				tx := types.NewTransaction(0, ethcommon.Address{6}, big.NewInt(0), 1000, big.NewInt(10), nil)
+				signedTx, err := types.SignTx(tx, signer, key)
+				test.FailIfError(b, err)
+				txs = append(txs, signedTx)
+			}
+			next := int64(-1)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					tx := txs[atomic.AddInt64(&next, 1)]
+					if err := chain.batcher.SendTransaction(ctx, tx); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+		shutdown()
+	}
+}
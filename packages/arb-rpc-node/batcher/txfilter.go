@@ -0,0 +1,233 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+// TxRejectedErrorCode is the JSON-RPC error code returned for transactions
+// rejected by a TxFilter, matching the "transaction rejected" code of EIP-1474
+const TxRejectedErrorCode = -32003
+
+// TxRejectedError is returned by SendTransaction when a TxFilter rejects
+// the transaction
+type TxRejectedError struct {
+	reason string
+}
+
+func NewTxRejectedError(reason string) *TxRejectedError {
+	return &TxRejectedError{reason: reason}
+}
+
+func (e *TxRejectedError) Error() string {
+	return "transaction rejected: " + e.reason
+}
+
+func (e *TxRejectedError) ErrorCode() int {
+	return TxRejectedErrorCode
+}
+
+// TxFilter is consulted by the batchers before accepting a transaction
+type TxFilter interface {
+	// FilterTransaction returns a TxRejectedError if tx must not be accepted
+	FilterTransaction(ctx context.Context, tx *types.Transaction, sender ethcommon.Address) error
+}
+
+type denyListEntries struct {
+	addresses map[ethcommon.Address]struct{}
+	selectors map[[4]byte]struct{}
+}
+
+// DenyList is a TxFilter rejecting transactions from or to listed addresses
+// and calls to listed 4-byte function selectors. The list is read from a
+// file with one 0x-prefixed address or selector per line, with # starting a
+// comment, and is reloaded when the file changes
+type DenyList struct {
+	path           string
+	reloadInterval time.Duration
+
+	mutex      sync.RWMutex
+	entries    *denyListEntries
+	modTime    time.Time
+	lastCheck  time.Time
+	reloadLock sync.Mutex
+}
+
+// NewTxFilterFromConfig returns nil if no deny list file is configured
+func NewTxFilterFromConfig(config configuration.TxFilter) (TxFilter, error) {
+	if len(config.DenyListFile) == 0 {
+		return nil, nil
+	}
+	denyList, err := NewDenyList(config.DenyListFile, config.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	return denyList, nil
+}
+
+func NewDenyList(path string, reloadInterval time.Duration) (*DenyList, error) {
+	d := &DenyList{path: path, reloadInterval: reloadInterval}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readDenyList(path)
+	if err != nil {
+		return nil, err
+	}
+	d.entries = entries
+	d.modTime = info.ModTime()
+	d.lastCheck = time.Now()
+	logger.Info().
+		Str("path", path).
+		Int("addresses", len(entries.addresses)).
+		Int("selectors", len(entries.selectors)).
+		Msg("loaded transaction deny list")
+	return d, nil
+}
+
+func readDenyList(path string) (*denyListEntries, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries := &denyListEntries{
+		addresses: make(map[ethcommon.Address]struct{}),
+		selectors: make(map[[4]byte]struct{}),
+	}
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		data, err := hexutil.Decode(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid deny list entry on line %v", lineNum)
+		}
+		switch len(data) {
+		case ethcommon.AddressLength:
+			entries.addresses[ethcommon.BytesToAddress(data)] = struct{}{}
+		case 4:
+			var selector [4]byte
+			copy(selector[:], data)
+			entries.selectors[selector] = struct{}{}
+		default:
+			return nil, errors.Errorf("deny list entry on line %v is neither an address nor a selector", lineNum)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// maybeReload rereads the file if it changed since it was last read. If the
+// new file is invalid, the previous list stays in effect
+func (d *DenyList) maybeReload() {
+	if d.reloadInterval <= 0 {
+		return
+	}
+	d.reloadLock.Lock()
+	defer d.reloadLock.Unlock()
+	if time.Since(d.lastCheck) < d.reloadInterval {
+		return
+	}
+	d.lastCheck = time.Now()
+	info, err := os.Stat(d.path)
+	if err != nil {
+		logger.Warn().Err(err).Str("path", d.path).Msg("error checking deny list")
+		return
+	}
+	if info.ModTime().Equal(d.modTime) {
+		return
+	}
+	entries, err := readDenyList(d.path)
+	if err != nil {
+		logger.Error().Err(err).Str("path", d.path).Msg("error reloading deny list, keeping previous list")
+		return
+	}
+	d.mutex.Lock()
+	d.entries = entries
+	d.modTime = info.ModTime()
+	d.mutex.Unlock()
+	logger.Info().
+		Str("path", d.path).
+		Int("addresses", len(entries.addresses)).
+		Int("selectors", len(entries.selectors)).
+		Msg("reloaded transaction deny list")
+}
+
+func (d *DenyList) FilterTransaction(_ context.Context, tx *types.Transaction, sender ethcommon.Address) error {
+	d.maybeReload()
+	d.mutex.RLock()
+	entries := d.entries
+	d.mutex.RUnlock()
+
+	if _, ok := entries.addresses[sender]; ok {
+		return NewTxRejectedError("sender is not permitted")
+	}
+	if tx.To() != nil {
+		if _, ok := entries.addresses[*tx.To()]; ok {
+			return NewTxRejectedError("destination is not permitted")
+		}
+	}
+	if len(tx.Data()) >= 4 {
+		var selector [4]byte
+		copy(selector[:], tx.Data()[:4])
+		if _, ok := entries.selectors[selector]; ok {
+			return NewTxRejectedError("function is not permitted")
+		}
+	}
+	return nil
+}
+
+// filterTransaction applies filter if it's set, logging rejections
+func filterTransaction(ctx context.Context, filter TxFilter, tx *types.Transaction, sender ethcommon.Address) error {
+	if filter == nil {
+		return nil
+	}
+	if err := filter.FilterTransaction(ctx, tx, sender); err != nil {
+		logger.Info().
+			Err(err).
+			Str("hash", tx.Hash().String()).
+			Str("sender", sender.Hex()).
+			Msg("transaction filtered")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+func TestDenyList(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "denylist")
+	badSender := ethcommon.HexToAddress("0x1000000000000000000000000000000000000001")
+	badContract := ethcommon.HexToAddress("0x2000000000000000000000000000000000000002")
+	goodAddress := ethcommon.HexToAddress("0x3000000000000000000000000000000000000003")
+	list := "# sanctioned\n" + badSender.Hex() + "\n" + badContract.Hex() + " # contract\n0xa9059cbb\n"
+	if err := ioutil.WriteFile(path, []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	denyList, err := NewDenyList(path, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	makeTx := func(to ethcommon.Address, data []byte) *types.Transaction {
+		return types.NewTx(&types.LegacyTx{To: &to, Value: big.NewInt(0), Data: data})
+	}
+	checkRejected := func(err error, rejected bool) {
+		t.Helper()
+		var rejectedErr *TxRejectedError
+		if errors.As(err, &rejectedErr) != rejected {
+			t.Error("unexpected filter result", err)
+		}
+		if rejected && rejectedErr.ErrorCode() != TxRejectedErrorCode {
+			t.Error("wrong error code", rejectedErr.ErrorCode())
+		}
+	}
+
+	checkRejected(denyList.FilterTransaction(ctx, makeTx(goodAddress, nil), badSender), true)
+	checkRejected(denyList.FilterTransaction(ctx, makeTx(badContract, nil), goodAddress), true)
+	checkRejected(denyList.FilterTransaction(ctx, makeTx(goodAddress, []byte{0xa9, 0x05, 0x9c, 0xbb, 0}), goodAddress), true)
+	checkRejected(denyList.FilterTransaction(ctx, makeTx(goodAddress, []byte{0xa9, 0x05}), goodAddress), false)
+	checkRejected(denyList.FilterTransaction(ctx, makeTx(goodAddress, nil), goodAddress), false)
+
+	// An invalid file leaves the previous list in effect
+	time.Sleep(10 * time.Millisecond)
+	if err := ioutil.WriteFile(path, []byte("not an address\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	checkRejected(denyList.FilterTransaction(ctx, makeTx(goodAddress, nil), badSender), true)
+
+	// A valid change is picked up
+	if err := ioutil.WriteFile(path, []byte(goodAddress.Hex()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime = modTime.Add(time.Second)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	checkRejected(denyList.FilterTransaction(ctx, makeTx(badContract, nil), goodAddress), true)
+	checkRejected(denyList.FilterTransaction(ctx, makeTx(badContract, nil), badSender), false)
+
+	filter, err := NewTxFilterFromConfig(configuration.TxFilter{})
+	if err != nil || filter != nil {
+		t.Error("expected no filter without a deny list file")
+	}
+}
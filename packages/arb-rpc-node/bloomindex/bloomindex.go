@@ -0,0 +1,277 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bloomindex
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/core/bloombits"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+// The same parameters go-ethereum uses for its own bloombits
+const (
+	DefaultSectionSize = params.BloomBitsBlocks
+
+	// Number of goroutines used to service bloombits lookups
+	bloomServiceThreads = 16
+
+	// Number of bloombits retrievals batched together by a matcher session
+	bloomRetrievalBatch = 16
+
+	// Maximum time a matcher session waits to fill a batch
+	bloomRetrievalWait = time.Duration(0)
+
+	// Number of matcher goroutines multiplexing each filter session
+	bloomFilterThreads = 3
+)
+
+var (
+	sectionSizeKey    = []byte("z")
+	sectionCountKey   = []byte("s")
+	sectionHeadPrefix = []byte("h")
+)
+
+// Index builds bloombits sections of sectionSize blocks for the L2 chain so
+// that go-ethereum's log filters don't need to check every header's bloom.
+// Sections are built in the background as the TxDB adds blocks and dropped
+// when the blocks they cover are reorged
+type Index struct {
+	db          ethdb.Database
+	sectionSize uint64
+	driver      *txdb.IndexDriver
+
+	bloomRequests chan chan *bloombits.Retrieval
+}
+
+// builder builds bloombits sections for the index's driver
+type builder struct {
+	txDB        *txdb.TxDB
+	db          ethdb.Database
+	sectionSize uint64
+}
+
+// New opens the index stored at path. sectionSize must be a multiple of 8,
+// and if it differs from the size the index was built with, the index is
+// rebuilt from scratch
+func New(txDB *txdb.TxDB, path string, sectionSize uint64) (*Index, error) {
+	if sectionSize == 0 || sectionSize%8 != 0 {
+		return nil, errors.Errorf("invalid bloombits section size %v", sectionSize)
+	}
+	db, err := rawdb.NewLevelDBDatabase(path, 0, 0, "", false)
+	if err != nil {
+		return nil, err
+	}
+	sections := uint64(0)
+	data, err := db.Get(sectionSizeKey)
+	if err == nil && len(data) == 8 && binary.BigEndian.Uint64(data) == sectionSize {
+		data, err = db.Get(sectionCountKey)
+		if err == nil && len(data) == 8 {
+			sections = binary.BigEndian.Uint64(data)
+		}
+	} else {
+		batch := db.NewBatch()
+		if err := batch.Put(sectionSizeKey, encodeUint64(sectionSize)); err != nil {
+			db.Close()
+			return nil, err
+		}
+		if err := batch.Put(sectionCountKey, encodeUint64(0)); err != nil {
+			db.Close()
+			return nil, err
+		}
+		if err := batch.Write(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	b := &builder{
+		txDB:        txDB,
+		db:          db,
+		sectionSize: sectionSize,
+	}
+	return &Index{
+		db:            db,
+		sectionSize:   sectionSize,
+		driver:        txdb.NewIndexDriver(txDB, b, db, "bloombits", sections),
+		bloomRequests: make(chan chan *bloombits.Retrieval),
+	}, nil
+}
+
+func encodeUint64(val uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, val)
+	return data
+}
+
+func sectionHeadKey(section uint64) []byte {
+	return append(append([]byte{}, sectionHeadPrefix...), encodeUint64(section)...)
+}
+
+// sectionHead returns the hash of the last block in the section, which the
+// section's bloombits are stored under
+func sectionHead(db ethdb.Database, section uint64) (common.Hash, error) {
+	data, err := db.Get(sectionHeadKey(section))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(data), nil
+}
+
+// Status returns the section size and the number of sections that have been
+// built, matching the BloomStatus method of go-ethereum's filter backend
+func (i *Index) Status() (uint64, uint64) {
+	return i.sectionSize, i.driver.Next()
+}
+
+func (i *Index) AddBlock(*machine.BlockInfo, *evm.BlockInfo, []*evm.TxResult) error {
+	i.driver.Notify()
+	return nil
+}
+
+func (i *Index) Reorg(height uint64) error {
+	return i.driver.Reorg(height)
+}
+
+func (b *builder) UnitsAvailable(blockCount uint64) uint64 {
+	return blockCount / b.sectionSize
+}
+
+func (b *builder) ReorgUnit(height uint64) uint64 {
+	return height / b.sectionSize
+}
+
+func (b *builder) Truncate(start, _ uint64) error {
+	// Bits of dropped sections are keyed by their head so they will simply
+	// be overwritten or ignored once the sections are rebuilt
+	return b.db.Put(sectionCountKey, encodeUint64(start))
+}
+
+func (b *builder) Valid(section uint64) (bool, error) {
+	head, err := sectionHead(b.db, section)
+	if err != nil {
+		return false, nil
+	}
+	block, err := b.txDB.GetBlock((section+1)*b.sectionSize - 1)
+	if err != nil {
+		return false, err
+	}
+	return block != nil && block.Header.Hash() == head, nil
+}
+
+func (b *builder) Build(section uint64) (func() error, error) {
+	gen, err := bloombits.NewGenerator(uint(b.sectionSize))
+	if err != nil {
+		return nil, err
+	}
+	var head common.Hash
+	start := section * b.sectionSize
+	for height := start; height < start+b.sectionSize; height++ {
+		block, err := b.txDB.GetBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, errors.Errorf("block %v not found", height)
+		}
+		if err := gen.AddBloom(uint(height-start), block.Header.Bloom); err != nil {
+			return nil, err
+		}
+		head = block.Header.Hash()
+	}
+
+	return func() error {
+		batch := b.db.NewBatch()
+		for bit := uint(0); bit < types.BloomBitLength; bit++ {
+			bits, err := gen.Bitset(bit)
+			if err != nil {
+				return err
+			}
+			rawdb.WriteBloomBits(batch, bit, section, head, bitutil.CompressBytes(bits))
+		}
+		if err := batch.Put(sectionHeadKey(section), head.Bytes()); err != nil {
+			return err
+		}
+		if err := batch.Put(sectionCountKey, encodeUint64(section+1)); err != nil {
+			return err
+		}
+		return batch.Write()
+	}, nil
+}
+
+func (i *Index) retrieve(task *bloombits.Retrieval) {
+	task.Bitsets = make([][]byte, len(task.Sections))
+	for j, section := range task.Sections {
+		head, err := sectionHead(i.db, section)
+		if err != nil {
+			task.Error = err
+			continue
+		}
+		compressed, err := rawdb.ReadBloomBits(i.db, task.Bit, section, head)
+		if err != nil {
+			task.Error = err
+			continue
+		}
+		blob, err := bitutil.DecompressBytes(compressed, int(i.sectionSize/8))
+		if err != nil {
+			task.Error = err
+			continue
+		}
+		task.Bitsets[j] = blob
+	}
+}
+
+func (i *Index) serviceThread(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case request := <-i.bloomRequests:
+			task := <-request
+			i.retrieve(task)
+			request <- task
+		}
+	}
+}
+
+// ServiceFilter starts serving bloombits lookups for a filter session
+func (i *Index) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
+	for j := 0; j < bloomFilterThreads; j++ {
+		go session.Multiplex(bloomRetrievalBatch, bloomRetrievalWait, i.bloomRequests)
+	}
+}
+
+func (i *Index) Start(ctx context.Context) error {
+	if err := i.driver.Start(ctx, i); err != nil {
+		return err
+	}
+	for j := 0; j < bloomServiceThreads; j++ {
+		go i.serviceThread(ctx)
+	}
+	return nil
+}
@@ -44,6 +44,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/aggregator"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/dev"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/rpc"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
@@ -340,6 +341,11 @@ func startup() error {
 	if err != nil {
 		return err
 	}
+	if seqBatcher, ok := batch.(*batcher.SequencerBatcher); ok {
+		if err := seqBatcher.ReplayJournal(ctx); err != nil {
+			return errors.Wrap(err, "error replaying sequencer journal")
+		}
+	}
 
 	srv := aggregator.NewServer(batch, l2ChainId, db)
 
@@ -26,9 +26,11 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
@@ -51,10 +53,13 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/metrics"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/nodehealth"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/addressindex"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/aggregator"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/bloomindex"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/nitroexport"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/rpc"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/traceindex"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcastclient"
@@ -122,8 +127,8 @@ func startup() error {
 	config, walletConfig, l1Client, l1ChainId, err := configuration.ParseNode(ctx)
 	if err != nil || len(config.Persistent.GlobalConfig) == 0 || len(config.L1.URL) == 0 ||
 		len(config.Rollup.Address) == 0 || len(config.BridgeUtilsAddress) == 0 ||
-		((config.Node.Type() != configuration.SequencerNodeType) && len(config.Node.Sequencer.Lockout.Redis) != 0) ||
-		((len(config.Node.Sequencer.Lockout.Redis) == 0) != (len(config.Node.Sequencer.Lockout.SelfRPCURL) == 0)) {
+		((config.Node.Type() != configuration.SequencerNodeType) && config.Node.Sequencer.Lockout.Enabled()) ||
+		(!config.Node.Sequencer.Lockout.Enabled() != (len(config.Node.Sequencer.Lockout.SelfRPCURL) == 0)) {
 		printSampleUsage()
 		if err != nil && !strings.Contains(err.Error(), "help requested") {
 			fmt.Printf("\n%s\n", err.Error())
@@ -413,6 +418,7 @@ func startup() error {
 	}
 
 	var batch batcher.TransactionBatcher
+	var seqBatcher *batcher.SequencerBatcher
 	var broadcasterErrChan chan error
 	errChan := make(chan error, 1)
 	if config.Node.Forwarder.Target != "" {
@@ -431,13 +437,18 @@ func startup() error {
 			)
 			lockoutConf := config.Node.Sequencer.Lockout
 			if err == nil {
-				seqBatcher, ok := batch.(*batcher.SequencerBatcher)
-				if lockoutConf.Redis != "" {
-					// Setup the lockout. This will take care of the initial delayed sequence.
+				var ok bool
+				seqBatcher, ok = batch.(*batcher.SequencerBatcher)
+				if lockoutConf.Enabled() {
+					// Setup the lockout. This will take care of replaying the journal
+					// and the initial delayed sequence once the lockout is acquired.
 					batch, err = rpc.SetupLockout(ctx, seqBatcher, mon.Core, inboxReader, lockoutConf, errChan)
 				} else if ok {
-					// Ensure we sequence delayed messages before opening the RPC.
-					err = seqBatcher.SequenceDelayedMessages(ctx, false)
+					// Ensure we replay the journal and sequence delayed messages before opening the RPC.
+					err = seqBatcher.ReplayJournal(ctx)
+					if err == nil {
+						err = seqBatcher.SequenceDelayedMessages(ctx, false)
+					}
 				}
 			}
 			if err == nil {
@@ -458,6 +469,23 @@ func startup() error {
 		}
 	}
 
+	lockoutBatcher, _ := batch.(*rpc.LockoutBatcher)
+	if lockoutBatcher != nil {
+		go handoverOnSignal(ctx, lockoutBatcher)
+	}
+
+	if config.Node.Sequencer.Admin.Enable {
+		if seqBatcher == nil {
+			return errors.New("sequencer admin server requires a sequencer node")
+		}
+		go func() {
+			err := rpc.LaunchAdminServer(ctx, seqBatcher, lockoutBatcher, config.Node.Sequencer.Admin)
+			if err != nil {
+				errChan <- err
+			}
+		}()
+	}
+
 	var web3InboxReaderRef *monitor.InboxReader
 	if config.Node.RPC.EnableL1Calls {
 		web3InboxReaderRef = inboxReader
@@ -479,12 +507,53 @@ func startup() error {
 		plugins["arb"] = exportServer
 	}
 
+	var traceIndex *traceindex.Index
+	if config.Node.RPC.Tracing.Enable && config.Node.RPC.Tracing.AddressIndex {
+		traceIndex, err = traceindex.New(db, mon.CoreConfig, path.Join(config.Persistent.Chain, "traceindex"))
+		if err != nil {
+			return errors.Wrap(err, "error opening trace index")
+		}
+		if err := traceIndex.Start(ctx); err != nil {
+			return errors.Wrap(err, "error starting trace index")
+		}
+	}
+
+	var bloomIndex *bloomindex.Index
+	if config.Node.RPC.BloomIndex {
+		bloomIndex, err = bloomindex.New(db, path.Join(config.Persistent.Chain, "bloombits"), bloomindex.DefaultSectionSize)
+		if err != nil {
+			return errors.Wrap(err, "error opening bloombits index")
+		}
+		if err := bloomIndex.Start(ctx); err != nil {
+			return errors.Wrap(err, "error starting bloombits index")
+		}
+	}
+
+	var addressIndex *addressindex.Index
+	if config.Node.RPC.AddressTxIndex {
+		addressIndex, err = addressindex.New(db, path.Join(config.Persistent.Chain, "addressindex"))
+		if err != nil {
+			return errors.Wrap(err, "error opening address index")
+		}
+		if err := addressIndex.Start(ctx); err != nil {
+			return errors.Wrap(err, "error starting address index")
+		}
+	}
+
 	srv := aggregator.NewServer(batch, l2ChainId, db)
+	srv.SetBloomIndex(bloomIndex)
+	finality := aggregator.NewFinalityTracker(db, inboxReader, rollup)
+	finality.Start(ctx)
+	srv.SetFinalityTracker(finality)
 	serverConfig := web3.ServerConfig{
 		Mode:          rpcMode,
 		MaxCallAVMGas: config.Node.RPC.MaxCallGas * 100, // Multiply by 100 for arb gas to avm gas conversion
 		Tracing:       config.Node.RPC.Tracing,
+		TraceIndex:    traceIndex,
+		AddressIndex:  addressIndex,
 		DevopsStubs:   config.Node.RPC.EnableDevopsStubs,
+		TxPool:        config.Node.RPC.EnableTxPool,
+		RateLimit:     config.Node.RPC.RateLimit,
 	}
 	web3Server, err := web3.GenerateWeb3Server(srv, nil, serverConfig, mon.CoreConfig, plugins, web3InboxReaderRef)
 	if err != nil {
@@ -577,6 +646,28 @@ func startup() error {
 	}
 }
 
+// handoverOnSignal hands the sequencer lockout over to the next sequencer
+// when SIGUSR1 is received, after which the node keeps running as a
+// forwarder so that it can be shut down without dropping transactions
+func handoverOnSignal(ctx context.Context, lockoutBatcher *rpc.LockoutBatcher) {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGUSR1)
+	defer signal.Stop(signalChan)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signalChan:
+		}
+		logger.Info().Msg("received signal to hand over sequencer lockout")
+		if err := lockoutBatcher.Handover(ctx); err != nil {
+			logger.Error().Err(err).Msg("sequencer handover failed")
+		} else {
+			logger.Info().Msg("sequencer handover complete, safe to shut down")
+		}
+	}
+}
+
 func checkBlockHash(ctx context.Context, clnt *ethclient.Client, db *txdb.TxDB) (bool, error) {
 	if clnt == nil {
 		return false, errors.New("need a client to check block hash")
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dev
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/addressindex"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func TestAddressIndex(t *testing.T) {
+	skipBelowVersion(t, 25)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey := test.MustGenerateKey(t)
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, db, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	senderAuth, err := bind.NewKeyedTransactorWithChainID(senderKey, backend.chainID)
+	test.FailIfError(t, err)
+	client := web3.NewEthClient(srv, true)
+
+	// Blocks created before the index is started are indexed in the background
+	simpleAddr, _, simple, err := arbostestcontracts.DeploySimple(senderAuth, client)
+	test.FailIfError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := simple.Exists(senderAuth)
+		test.FailIfError(t, err)
+	}
+
+	index, err := addressindex.New(db, t.TempDir())
+	test.FailIfError(t, err)
+	test.FailIfError(t, index.Start(ctx))
+
+	waitForIndex := func() {
+		blockCount, err := db.BlockCount()
+		test.FailIfError(t, err)
+		for i := 0; index.IndexedHeight() < blockCount; i++ {
+			if i >= 100 {
+				t.Fatal("address index didn't catch up")
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	waitForIndex()
+
+	// Blocks created after the index is started are indexed as they're added
+	for i := 0; i < 2; i++ {
+		_, err := simple.Exists(senderAuth)
+		test.FailIfError(t, err)
+	}
+	waitForIndex()
+
+	arb := web3.NewArb(srv, web3.NewServer(srv, web3.DefaultConfig, nil), index)
+	getAll := func(account ethcommon.Address, limit hexutil.Uint64) []*web3.AddressTransactionResult {
+		var all []*web3.AddressTransactionResult
+		var cursor *hexutil.Bytes
+		for {
+			res, err := arb.GetTransactionsByAddress(account, 0, rpc.LatestBlockNumber, cursor, &limit)
+			test.FailIfError(t, err)
+			if len(res.Transactions) > int(limit) {
+				t.Fatal("too many results", len(res.Transactions))
+			}
+			all = append(all, res.Transactions...)
+			if res.NextCursor == nil {
+				return all
+			}
+			cursor = &res.NextCursor
+		}
+	}
+
+	sent := getAll(senderAuth.From, 2)
+	if len(sent) != 6 {
+		t.Fatal("wrong sent transaction count", len(sent))
+	}
+	for i, tx := range sent {
+		if !tx.IsSender || tx.From != senderAuth.From {
+			t.Error("expected sender at", i)
+		}
+		if i > 0 && tx.BlockNumber.ToInt().Cmp(sent[i-1].BlockNumber.ToInt()) < 0 {
+			t.Error("transactions out of order at", i)
+		}
+	}
+
+	received := getAll(simpleAddr, 10)
+	if len(received) != 6 {
+		t.Fatal("wrong received transaction count", len(received))
+	}
+	for i, tx := range received {
+		if !tx.IsRecipient || tx.IsSender {
+			t.Error("expected recipient at", i)
+		}
+		if tx.Hash != sent[i].Hash {
+			t.Error("sent and received mismatch at", i)
+		}
+	}
+
+	reorgHeight := sent[3].BlockNumber.ToInt().Uint64()
+	test.FailIfError(t, index.Reorg(reorgHeight))
+	if index.IndexedHeight() != reorgHeight {
+		t.Error("expected reorg to roll back index", index.IndexedHeight())
+	}
+	entries, next := index.Transactions(senderAuth.From, 0, 0, reorgHeight+100, 100)
+	if len(entries) != 3 || next != nil {
+		t.Error("expected reorg to remove entries", len(entries))
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dev
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/filters"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/bloomindex"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func TestBloomIndex(t *testing.T) {
+	skipBelowVersion(t, 25)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey := test.MustGenerateKey(t)
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, db, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	senderAuth, err := bind.NewKeyedTransactorWithChainID(senderKey, backend.chainID)
+	test.FailIfError(t, err)
+	client := web3.NewEthClient(srv, true)
+
+	simpleAddr, _, simple, err := arbostestcontracts.DeploySimple(senderAuth, client)
+	test.FailIfError(t, err)
+	for i := 0; i < 20; i++ {
+		_, err := simple.Exists(senderAuth)
+		test.FailIfError(t, err)
+	}
+
+	filterLogs := func() []ethcommon.Hash {
+		filter := filters.NewRangeFilter(srv, 0, -1, []ethcommon.Address{simpleAddr}, nil)
+		logs, err := filter.Logs(ctx)
+		test.FailIfError(t, err)
+		txHashes := make([]ethcommon.Hash, 0, len(logs))
+		for _, l := range logs {
+			txHashes = append(txHashes, l.TxHash)
+		}
+		return txHashes
+	}
+	unindexed := filterLogs()
+	if len(unindexed) != 20 {
+		t.Fatal("wrong log count", len(unindexed))
+	}
+
+	const sectionSize = 8
+	index, err := bloomindex.New(db, t.TempDir(), sectionSize)
+	test.FailIfError(t, err)
+	test.FailIfError(t, index.Start(ctx))
+
+	blockCount, err := db.BlockCount()
+	test.FailIfError(t, err)
+	for i := 0; ; i++ {
+		if _, sections := index.Status(); sections == blockCount/sectionSize {
+			break
+		}
+		if i >= 100 {
+			t.Fatal("bloom index didn't catch up")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	srv.SetBloomIndex(index)
+	indexed := filterLogs()
+	if len(indexed) != len(unindexed) {
+		t.Fatal("wrong indexed log count", len(indexed))
+	}
+	for i := range indexed {
+		if indexed[i] != unindexed[i] {
+			t.Error("indexed log mismatch at", i)
+		}
+	}
+
+	test.FailIfError(t, index.Reorg(sectionSize+1))
+	if _, sections := index.Status(); sections != 1 {
+		t.Error("expected reorg to drop sections", sections)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dev
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func TestCallBundle(t *testing.T) {
+	skipBelowVersion(t, 25)
+	ctx := context.Background()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey := test.MustGenerateKey(t)
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, _, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	senderAuth, err := bind.NewKeyedTransactorWithChainID(senderKey, backend.chainID)
+	test.FailIfError(t, err)
+
+	arb := web3.NewArb(srv, web3.NewServer(srv, web3.DefaultConfig, nil), nil)
+	client := web3.NewEthClient(srv, true)
+
+	simpleAddr, _, _, err := arbostestcontracts.DeploySimple(senderAuth, client)
+	test.FailIfError(t, err)
+
+	simpleABI, err := arbostestcontracts.SimpleMetaData.GetAbi()
+	test.FailIfError(t, err)
+
+	nonce, err := client.PendingNonceAt(ctx, senderAuth.From)
+	test.FailIfError(t, err)
+
+	signer := types.NewEIP155Signer(backend.chainID)
+	makeTx := func(nonce uint64, data []byte) hexutil.Bytes {
+		tx, err := types.SignNewTx(senderKey, signer, &types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: big.NewInt(0),
+			Gas:      1000000,
+			To:       &simpleAddr,
+			Value:    big.NewInt(0),
+			Data:     data,
+		})
+		test.FailIfError(t, err)
+		data, err := tx.MarshalBinary()
+		test.FailIfError(t, err)
+		return data
+	}
+
+	// The second transaction is only valid after the first one
+	txs := []hexutil.Bytes{
+		makeTx(nonce, simpleABI.Methods["exists"].ID),
+		makeTx(nonce+1, simpleABI.Methods["reverts"].ID),
+	}
+	blockNum := rpc.LatestBlockNumber
+	timestamp := hexutil.Uint64(1000000000)
+	res, err := arb.CallBundle(
+		ctx,
+		txs,
+		rpc.BlockNumberOrHash{BlockNumber: &blockNum},
+		&web3.BundleOverrides{Timestamp: &timestamp},
+	)
+	test.FailIfError(t, err)
+
+	if len(res.Results) != 2 {
+		t.Fatal("wrong result count", len(res.Results))
+	}
+	if evm.ResultType(res.Results[0].ResultCode) != evm.ReturnCode {
+		t.Error("unexpected first result", res.Results[0].Result)
+	}
+	if len(res.Results[0].Logs) != 1 || res.Results[0].Logs[0].Address != simpleAddr {
+		t.Error("expected first transaction to emit an event")
+	}
+	if evm.ResultType(res.Results[1].ResultCode) != evm.RevertCode {
+		t.Error("unexpected second result", res.Results[1].Result)
+	}
+	if res.GasUsed != res.Results[0].GasUsed+res.Results[1].GasUsed {
+		t.Error("wrong total gas used")
+	}
+	if _, ok := res.StateDiff[senderAuth.From]; !ok {
+		t.Error("expected state diff for sender")
+	}
+
+	// Contracts created by internal calls are included in the state diff
+	traceMethod := simpleABI.Methods["trace"]
+	traceArgs, err := traceMethod.Inputs.Pack(big.NewInt(4234))
+	test.FailIfError(t, err)
+	res, err = arb.CallBundle(
+		ctx,
+		[]hexutil.Bytes{makeTx(nonce, append(traceMethod.ID, traceArgs...))},
+		rpc.BlockNumberOrHash{BlockNumber: &blockNum},
+		nil,
+	)
+	test.FailIfError(t, err)
+	if evm.ResultType(res.Results[0].ResultCode) != evm.ReturnCode {
+		t.Fatal("unexpected trace result", res.Results[0].Result)
+	}
+	createdContract := false
+	for account, accountDiff := range res.StateDiff {
+		if account == senderAuth.From || account == simpleAddr {
+			continue
+		}
+		codeDiff, err := json.Marshal(accountDiff.Code)
+		test.FailIfError(t, err)
+		if strings.HasPrefix(string(codeDiff), `{"+":`) {
+			createdContract = true
+		}
+	}
+	if !createdContract {
+		t.Error("expected state diff for contract created by internal call")
+	}
+
+	// Simulating the bundle must not affect the chain
+	newNonce, err := client.PendingNonceAt(ctx, senderAuth.From)
+	test.FailIfError(t, err)
+	if newNonce != nonce {
+		t.Error("bundle changed sender nonce")
+	}
+
+	// Out of order transactions are reported rather than failing the bundle
+	res, err = arb.CallBundle(
+		ctx,
+		[]hexutil.Bytes{txs[1]},
+		rpc.BlockNumberOrHash{BlockNumber: &blockNum},
+		nil,
+	)
+	test.FailIfError(t, err)
+	if evm.ResultType(res.Results[0].ResultCode) != evm.BadSequenceCode {
+		t.Error("unexpected result for out of order transaction", res.Results[0].Result)
+	}
+}
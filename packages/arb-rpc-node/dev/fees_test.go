@@ -30,6 +30,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/arbos"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/arboscontracts"
@@ -463,3 +464,86 @@ func TestDeploy(t *testing.T) {
 	test.FailIfError(t, err)
 	t.Log(arbRes)
 }
+
+func TestFeeHistory(t *testing.T) {
+	ctx := context.Background()
+	_, web3Server, client, auth, _, _, _, _, cancel := setupFeeChain(t, ctx)
+	defer cancel()
+
+	nonce, err := client.PendingNonceAt(ctx, auth.From)
+	test.FailIfError(t, err)
+	tx := transferTx(t, ctx, nonce, client, common.RandAddress().ToEthAddress())
+	tx, err = auth.Signer(auth.From, tx)
+	test.FailIfError(t, err)
+	test.FailIfError(t, client.SendTransaction(ctx, tx))
+
+	latest, err := web3Server.BlockNumber()
+	test.FailIfError(t, err)
+
+	history, err := web3Server.FeeHistory(ctx, 4, rpc.LatestBlockNumber, []float64{10, 50, 90})
+	test.FailIfError(t, err)
+	if history.OldestBlock.ToInt().Uint64() != uint64(latest)-3 {
+		t.Error("unexpected oldest block", history.OldestBlock)
+	}
+	if len(history.BaseFee) != 5 {
+		t.Error("expected base fee for each block plus the next", len(history.BaseFee))
+	}
+	if len(history.GasUsedRatio) != 4 || len(history.Reward) != 4 {
+		t.Fatal("expected entry for each block")
+	}
+	for _, reward := range history.Reward {
+		if len(reward) != 3 {
+			t.Error("expected reward for each percentile")
+		}
+	}
+	if history.GasUsedRatio[3] <= 0 {
+		t.Error("expected latest block to use gas")
+	}
+
+	if _, err := web3Server.FeeHistory(ctx, 4, rpc.LatestBlockNumber, []float64{50, 10}); err == nil {
+		t.Error("expected error for decreasing percentiles")
+	}
+
+	tipCap, err := client.SuggestGasTipCap(ctx)
+	test.FailIfError(t, err)
+	if tipCap.Sign() < 0 {
+		t.Error("negative tip cap")
+	}
+}
+
+func TestBlockReceipts(t *testing.T) {
+	ctx := context.Background()
+	_, web3Server, client, auth, _, _, _, _, cancel := setupFeeChain(t, ctx)
+	defer cancel()
+
+	nonce, err := client.PendingNonceAt(ctx, auth.From)
+	test.FailIfError(t, err)
+	tx := transferTx(t, ctx, nonce, client, common.RandAddress().ToEthAddress())
+	tx, err = auth.Signer(auth.From, tx)
+	test.FailIfError(t, err)
+	test.FailIfError(t, client.SendTransaction(ctx, tx))
+
+	receipt, err := web3Server.GetTransactionReceipt(ctx, tx.Hash().Bytes(), nil)
+	test.FailIfError(t, err)
+	if receipt == nil {
+		t.Fatal("expected receipt")
+	}
+
+	blockNum := rpc.BlockNumber(receipt.BlockNumber.ToInt().Int64())
+	receipts, err := web3Server.GetBlockReceipts(ctx, rpc.BlockNumberOrHash{BlockNumber: &blockNum}, nil)
+	test.FailIfError(t, err)
+	found := false
+	for _, blockReceipt := range receipts {
+		if blockReceipt.TransactionHash == tx.Hash() {
+			assertTraceEqual(t, receipt, blockReceipt)
+			found = true
+		}
+	}
+	if !found {
+		t.Error("block receipts didn't include transaction")
+	}
+
+	receiptsByHash, err := web3Server.GetBlockReceipts(ctx, rpc.BlockNumberOrHashWithHash(receipt.BlockHash, false), nil)
+	test.FailIfError(t, err)
+	assertTraceEqual(t, receipts, receiptsByHash)
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dev
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/aggregator"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func TestFinalityBlockSearch(t *testing.T) {
+	skipBelowVersion(t, 25)
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey := test.MustGenerateKey(t)
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, _, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	senderAuth, err := bind.NewKeyedTransactorWithChainID(senderKey, backend.chainID)
+	test.FailIfError(t, err)
+	client := web3.NewEthClient(srv, true)
+	for i := 0; i < 3; i++ {
+		_, _, _, err := arbostestcontracts.DeploySimple(senderAuth, client)
+		test.FailIfError(t, err)
+	}
+
+	latest, err := backend.db.LatestBlock()
+	test.FailIfError(t, err)
+	height := latest.Header.Number.Uint64()
+	if height == 0 {
+		t.Fatal("expected blocks to be created")
+	}
+
+	block, err := backend.db.LatestBlockWithLogCount(new(big.Int).SetUint64(latest.BlockLog + 1))
+	test.FailIfError(t, err)
+	if block == nil || block.Header.Number.Uint64() != height {
+		t.Error("expected latest block to be covered by its own block log")
+	}
+	block, err = backend.db.LatestBlockWithLogCount(new(big.Int).SetUint64(latest.BlockLog))
+	test.FailIfError(t, err)
+	if block == nil || block.Header.Number.Uint64() >= height {
+		t.Error("expected latest block not to be covered without its block log")
+	}
+	block, err = backend.db.LatestBlockWithLogCount(big.NewInt(0))
+	test.FailIfError(t, err)
+	if block != nil {
+		t.Error("expected no block to be covered by zero logs")
+	}
+
+	blockLog, err := core.GetZeroOrOneLog(backend.db.Lookup, new(big.Int).SetUint64(latest.BlockLog))
+	test.FailIfError(t, err)
+	block, err = backend.db.LatestBlockWithMessageCount(blockLog.Inbox.Count)
+	test.FailIfError(t, err)
+	if block == nil || block.Header.Number.Uint64() != height {
+		t.Error("expected latest block to be covered by its inbox count")
+	}
+
+	// Without a finality tracker the tags are unavailable
+	safe := aggregator.SafeBlockNumber
+	if _, err := srv.BlockNum(&safe); err == nil {
+		t.Error("expected safe block to be unavailable")
+	}
+	finalized := aggregator.FinalizedBlockNumber
+	if _, err := srv.BlockNum(&finalized); err == nil {
+		t.Error("expected finalized block to be unavailable")
+	}
+}
+
+func TestFinalityBlockTagsOverRPC(t *testing.T) {
+	skipBelowVersion(t, 25)
+	ctx := context.Background()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	_, _, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	web3Server, err := web3.GenerateWeb3Server(srv, nil, web3.DefaultConfig, configuration.DefaultCoreSettingsMaxExecution(), nil, nil)
+	test.FailIfError(t, err)
+	client := rpc.DialInProc(web3Server)
+	defer client.Close()
+
+	var block map[string]interface{}
+	test.FailIfError(t, client.CallContext(ctx, &block, "eth_getBlockByNumber", "latest", false))
+	if block == nil {
+		t.Fatal("expected latest block")
+	}
+
+	// The tags have to be parsed as the block numbers the aggregator checks
+	// for, otherwise the request fails as an invalid argument instead
+	tags := []struct {
+		tag      string
+		blockNum rpc.BlockNumber
+	}{
+		{"safe", aggregator.SafeBlockNumber},
+		{"finalized", aggregator.FinalizedBlockNumber},
+	}
+	for _, tc := range tags {
+		tag := tc.tag
+		var parsed rpc.BlockNumber
+		test.FailIfError(t, parsed.UnmarshalJSON([]byte(`"`+tag+`"`)))
+		if parsed != tc.blockNum {
+			t.Error(tag, "tag parsed as", parsed.Int64())
+		}
+
+		err := client.CallContext(ctx, &block, "eth_getBlockByNumber", tag, false)
+		if err == nil {
+			t.Error("expected", tag, "block to be unavailable without a finality tracker")
+		} else if err.Error() != tag+" block not found" {
+			t.Error("unexpected error for", tag, "block:", err)
+		}
+	}
+}
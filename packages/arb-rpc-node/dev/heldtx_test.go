@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dev
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/aggregator"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+// holdingTestBatcher holds transactions with a nonce ahead of the next one
+// like the sequencer does, returning batcher.ErrTxHeld for them and sending
+// them on once the gap is filled
+type holdingTestBatcher struct {
+	*Backend
+
+	mutex sync.Mutex
+	next  uint64
+	held  map[uint64]*types.Transaction
+}
+
+func (b *holdingTestBatcher) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if tx.Nonce() > b.next {
+		b.held[tx.Nonce()] = tx
+		return batcher.ErrTxHeld
+	}
+	for {
+		if err := b.Backend.SendTransaction(ctx, tx); err != nil {
+			return err
+		}
+		b.next++
+		tx = b.held[b.next]
+		if tx == nil {
+			return nil
+		}
+		delete(b.held, b.next)
+	}
+}
+
+func signHeldTestTx(t *testing.T, key *ecdsa.PrivateKey, chainId *big.Int, nonce uint64) (*types.Transaction, hexutil.Bytes) {
+	t.Helper()
+	dest := common.RandAddress().ToEthAddress()
+	tx, err := types.SignNewTx(key, types.NewEIP155Signer(chainId), &types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: big.NewInt(0),
+		Gas:      1000000,
+		To:       &dest,
+		Value:    big.NewInt(0),
+	})
+	test.FailIfError(t, err)
+	data, err := tx.MarshalBinary()
+	test.FailIfError(t, err)
+	return tx, data
+}
+
+func TestSendHeldTransaction(t *testing.T) {
+	ctx := context.Background()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey := test.MustGenerateKey(t)
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, db, _, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	holding := &holdingTestBatcher{Backend: backend, held: make(map[uint64]*types.Transaction)}
+	srv := aggregator.NewServer(holding, backend.chainID, db)
+	web3Server, err := web3.GenerateWeb3Server(srv, nil, web3.DefaultConfig, configuration.DefaultCoreSettingsMaxExecution(), nil, nil)
+	test.FailIfError(t, err)
+	client := rpc.DialInProc(web3Server)
+	defer client.Close()
+
+	// Nonce 1 arrives before nonce 0 and both are accepted
+	tx1, data1 := signHeldTestTx(t, senderKey, backend.chainID, 1)
+	tx0, data0 := signHeldTestTx(t, senderKey, backend.chainID, 0)
+	var txHash ethcommon.Hash
+	test.FailIfError(t, client.CallContext(ctx, &txHash, "eth_sendRawTransaction", data1))
+	if txHash != tx1.Hash() {
+		t.Error("wrong hash for held transaction", txHash)
+	}
+	test.FailIfError(t, client.CallContext(ctx, &txHash, "eth_sendRawTransaction", data0))
+	if txHash != tx0.Hash() {
+		t.Error("wrong hash for transaction filling the gap", txHash)
+	}
+	for _, tx := range []*types.Transaction{tx0, tx1} {
+		var receipt *web3.GetTransactionReceiptResult
+		test.FailIfError(t, client.CallContext(ctx, &receipt, "eth_getTransactionReceipt", tx.Hash()))
+		if receipt == nil || receipt.Status != 1 {
+			t.Error("transaction not sequenced", tx.Nonce())
+		}
+	}
+
+	// The sync method reports a held transaction as queued
+	tx3, data3 := signHeldTestTx(t, senderKey, backend.chainID, 3)
+	_, data2 := signHeldTestTx(t, senderKey, backend.chainID, 2)
+	var res *web3.SendRawTransactionSyncResult
+	test.FailIfError(t, client.CallContext(ctx, &res, "arb_sendRawTransactionSync", data3))
+	if res == nil || !res.Queued || res.Receipt != nil {
+		t.Error("expected held transaction to be queued", res)
+	}
+	test.FailIfError(t, client.CallContext(ctx, &res, "arb_sendRawTransactionSync", data2))
+	if res == nil || res.Queued || res.Receipt == nil || res.Receipt.Status != 1 {
+		t.Error("expected receipt for transaction filling the gap", res)
+	}
+	var receipt *web3.GetTransactionReceiptResult
+	test.FailIfError(t, client.CallContext(ctx, &receipt, "eth_getTransactionReceipt", tx3.Hash()))
+	if receipt == nil || receipt.Status != 1 {
+		t.Error("held transaction not sequenced")
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dev
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func TestSenderRateLimit(t *testing.T) {
+	ctx := context.Background()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey := test.MustGenerateKey(t)
+	otherKey := test.MustGenerateKey(t)
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, _, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	ethServer := web3.NewServer(srv, web3.DefaultConfig, nil)
+	forwarder := web3.NewForwarderServer(srv, ethServer, configuration.NormalRpcMode, configuration.RateLimit{
+		SenderRate:  0.001,
+		SenderBurst: 2,
+	})
+
+	signer := types.NewEIP155Signer(backend.chainID)
+	dest := crypto.PubkeyToAddress(ownerKey.PublicKey)
+	send := func(key *ecdsa.PrivateKey, nonce uint64) error {
+		tx, err := types.SignNewTx(key, signer, &types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: big.NewInt(0),
+			Gas:      1000000,
+			To:       &dest,
+			Value:    big.NewInt(0),
+		})
+		test.FailIfError(t, err)
+		data, err := tx.MarshalBinary()
+		test.FailIfError(t, err)
+		_, err = forwarder.SendRawTransaction(ctx, data)
+		return err
+	}
+
+	test.FailIfError(t, send(senderKey, 0))
+	test.FailIfError(t, send(senderKey, 1))
+	err := send(senderKey, 2)
+	var rpcErr rpc.Error
+	if err == nil || !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != web3.RateLimitedErrorCode {
+		t.Fatal("expected rate limit error", err)
+	}
+
+	// Other senders aren't affected
+	test.FailIfError(t, send(otherKey, 0))
+}
+
+func TestIPRateLimitBehindProxy(t *testing.T) {
+	ctx := context.Background()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, _, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	serverConfig := web3.DefaultConfig
+	serverConfig.RateLimit = configuration.RateLimit{IPRate: 0.001, IPBurst: 1}
+	web3Server, err := web3.GenerateWeb3Server(srv, nil, serverConfig, configuration.DefaultCoreSettingsMaxExecution(), nil, nil)
+	test.FailIfError(t, err)
+	newServer := func(trustedProxies []string) *httptest.Server {
+		handler, err := web3.ClientIPHandler(web3Server, trustedProxies)
+		test.FailIfError(t, err)
+		return httptest.NewServer(handler)
+	}
+	proxied := newServer([]string{"127.0.0.0/8"})
+	defer proxied.Close()
+	direct := newServer(nil)
+	defer direct.Close()
+
+	signer := types.NewEIP155Signer(backend.chainID)
+	dest := crypto.PubkeyToAddress(ownerKey.PublicKey)
+	send := func(url string, forwardedFor string) error {
+		client, err := rpc.DialHTTP(url)
+		test.FailIfError(t, err)
+		defer client.Close()
+		client.SetHeader("X-Forwarded-For", forwardedFor)
+		// A fresh sender each time so only the IP limit applies
+		tx, err := types.SignNewTx(test.MustGenerateKey(t), signer, &types.LegacyTx{
+			Nonce:    0,
+			GasPrice: big.NewInt(0),
+			Gas:      1000000,
+			To:       &dest,
+			Value:    big.NewInt(0),
+		})
+		test.FailIfError(t, err)
+		data, err := tx.MarshalBinary()
+		test.FailIfError(t, err)
+		return client.CallContext(ctx, nil, "eth_sendRawTransaction", hexutil.Bytes(data))
+	}
+	checkLimited := func(err error) {
+		t.Helper()
+		var rpcErr rpc.Error
+		if err == nil || !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != web3.RateLimitedErrorCode {
+			t.Error("expected rate limit error", err)
+		}
+	}
+
+	// Behind a trusted proxy, clients are told apart by X-Forwarded-For
+	test.FailIfError(t, send(proxied.URL, "203.0.113.1"))
+	checkLimited(send(proxied.URL, "203.0.113.1"))
+	checkLimited(send(proxied.URL, "203.0.113.1, 127.0.0.1"))
+	test.FailIfError(t, send(proxied.URL, "203.0.113.2"))
+
+	// Otherwise the header is ignored and the connection's address is used
+	test.FailIfError(t, send(direct.URL, "203.0.113.3"))
+	checkLimited(send(direct.URL, "203.0.113.4"))
+}
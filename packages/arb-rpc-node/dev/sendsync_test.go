@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dev
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func TestSendRawTransactionSync(t *testing.T) {
+	ctx := context.Background()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey := test.MustGenerateKey(t)
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, _, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	senderAuth, err := bind.NewKeyedTransactorWithChainID(senderKey, backend.chainID)
+	test.FailIfError(t, err)
+
+	ethServer := web3.NewServer(srv, web3.DefaultConfig, nil)
+	sender := web3.NewSyncSender(ethServer, web3.NewForwarderServer(srv, ethServer, configuration.NormalRpcMode, configuration.RateLimit{}))
+	client := web3.NewEthClient(srv, true)
+
+	simpleAddr, _, _, err := arbostestcontracts.DeploySimple(senderAuth, client)
+	test.FailIfError(t, err)
+	simpleABI, err := arbostestcontracts.SimpleMetaData.GetAbi()
+	test.FailIfError(t, err)
+
+	nonce, err := client.PendingNonceAt(ctx, senderAuth.From)
+	test.FailIfError(t, err)
+	tx, err := types.SignNewTx(senderKey, types.NewEIP155Signer(backend.chainID), &types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: big.NewInt(0),
+		Gas:      1000000,
+		To:       &simpleAddr,
+		Value:    big.NewInt(0),
+		Data:     simpleABI.Methods["exists"].ID,
+	})
+	test.FailIfError(t, err)
+	data, err := tx.MarshalBinary()
+	test.FailIfError(t, err)
+
+	res, err := sender.SendRawTransactionSync(ctx, data, nil)
+	test.FailIfError(t, err)
+
+	if res.Receipt.TransactionHash != tx.Hash() {
+		t.Error("wrong receipt transaction hash")
+	}
+	if res.Receipt.Status != 1 {
+		t.Error("transaction failed")
+	}
+	if len(res.Receipt.Logs) != 1 || res.Receipt.Logs[0].Address != simpleAddr {
+		t.Error("expected receipt to include event")
+	}
+	if !res.SoftConfirmation {
+		t.Error("expected soft confirmation")
+	}
+
+	// The receipt must match what eth_getTransactionReceipt returns
+	receipt, err := ethServer.GetTransactionReceipt(ctx, tx.Hash().Bytes(), nil)
+	test.FailIfError(t, err)
+	if receipt == nil || receipt.BlockHash != res.Receipt.BlockHash {
+		t.Error("receipt doesn't match stored receipt")
+	}
+
+	l1SeqNum := (*big.Int)(res.SequenceNumber)
+	txRes, err := ethServer.GetTransactionByHash(tx.Hash().Bytes())
+	test.FailIfError(t, err)
+	if txRes.L1SeqNum == nil || l1SeqNum.Cmp((*big.Int)(txRes.L1SeqNum)) != 0 {
+		t.Error("wrong sequence number", l1SeqNum)
+	}
+}
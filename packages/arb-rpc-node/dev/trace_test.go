@@ -7,7 +7,9 @@ import (
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
 	"math/big"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -17,6 +19,7 @@ import (
 
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/traceindex"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
@@ -134,6 +137,29 @@ func TestTrace(t *testing.T) {
 	clearGasData(tx1TraceData)
 	clearGasData(callTraceData)
 	assertTraceEqual(t, callTraceData, tx1TraceData)
+
+	vmTraceData, err := tracer.ReplayTransaction(ctx, userTx1.Hash().Bytes(), []string{"trace", "vmTrace"})
+	test.FailIfError(t, err)
+	if vmTraceData.VmTrace == nil {
+		t.Fatal("expected vmTrace")
+	}
+	simpleCode, err := client.CodeAt(ctx, simpleAddr, nil)
+	test.FailIfError(t, err)
+	if !bytes.Equal(vmTraceData.VmTrace.Code, simpleCode) {
+		t.Error("expected vmTrace code to be called contract code")
+	}
+	if len(vmTraceData.VmTrace.Ops) == 0 {
+		t.Fatal("expected vmTrace ops")
+	}
+	// ArbOS doesn't report gas costs or effects, which are left null
+	opJSON, err := json.Marshal(vmTraceData.VmTrace.Ops[0])
+	test.FailIfError(t, err)
+	if !strings.Contains(string(opJSON), `"cost":null`) || !strings.Contains(string(opJSON), `"ex":null`) {
+		t.Error("expected null cost and ex", string(opJSON))
+	}
+	if tx1TraceData.VmTrace != nil {
+		t.Error("vmTrace returned when not requested")
+	}
 }
 
 func clearGasData(trace *web3.TraceResult) {
@@ -300,3 +326,227 @@ func TestTraceConstructor(t *testing.T) {
 	checkCreateRequest(successDepositRequestId.Bytes(), successTx.Data(), senderAuth.From, failedTx.Nonce()+1, true)
 	checkCreateRequest(failedDepositRequestId.Bytes(), successTx.Data(), senderAuth.From, failedTx.Nonce()+2, false)
 }
+
+func TestTraceStateDiff(t *testing.T) {
+	skipBelowVersion(t, 25)
+	ctx := context.Background()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey := test.MustGenerateKey(t)
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, _, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	senderAuth, err := bind.NewKeyedTransactorWithChainID(senderKey, backend.chainID)
+	test.FailIfError(t, err)
+
+	ethServer := web3.NewServer(srv, web3.DefaultConfig, nil)
+	tracer := web3.NewTracer(ethServer, configuration.DefaultCoreSettingsMaxExecution())
+
+	client := web3.NewEthClient(srv, true)
+
+	deposit := message.EthDepositTx{
+		L2Message: message.NewSafeL2Message(message.ContractTransaction{
+			BasicTx: message.BasicTx{
+				MaxGas:      big.NewInt(1000000),
+				GasPriceBid: big.NewInt(0),
+				DestAddress: common.NewAddressFromEth(senderAuth.From),
+				Payment:     new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil),
+				Data:        nil,
+			},
+		}),
+	}
+	_, err = backend.AddInboxMessage(ctx, deposit, message.L1RemapAccount(common.NewAddressFromEth(senderAuth.From)))
+	test.FailIfError(t, err)
+
+	dest := common.RandAddress().ToEthAddress()
+	tx := transferTx(t, ctx, 0, client, dest)
+	tx, err = senderAuth.Signer(senderAuth.From, tx)
+	test.FailIfError(t, err)
+	test.FailIfError(t, client.SendTransaction(ctx, tx))
+
+	traceData, err := tracer.ReplayTransaction(ctx, tx.Hash().Bytes(), []string{"trace", "stateDiff"})
+	test.FailIfError(t, err)
+
+	destDiff, ok := traceData.StateDiff[dest]
+	if !ok {
+		t.Fatal("expected state diff for transfer destination")
+	}
+	balanceDiff, err := json.Marshal(destDiff.Balance)
+	test.FailIfError(t, err)
+	if string(balanceDiff) != `{"+":"0x64"}` {
+		t.Error("unexpected destination balance diff", string(balanceDiff))
+	}
+	// Storage isn't diffed, which is reported as null rather than unchanged
+	destDiffJSON, err := json.Marshal(destDiff)
+	test.FailIfError(t, err)
+	if !strings.Contains(string(destDiffJSON), `"storage":null`) {
+		t.Error("expected null storage diff", string(destDiffJSON))
+	}
+
+	senderDiff, ok := traceData.StateDiff[senderAuth.From]
+	if !ok {
+		t.Fatal("expected state diff for transfer sender")
+	}
+	nonceDiff, err := json.Marshal(senderDiff.Nonce)
+	test.FailIfError(t, err)
+	if string(nonceDiff) != `{"*":{"from":"0x0","to":"0x1"}}` {
+		t.Error("unexpected sender nonce diff", string(nonceDiff))
+	}
+
+	plainTraceData, err := tracer.ReplayTransaction(ctx, tx.Hash().Bytes(), []string{"trace"})
+	test.FailIfError(t, err)
+	if plainTraceData.StateDiff != nil {
+		t.Error("state diff returned when not requested")
+	}
+}
+
+func TestDebugTrace(t *testing.T) {
+	skipBelowVersion(t, 25)
+	ctx := context.Background()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey := test.MustGenerateKey(t)
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, _, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	senderAuth, err := bind.NewKeyedTransactorWithChainID(senderKey, backend.chainID)
+	test.FailIfError(t, err)
+
+	ethServer := web3.NewServer(srv, web3.DefaultConfig, nil)
+	debug := web3.NewDebug(web3.NewTracer(ethServer, configuration.DefaultCoreSettingsMaxExecution()))
+
+	client := web3.NewEthClient(srv, true)
+
+	simpleAddr, _, simple, err := arbostestcontracts.DeploySimple(senderAuth, client)
+	test.FailIfError(t, err)
+
+	tx, err := simple.Trace(senderAuth, big.NewInt(4234))
+	test.FailIfError(t, err)
+
+	callTracer := "callTracer"
+	callTraceData, err := debug.TraceTransaction(ctx, tx.Hash(), &web3.TraceConfig{Tracer: &callTracer})
+	test.FailIfError(t, err)
+	callFrame, ok := callTraceData.(*web3.CallTracerFrame)
+	if !ok {
+		t.Fatal("unexpected callTracer result type")
+	}
+	if callFrame.Type != "CALL" {
+		t.Error("unexpected top level call type", callFrame.Type)
+	}
+	if callFrame.From != senderAuth.From {
+		t.Error("unexpected top level sender")
+	}
+	if callFrame.To == nil || *callFrame.To != simpleAddr {
+		t.Error("unexpected top level destination")
+	}
+	if len(callFrame.Calls) == 0 {
+		t.Error("expected nested calls")
+	}
+
+	prestateTracer := "prestateTracer"
+	prestateData, err := debug.TraceTransaction(ctx, tx.Hash(), &web3.TraceConfig{Tracer: &prestateTracer})
+	test.FailIfError(t, err)
+	prestate, ok := prestateData.(web3.Prestate)
+	if !ok {
+		t.Fatal("unexpected prestateTracer result type")
+	}
+	senderState, ok := prestate[senderAuth.From]
+	if !ok {
+		t.Fatal("expected prestate for sender")
+	}
+	if senderState.Nonce != tx.Nonce() {
+		t.Error("unexpected sender nonce in prestate", senderState.Nonce)
+	}
+	simpleCode, err := client.CodeAt(ctx, simpleAddr, nil)
+	test.FailIfError(t, err)
+	if !bytes.Equal(prestate[simpleAddr].Code, simpleCode) {
+		t.Error("expected prestate code to be called contract code")
+	}
+
+	gas := hexutil.Uint64(100000000)
+	blockNum := rpc.LatestBlockNumber
+	data := hexutil.Bytes(tx.Data())
+	callData, err := debug.TraceCall(ctx, web3.CallTxArgs{
+		From: &senderAuth.From,
+		To:   &simpleAddr,
+		Data: &data,
+		Gas:  &gas,
+	}, rpc.BlockNumberOrHash{BlockNumber: &blockNum}, &web3.TraceConfig{Tracer: &callTracer})
+	test.FailIfError(t, err)
+	if len(callData.(*web3.CallTracerFrame).Calls) != len(callFrame.Calls) {
+		t.Error("call and transaction traces have different nested calls")
+	}
+
+	if _, err := debug.TraceTransaction(ctx, tx.Hash(), nil); err == nil {
+		t.Error("expected error without tracer")
+	}
+}
+
+func TestTraceAddressIndex(t *testing.T) {
+	skipBelowVersion(t, 25)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey := test.MustGenerateKey(t)
+	ownerKey := test.MustGenerateKey(t)
+	owner := crypto.PubkeyToAddress(ownerKey.PublicKey)
+
+	backend, db, srv, cancelDevNode := NewSimpleTestDevNode(t, config, common.NewAddressFromEth(owner))
+	defer cancelDevNode()
+
+	index, err := traceindex.New(db, configuration.DefaultCoreSettingsMaxExecution(), t.TempDir())
+	test.FailIfError(t, err)
+	test.FailIfError(t, index.Start(ctx))
+
+	senderAuth, err := bind.NewKeyedTransactorWithChainID(senderKey, backend.chainID)
+	test.FailIfError(t, err)
+
+	client := web3.NewEthClient(srv, true)
+
+	simpleAddr, _, simple, err := arbostestcontracts.DeploySimple(senderAuth, client)
+	test.FailIfError(t, err)
+	tx, err := simple.Trace(senderAuth, big.NewInt(4234))
+	test.FailIfError(t, err)
+
+	txReq, _, _, err := backend.db.GetRequest(common.NewHashFromEth(tx.Hash()))
+	test.FailIfError(t, err)
+	blockNum := txReq.IncomingRequest.L2BlockNumber.Uint64()
+
+	for i := 0; index.IndexedHeight() <= blockNum; i++ {
+		if i >= 100 {
+			t.Fatal("trace index didn't catch up")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	containsBlock := func(blocks []uint64) bool {
+		for _, block := range blocks {
+			if block == blockNum {
+				return true
+			}
+		}
+		return false
+	}
+	if !containsBlock(index.Blocks([]ethcommon.Address{senderAuth.From}, nil, 1, blockNum)) {
+		t.Error("expected block for sender")
+	}
+	if !containsBlock(index.Blocks([]ethcommon.Address{senderAuth.From}, []ethcommon.Address{simpleAddr}, 1, blockNum)) {
+		t.Error("expected block for sender and receiver")
+	}
+	if len(index.Blocks([]ethcommon.Address{common.RandAddress().ToEthAddress()}, nil, 1, blockNum)) != 0 {
+		t.Error("expected no blocks for unused address")
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
+	utils2 "github.com/offchainlabs/arbitrum/packages/arb-rpc-node/utils"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+// SequencerAdmin implements the arbadmin namespace, which lets operators
+// change the sequencer's behavior without restarting it
+type SequencerAdmin struct {
+	batcher *batcher.SequencerBatcher
+	lockout *LockoutBatcher
+}
+
+// NewSequencerAdmin creates the arbadmin namespace. lockout may be nil if
+// the sequencer isn't using a lockout, in which case handover is unavailable
+func NewSequencerAdmin(batcher *batcher.SequencerBatcher, lockout *LockoutBatcher) *SequencerAdmin {
+	return &SequencerAdmin{batcher: batcher, lockout: lockout}
+}
+
+type SequencerStatus struct {
+	Paused                  bool           `json:"paused"`
+	BatchPostingEnabled     bool           `json:"batchPostingEnabled"`
+	BatchForced             bool           `json:"batchForced"`
+	QueueDepth              hexutil.Uint64 `json:"queueDepth"`
+	HeldTransactions        hexutil.Uint64 `json:"heldTransactions"`
+	PendingBatchGasEstimate hexutil.Uint64 `json:"pendingBatchGasEstimate"`
+	HandoverInProgress      bool           `json:"handoverInProgress"`
+}
+
+func (a *SequencerAdmin) Status() *SequencerStatus {
+	queued, held := a.batcher.QueueDepth()
+	handoverInProgress := false
+	if a.lockout != nil {
+		handoverInProgress = a.lockout.HandoverInProgress()
+	}
+	return &SequencerStatus{
+		Paused:                  a.batcher.SequencingPaused(),
+		BatchPostingEnabled:     a.batcher.BatchPostingEnabled(),
+		BatchForced:             a.batcher.BatchForced(),
+		QueueDepth:              hexutil.Uint64(queued),
+		HeldTransactions:        hexutil.Uint64(held),
+		PendingBatchGasEstimate: hexutil.Uint64(a.batcher.PendingBatchGasEstimate()),
+		HandoverInProgress:      handoverInProgress,
+	}
+}
+
+func (a *SequencerAdmin) PauseSequencing() {
+	logger.Warn().Msg("user transaction sequencing paused by admin")
+	a.batcher.PauseSequencing()
+}
+
+func (a *SequencerAdmin) ResumeSequencing() {
+	logger.Warn().Msg("user transaction sequencing resumed by admin")
+	a.batcher.ResumeSequencing()
+}
+
+func (a *SequencerAdmin) SetBatchPosting(enabled bool) {
+	logger.Warn().Bool("enabled", enabled).Msg("batch posting changed by admin")
+	a.batcher.SetBatchPostingEnabled(enabled)
+}
+
+// PublishBatch makes the sequencer post a batch at its next check instead
+// of waiting for the batch interval
+func (a *SequencerAdmin) PublishBatch() error {
+	if !a.batcher.BatchPostingEnabled() {
+		return errors.New("batch posting is disabled")
+	}
+	logger.Warn().Msg("batch forced by admin")
+	a.batcher.ForceBatch()
+	return nil
+}
+
+// SequenceDelayedMessages sequences any delayed messages that have passed
+// the target delay. bypassLockout should only be used when no other
+// sequencer could be holding the lockout
+func (a *SequencerAdmin) SequenceDelayedMessages(ctx context.Context, bypassLockout bool) error {
+	logger.Warn().Bool("bypassLockout", bypassLockout).Msg("delayed message sequencing forced by admin")
+	return a.batcher.SequenceDelayedMessages(ctx, bypassLockout)
+}
+
+// Handover hands the lockout over to the next sequencer by priority,
+// returning once the final batch has been posted and the lockout released
+func (a *SequencerAdmin) Handover(ctx context.Context) error {
+	if a.lockout == nil {
+		return errors.New("handover requires the sequencer lockout")
+	}
+	logger.Warn().Msg("sequencer handover requested by admin")
+	return a.lockout.Handover(ctx)
+}
+
+// LaunchAdminServer serves the arbadmin namespace on its own server,
+// requiring the bearer token in config.TokenFile
+func LaunchAdminServer(ctx context.Context, seqBatcher *batcher.SequencerBatcher, lockout *LockoutBatcher, config configuration.SequencerAdmin) error {
+	if len(config.TokenFile) == 0 {
+		return errors.New("sequencer admin server requires a token file")
+	}
+	tokenData, err := ioutil.ReadFile(config.TokenFile)
+	if err != nil {
+		return errors.Wrap(err, "error reading sequencer admin token")
+	}
+	token := strings.TrimSpace(string(tokenData))
+	if len(token) == 0 {
+		return errors.New("sequencer admin token file is empty")
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("arbadmin", NewSequencerAdmin(seqBatcher, lockout)); err != nil {
+		return err
+	}
+	return utils2.LaunchAuthenticatedRPC(ctx, server, config.Addr, config.Port, config.Path, token)
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright 2020, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+// lockoutStore is the shared storage the sequencers coordinate through. Keys
+// set with a timeout must read as missing once it passes, and setNX must be
+// atomic across all sequencers using the store
+type lockoutStore interface {
+	// get returns false if the key isn't set
+	get(ctx context.Context, key string) (string, bool, error)
+	// setNX sets the key only if it isn't already set, returning whether it
+	// was set
+	setNX(ctx context.Context, key string, value string, timeout time.Duration) (bool, error)
+	set(ctx context.Context, key string, value string, timeout time.Duration) error
+	del(ctx context.Context, key string) error
+}
+
+type lockoutCoordinator struct {
+	store         lockoutStore
+	rpc           string
+	timeout       time.Duration
+	maxLatency    time.Duration
+	seqNumTimeout time.Duration
+}
+
+const LOCKOUT_KEY string = "lockout.lockout"
+const PRIORITIES_KEY string = "lockout.priorities"
+const LIVELINESS_KEY_PREFIX string = "lockout.liveliness."
+const SEQUENCE_NUMBER_KEY string = "lockout.sequenceNumber"
+
+func newLockoutCoordinator(config configuration.Lockout) (*lockoutCoordinator, error) {
+	var store lockoutStore
+	var err error
+	if len(config.Redis) != 0 && len(config.Dir) != 0 {
+		return nil, errors.New("only one of lockout redis and dir can be set")
+	} else if len(config.Redis) != 0 {
+		store, err = newRedisLockoutStore(config.Redis)
+	} else if len(config.Dir) != 0 {
+		store, err = newFileLockoutStore(config.Dir)
+	} else {
+		return nil, errors.New("no lockout backend configured")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lockoutCoordinator{
+		store:         store,
+		rpc:           config.SelfRPCURL,
+		timeout:       config.Timeout,
+		maxLatency:    config.MaxLatency,
+		seqNumTimeout: config.SeqNumTimeout,
+	}, nil
+}
+
+func withRetry(ctx context.Context, f func() error) {
+	backoff := time.Millisecond * 100
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Warn().Msg("lockout context canceled")
+			return
+		default:
+		}
+		err := errors.WithStack(f())
+		if err == nil {
+			return
+		}
+		logger.Warn().Err(err).Msg("lockout store error")
+		time.Sleep(backoff)
+		if backoff < time.Second*2 {
+			backoff *= 2
+		}
+	}
+}
+
+func withTimeout(parentCtx context.Context, timeout time.Time, f func(context.Context) error) {
+	if timeout.Before(time.Now()) {
+		return
+	}
+	timedCtx, cancelTimedCtx := context.WithDeadline(parentCtx, timeout)
+	withRetry(timedCtx, func() error {
+		return f(timedCtx)
+	})
+	cancelTimedCtx()
+}
+
+// selectSequencer returns the highest priority live sequencer other than
+// skip, or the empty string if there isn't one
+func (r *lockoutCoordinator) selectSequencer(ctx context.Context, skip string) (targetSequencer string) {
+	withRetry(ctx, func() error {
+		prioritiesString, ok, err := r.store.get(ctx, PRIORITIES_KEY)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("sequencer priorities unset")
+		}
+		priorities := strings.Split(prioritiesString, ",")
+		for _, rpc := range priorities {
+			if rpc == skip {
+				continue
+			}
+			_, ok, err := r.store.get(ctx, LIVELINESS_KEY_PREFIX+rpc)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			targetSequencer = rpc
+			return nil
+		}
+		targetSequencer = ""
+		return nil
+	})
+	return
+}
+
+func (r *lockoutCoordinator) acquireGenericLockout(ctx context.Context, key string, value string, timeout time.Duration, new bool) (hasLockUntil time.Time) {
+	withRetry(ctx, func() error {
+		attemptingLockUntil := time.Now().Add(timeout)
+		var created bool
+		var err error
+		if new {
+			created, err = r.store.setNX(ctx, key, value, timeout)
+		} else {
+			err = r.store.set(ctx, key, value, timeout)
+			created = true
+		}
+		if err != nil {
+			return err
+		}
+		if created {
+			hasLockUntil = attemptingLockUntil
+		}
+		return nil
+	})
+	return
+}
+
+// This series of methods reads and then possibly modifies hasLockUntil via a pointer.
+// This ensures that the lockout isn't overrun when it is used, and that the new value is updated.
+
+func (r *lockoutCoordinator) acquireOrUpdateGenericLockout(ctx context.Context, key string, value string, hasLockUntil *time.Time) {
+	if hasLockUntil.Before(time.Now()) {
+		*hasLockUntil = r.acquireGenericLockout(ctx, key, value, r.timeout, true)
+	} else {
+		timedCtx, cancelTimedCtx := context.WithDeadline(ctx, *hasLockUntil)
+		*hasLockUntil = r.acquireGenericLockout(timedCtx, key, value, r.timeout, false)
+		cancelTimedCtx()
+	}
+	if *hasLockUntil != (time.Time{}) {
+		*hasLockUntil = hasLockUntil.Add(-r.maxLatency)
+	}
+}
+
+func (r *lockoutCoordinator) releaseGenericLockout(parentCtx context.Context, key string, hasLockUntil *time.Time) {
+	timeout := *hasLockUntil
+	*hasLockUntil = time.Time{}
+	withTimeout(parentCtx, timeout, func(timedCtx context.Context) error {
+		return r.store.del(timedCtx, key)
+	})
+}
+
+func (r *lockoutCoordinator) acquireOrUpdateLockout(ctx context.Context, hasLockUntil *time.Time) {
+	r.acquireOrUpdateGenericLockout(ctx, LOCKOUT_KEY, r.rpc, hasLockUntil)
+}
+
+func (r *lockoutCoordinator) releaseLockout(ctx context.Context, hasLockUntil *time.Time) {
+	r.releaseGenericLockout(ctx, LOCKOUT_KEY, hasLockUntil)
+}
+
+func (r *lockoutCoordinator) acquireOrUpdateLiveliness(ctx context.Context, hasLockUntil *time.Time) {
+	r.acquireOrUpdateGenericLockout(ctx, LIVELINESS_KEY_PREFIX+r.rpc, "OK", hasLockUntil)
+}
+
+func (r *lockoutCoordinator) releaseLiveliness(ctx context.Context, hasLockUntil *time.Time) {
+	r.releaseGenericLockout(ctx, LIVELINESS_KEY_PREFIX+r.rpc, hasLockUntil)
+}
+
+func (r *lockoutCoordinator) getLockout(ctx context.Context) (rpc string) {
+	withRetry(ctx, func() error {
+		var err error
+		rpc, _, err = r.store.get(ctx, LOCKOUT_KEY)
+		return err
+	})
+	return
+}
+
+func (r *lockoutCoordinator) getLatestSeqNum(ctx context.Context) (seqNum *big.Int) {
+	withRetry(ctx, func() error {
+		seqNumString, ok, err := r.store.get(ctx, SEQUENCE_NUMBER_KEY)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			seqNum = big.NewInt(0)
+			return nil
+		}
+		seqNum, ok = new(big.Int).SetString(seqNumString, 10)
+		if !ok {
+			return errors.New("invalid sequence number in lockout store")
+		}
+		return nil
+	})
+	return
+}
+
+func (r *lockoutCoordinator) updateLatestSeqNum(parentCtx context.Context, seqNum *big.Int, hasLockUntil time.Time) {
+	withTimeout(parentCtx, hasLockUntil, func(timedCtx context.Context) error {
+		return r.store.set(timedCtx, SEQUENCE_NUMBER_KEY, seqNum.String(), r.seqNumTimeout)
+	})
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	fileLockoutStateName      = "lockout.json"
+	fileLockoutLockName       = "lockout.lock"
+	fileLockoutPrioritiesName = "priorities"
+	fileLockoutPollInterval   = 10 * time.Millisecond
+)
+
+type fileLockoutEntry struct {
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// fileLockoutStore keeps the lockout state in a directory shared by
+// sequencers on the same host, with an flock on a separate file making
+// each operation atomic. The sequencer priorities are read from the
+// priorities file in the directory, a comma separated list of RPC URLs
+// like the lockout.priorities key in redis
+type fileLockoutStore struct {
+	dir string
+}
+
+func newFileLockoutStore(dir string) (*fileLockoutStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "error creating lockout directory")
+	}
+	return &fileLockoutStore{dir: dir}, nil
+}
+
+// withLock runs f with the directory locked against other sequencers,
+// giving up if ctx is done before the lock is acquired
+func (s *fileLockoutStore) withLock(ctx context.Context, f func() error) error {
+	file, err := os.OpenFile(filepath.Join(s.dir, fileLockoutLockName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK && err != syscall.EINTR {
+			return errors.Wrap(err, "error locking lockout directory")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(fileLockoutPollInterval):
+		}
+	}
+	defer func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	}()
+	return f()
+}
+
+// Must be called with the lock held. Expired entries are left out
+func (s *fileLockoutStore) readState() (map[string]fileLockoutEntry, error) {
+	state := make(map[string]fileLockoutEntry)
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, fileLockoutStateName))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.Wrap(err, "invalid lockout state file")
+	}
+	now := time.Now()
+	for key, entry := range state {
+		if !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt) {
+			delete(state, key)
+		}
+	}
+	return state, nil
+}
+
+// Must be called with the lock held. The state is written to a temporary
+// file and renamed so that a crash can't leave it partially written
+func (s *fileLockoutStore) writeState(state map[string]fileLockoutEntry) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmpPath := filepath.Join(s.dir, fileLockoutStateName+".tmp")
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(s.dir, fileLockoutStateName))
+}
+
+func (s *fileLockoutStore) get(ctx context.Context, key string) (value string, ok bool, err error) {
+	if key == PRIORITIES_KEY {
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, fileLockoutPrioritiesName))
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return strings.TrimSpace(string(data)), true, nil
+	}
+	err = s.withLock(ctx, func() error {
+		state, err := s.readState()
+		if err != nil {
+			return err
+		}
+		var entry fileLockoutEntry
+		entry, ok = state[key]
+		value = entry.Value
+		return nil
+	})
+	return
+}
+
+func (s *fileLockoutStore) update(ctx context.Context, f func(state map[string]fileLockoutEntry) bool) error {
+	return s.withLock(ctx, func() error {
+		state, err := s.readState()
+		if err != nil {
+			return err
+		}
+		if !f(state) {
+			return nil
+		}
+		return s.writeState(state)
+	})
+}
+
+func newFileLockoutEntry(value string, timeout time.Duration) fileLockoutEntry {
+	entry := fileLockoutEntry{Value: value}
+	if timeout > 0 {
+		entry.ExpiresAt = time.Now().Add(timeout)
+	}
+	return entry
+}
+
+func (s *fileLockoutStore) setNX(ctx context.Context, key string, value string, timeout time.Duration) (bool, error) {
+	var created bool
+	err := s.update(ctx, func(state map[string]fileLockoutEntry) bool {
+		if _, ok := state[key]; ok {
+			return false
+		}
+		state[key] = newFileLockoutEntry(value, timeout)
+		created = true
+		return true
+	})
+	return created, err
+}
+
+func (s *fileLockoutStore) set(ctx context.Context, key string, value string, timeout time.Duration) error {
+	return s.update(ctx, func(state map[string]fileLockoutEntry) bool {
+		state[key] = newFileLockoutEntry(value, timeout)
+		return true
+	})
+}
+
+func (s *fileLockoutStore) del(ctx context.Context, key string) error {
+	return s.update(ctx, func(state map[string]fileLockoutEntry) bool {
+		delete(state, key)
+		return true
+	})
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+func newTestFileLockoutStores(t *testing.T, count int) []*fileLockoutStore {
+	t.Helper()
+	dir := t.TempDir()
+	stores := make([]*fileLockoutStore, 0, count)
+	for i := 0; i < count; i++ {
+		store, err := newFileLockoutStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, store)
+	}
+	return stores
+}
+
+func checkFileLockoutValue(t *testing.T, store *fileLockoutStore, key string, expected string, expectedOk bool) {
+	t.Helper()
+	value, ok, err := store.get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != expectedOk || value != expected {
+		t.Errorf("expected %v (%v) for %v, got %v (%v)", expected, expectedOk, key, value, ok)
+	}
+}
+
+func TestFileLockoutSetNX(t *testing.T) {
+	ctx := context.Background()
+	stores := newTestFileLockoutStores(t, 2)
+
+	// Each store races the other for a fresh key every round
+	for round := 0; round < 20; round++ {
+		key := fmt.Sprintf("key%v", round)
+		var wg sync.WaitGroup
+		created := make([]bool, len(stores))
+		errs := make([]error, len(stores))
+		for i, store := range stores {
+			wg.Add(1)
+			go func(i int, store *fileLockoutStore) {
+				defer wg.Done()
+				created[i], errs[i] = store.setNX(ctx, key, fmt.Sprintf("store%v", i), 0)
+			}(i, store)
+		}
+		wg.Wait()
+		winner := -1
+		for i := range stores {
+			if errs[i] != nil {
+				t.Fatal(errs[i])
+			}
+			if created[i] {
+				if winner >= 0 {
+					t.Fatal("both stores created", key)
+				}
+				winner = i
+			}
+		}
+		if winner < 0 {
+			t.Fatal("neither store created", key)
+		}
+		for _, store := range stores {
+			checkFileLockoutValue(t, store, key, fmt.Sprintf("store%v", winner), true)
+		}
+	}
+
+	// An existing key is left alone by setNX but replaced by set
+	created, err := stores[1].setNX(ctx, "key0", "other", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Error("setNX replaced existing key")
+	}
+	if err := stores[1].set(ctx, "key0", "other", 0); err != nil {
+		t.Fatal(err)
+	}
+	checkFileLockoutValue(t, stores[0], "key0", "other", true)
+	if err := stores[0].del(ctx, "key0"); err != nil {
+		t.Fatal(err)
+	}
+	checkFileLockoutValue(t, stores[1], "key0", "", false)
+}
+
+func TestFileLockoutExpiry(t *testing.T) {
+	ctx := context.Background()
+	stores := newTestFileLockoutStores(t, 2)
+	if err := stores[0].set(ctx, LOCKOUT_KEY, "a", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores[0].set(ctx, LIVELINESS_KEY_PREFIX+"a", "OK", 0); err != nil {
+		t.Fatal(err)
+	}
+	checkFileLockoutValue(t, stores[1], LOCKOUT_KEY, "a", true)
+	created, err := stores[1].setNX(ctx, LOCKOUT_KEY, "b", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Fatal("took lockout before it expired")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	checkFileLockoutValue(t, stores[1], LOCKOUT_KEY, "", false)
+	created, err = stores[1].setNX(ctx, LOCKOUT_KEY, "b", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Fatal("couldn't take expired lockout")
+	}
+	checkFileLockoutValue(t, stores[0], LOCKOUT_KEY, "b", true)
+
+	// Entries without a timeout never expire
+	checkFileLockoutValue(t, stores[1], LIVELINESS_KEY_PREFIX+"a", "OK", true)
+}
+
+func TestFileLockoutPriorities(t *testing.T) {
+	ctx := context.Background()
+	stores := newTestFileLockoutStores(t, 2)
+	checkFileLockoutValue(t, stores[0], PRIORITIES_KEY, "", false)
+
+	prioritiesPath := filepath.Join(stores[0].dir, fileLockoutPrioritiesName)
+	if err := ioutil.WriteFile(prioritiesPath, []byte("a,b,c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkFileLockoutValue(t, stores[1], PRIORITIES_KEY, "a,b,c", true)
+
+	// The priorities come from the file, not the shared state
+	if err := stores[0].set(ctx, PRIORITIES_KEY, "c", 0); err != nil {
+		t.Fatal(err)
+	}
+	checkFileLockoutValue(t, stores[1], PRIORITIES_KEY, "a,b,c", true)
+
+	coordinator, err := newLockoutCoordinator(configuration.Lockout{Dir: stores[0].dir, SelfRPCURL: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selected := coordinator.selectSequencer(ctx, ""); selected != "" {
+		t.Error("selected sequencer which isn't live", selected)
+	}
+	for _, rpc := range []string{"a", "c"} {
+		if err := stores[1].set(ctx, LIVELINESS_KEY_PREFIX+rpc, "OK", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if selected := coordinator.selectSequencer(ctx, ""); selected != "a" {
+		t.Error("expected highest priority sequencer, got", selected)
+	}
+	if selected := coordinator.selectSequencer(ctx, "a"); selected != "c" {
+		t.Error("expected next live sequencer, got", selected)
+	}
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+const handoverQueuePollInterval = 10 * time.Millisecond
+
+// New transactions are held at most this long during a handover. Posting the
+// final batch waits for it to be included on L1, which can take a while
+const handoverMaxTxHold = time.Minute
+
+// How long to keep trying to forward held transactions after a handover
+const handoverForwardTimeout = 5 * time.Minute
+
+var errHandoverUnposted = errors.New("messages were sequenced after the final batch")
+
+var errHandoverInProgress = errors.New("sequencer handover in progress, try again")
+
+// handoverBatcher holds new transactions while the sequencer is handing
+// over, then passes them on to whichever batcher the LockoutBatcher has
+// switched to, normally a forwarder to the new sequencer
+type handoverBatcher struct {
+	lockout *LockoutBatcher
+	done    chan struct{}
+}
+
+func (h *handoverBatcher) PendingTransactionCount(ctx context.Context, account common.Address) (*uint64, error) {
+	return h.lockout.sequencerBatcher.PendingTransactionCount(ctx, account)
+}
+
+// SendTransaction waits for the handover to finish and then passes tx on.
+// Rather than hold the caller until the final batch is included on L1, it
+// gives up after handoverMaxTxHold so the caller can retry
+func (h *handoverBatcher) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	timer := time.NewTimer(handoverMaxTxHold)
+	defer timer.Stop()
+	select {
+	case <-h.done:
+	case <-timer.C:
+		return errHandoverInProgress
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return h.lockout.getBatcher().SendTransaction(ctx, tx)
+}
+
+func (h *handoverBatcher) PendingSnapshot(ctx context.Context) (*snapshot.Snapshot, error) {
+	return h.lockout.sequencerBatcher.PendingSnapshot(ctx)
+}
+
+func (h *handoverBatcher) Aggregator() *common.Address {
+	return h.lockout.sequencerBatcher.Aggregator()
+}
+
+func (h *handoverBatcher) TxPoolContent() *batcher.TxPoolContent {
+	return h.lockout.sequencerBatcher.TxPoolContent()
+}
+
+func (h *handoverBatcher) Start(_ context.Context) {
+}
+
+func (b *LockoutBatcher) HandoverInProgress() bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.handover != nil
+}
+
+// Handover gives up the sequencer lockout without losing transactions. New
+// transactions are held and then forwarded to the incoming sequencer, the
+// queue is drained, and a final batch is posted before the lockout is
+// released. Transactions held waiting for a nonce gap are forwarded to the
+// incoming sequencer too. Afterwards this node won't try to sequence again
+// until it's restarted. If ctx is canceled first, the node resumes sequencing
+func (b *LockoutBatcher) Handover(ctx context.Context) error {
+	incoming := b.coordinator.selectSequencer(ctx, b.config.SelfRPCURL)
+	if incoming == "" {
+		return errors.New("no other sequencer is available to hand over to")
+	}
+
+	b.mutex.Lock()
+	if b.handover != nil {
+		b.mutex.Unlock()
+		return errors.New("handover already in progress")
+	}
+	if b.currentBatcher != b.sequencerBatcher || !b.hasSequencerLockout() {
+		b.mutex.Unlock()
+		return errors.New("not the active sequencer")
+	}
+	handover := &handoverBatcher{lockout: b, done: make(chan struct{})}
+	b.handover = handover
+	b.mutex.Unlock()
+	logger.Info().Str("incoming", incoming).Msg("starting sequencer handover")
+
+	completed := false
+	defer func() {
+		if !completed {
+			b.mutex.Lock()
+			b.handover = nil
+			b.mutex.Unlock()
+			logger.Warn().Msg("sequencer handover aborted")
+		}
+		close(handover.done)
+	}()
+
+	// Transactions held for a nonce gap won't drain as nothing new is being
+	// sequenced, so they're forwarded once the lockout has been released
+	for {
+		queued, _ := b.sequencerBatcher.QueueDepth()
+		if queued == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(handoverQueuePollInterval):
+		}
+	}
+	logger.Info().Msg("sequencer queue drained for handover")
+
+	for {
+		if err := b.sequencerBatcher.WaitForBatchesPosted(ctx); err != nil {
+			return errors.Wrap(err, "error posting final batch")
+		}
+		logger.Info().Msg("final batch posted for handover")
+
+		resultChan := make(chan error, 1)
+		select {
+		case b.handoverRequests <- resultChan:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		err := <-resultChan
+		if err == nil {
+			completed = true
+			logger.Info().Str("incoming", incoming).Msg("released sequencer lockout for handover")
+			held := b.sequencerBatcher.TakeHeldTransactions()
+			if len(held) > 0 {
+				go b.forwardHeldTransactions(held)
+			}
+			return nil
+		}
+		if err != errHandoverUnposted {
+			return err
+		}
+		// Delayed messages were sequenced while the batch was posted
+	}
+}
+
+// completeHandover is called by the lockout manager to release the lockout
+// once everything sequenced has been posted. On success the mutex is left
+// locked so that held transactions wait until the new sequencer is chosen
+func (b *LockoutBatcher) completeHandover(ctx context.Context) error {
+	b.inboxReader.MessageDeliveryMutex.Lock()
+	defer b.inboxReader.MessageDeliveryMutex.Unlock()
+	b.mutex.Lock()
+	if b.currentBatcher != b.sequencerBatcher || !b.hasSequencerLockout() {
+		b.mutex.Unlock()
+		return errors.New("lost sequencer lockout during handover")
+	}
+	posted, err := b.sequencerBatcher.BatchesPosted(ctx)
+	if err == nil && !posted {
+		err = errHandoverUnposted
+	}
+	var seqNum *big.Int
+	if err == nil {
+		seqNum, err = b.core.GetMessageCount()
+	}
+	if err != nil {
+		b.mutex.Unlock()
+		return err
+	}
+	b.coordinator.updateLatestSeqNum(ctx, seqNum, b.lockoutExpiresAt)
+	b.coordinator.releaseLockout(ctx, &b.lockoutExpiresAt)
+	b.coordinator.releaseLiveliness(ctx, &b.livelinessExpiresAt)
+	b.handedOver = true
+	b.lastLockedSeqNum = seqNum
+	b.currentBatcher = b.getErrorBatcher(errors.New("sequencer handed over"))
+	b.currentSeq = "[handed over]"
+	b.handover = nil
+	return nil
+}
+
+// forwardHeldTransactions passes on transactions that were held waiting for
+// a nonce gap when the lockout was released, in nonce order. It waits for
+// the lockout manager to start forwarding to the incoming sequencer
+func (b *LockoutBatcher) forwardHeldTransactions(txes []*types.Transaction) {
+	ctx, cancel := context.WithTimeout(context.Background(), handoverForwardTimeout)
+	defer cancel()
+	logger.Info().Int("count", len(txes)).Msg("forwarding held transactions after handover")
+	for _, tx := range txes {
+		if err := b.getBatcher().SendTransaction(ctx, tx); err != nil {
+			logger.Warn().Err(err).Str("hash", tx.Hash().String()).Msg("failed to forward held transaction")
+		}
+	}
+}
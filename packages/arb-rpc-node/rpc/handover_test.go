@@ -0,0 +1,336 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	ethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+)
+
+// handoverTestSequencer stands in for the SequencerBatcher, with the queue
+// depth and whether everything is posted controlled by the test
+type handoverTestSequencer struct {
+	queuedAtomic int64
+	postedAtomic int32
+	sentAtomic   int32
+
+	mutex sync.Mutex
+	held  []*types.Transaction
+}
+
+func (s *handoverTestSequencer) PendingTransactionCount(_ context.Context, _ common.Address) (*uint64, error) {
+	return nil, nil
+}
+
+func (s *handoverTestSequencer) SendTransaction(_ context.Context, _ *types.Transaction) error {
+	atomic.AddInt32(&s.sentAtomic, 1)
+	return nil
+}
+
+func (s *handoverTestSequencer) PendingSnapshot(_ context.Context) (*snapshot.Snapshot, error) {
+	return nil, nil
+}
+
+func (s *handoverTestSequencer) Aggregator() *common.Address {
+	return &common.Address{}
+}
+
+func (s *handoverTestSequencer) Start(_ context.Context) {
+}
+
+func (s *handoverTestSequencer) TxPoolContent() *batcher.TxPoolContent {
+	return nil
+}
+
+func (s *handoverTestSequencer) ReplayJournal(_ context.Context) error {
+	return nil
+}
+
+func (s *handoverTestSequencer) SequenceDelayedMessages(_ context.Context, _ bool) error {
+	return nil
+}
+
+func (s *handoverTestSequencer) QueueDepth() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return int(atomic.LoadInt64(&s.queuedAtomic)), len(s.held)
+}
+
+func (s *handoverTestSequencer) TakeHeldTransactions() []*types.Transaction {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	held := s.held
+	s.held = nil
+	return held
+}
+
+func (s *handoverTestSequencer) WaitForBatchesPosted(ctx context.Context) error {
+	for atomic.LoadInt32(&s.postedAtomic) == 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+func (s *handoverTestSequencer) BatchesPosted(_ context.Context) (bool, error) {
+	return atomic.LoadInt32(&s.postedAtomic) != 0, nil
+}
+
+type handoverTestCore struct {
+	core.ArbOutputLookup
+	msgCount *big.Int
+}
+
+func (c *handoverTestCore) GetMessageCount() (*big.Int, error) {
+	return c.msgCount, nil
+}
+
+// handoverTestIncoming is the RPC of the sequencer being handed over to
+type handoverTestIncoming struct {
+	mutex  sync.Mutex
+	nonces []uint64
+}
+
+func (s *handoverTestIncoming) SendRawTransaction(_ context.Context, data hexutil.Bytes) (ethcommon.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(data); err != nil {
+		return ethcommon.Hash{}, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nonces = append(s.nonces, tx.Nonce())
+	return tx.Hash(), nil
+}
+
+func (s *handoverTestIncoming) GetAggregator() *batcher.AggregatorInfo {
+	return &batcher.AggregatorInfo{Address: &ethcommon.Address{}}
+}
+
+func (s *handoverTestIncoming) received() []uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]uint64{}, s.nonces...)
+}
+
+func newHandoverTestIncoming(t *testing.T, service *handoverTestIncoming) *httptest.Server {
+	server := ethrpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("arb", service); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(server)
+}
+
+func newHandoverTestLockout(t *testing.T, seq *handoverTestSequencer, priorities string) *LockoutBatcher {
+	config := configuration.Lockout{
+		Dir:           t.TempDir(),
+		SelfRPCURL:    "self",
+		Timeout:       30 * time.Second,
+		MaxLatency:    time.Second,
+		SeqNumTimeout: time.Minute,
+	}
+	if err := ioutil.WriteFile(filepath.Join(config.Dir, fileLockoutPrioritiesName), []byte(priorities), 0644); err != nil {
+		t.Fatal(err)
+	}
+	coordinator, err := newLockoutCoordinator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &LockoutBatcher{
+		sequencerBatcher: seq,
+		currentSeq:       "[starting up]",
+		core:             &handoverTestCore{msgCount: big.NewInt(10)},
+		inboxReader:      &monitor.InboxReader{},
+		config:           config,
+		coordinator:      coordinator,
+		errChan:          make(chan error, 1),
+		handoverRequests: make(chan chan error),
+	}
+	b.currentBatcher = b.getErrorBatcher(errors.New("sequencer lockout manager starting up"))
+	return b
+}
+
+func setHandoverTestLive(t *testing.T, b *LockoutBatcher, rpc string) {
+	t.Helper()
+	if err := b.coordinator.store.set(context.Background(), LIVELINESS_KEY_PREFIX+rpc, "OK", 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// makeHandoverTestActive gives the lockout to b as if the lockout manager had
+// acquired it
+func makeHandoverTestActive(b *LockoutBatcher) {
+	ctx := context.Background()
+	b.coordinator.acquireOrUpdateLiveliness(ctx, &b.livelinessExpiresAt)
+	b.coordinator.acquireOrUpdateLockout(ctx, &b.lockoutExpiresAt)
+	b.currentBatcher = b.sequencerBatcher
+	b.currentSeq = b.config.SelfRPCURL
+}
+
+func TestHandoverRequiresActiveSequencer(t *testing.T) {
+	ctx := context.Background()
+	b := newHandoverTestLockout(t, &handoverTestSequencer{}, "self,incoming")
+	if err := b.Handover(ctx); err == nil {
+		t.Error("handed over with no other sequencer live")
+	}
+
+	setHandoverTestLive(t, b, "incoming")
+	if err := b.Handover(ctx); err == nil {
+		t.Error("handed over without the lockout")
+	}
+	if b.HandoverInProgress() {
+		t.Error("handover left in progress after failing")
+	}
+}
+
+func TestCompleteHandover(t *testing.T) {
+	ctx := context.Background()
+	seq := &handoverTestSequencer{}
+	b := newHandoverTestLockout(t, seq, "self,incoming")
+	makeHandoverTestActive(b)
+
+	if err := b.completeHandover(ctx); err != errHandoverUnposted {
+		t.Fatal("expected unposted messages to block handover, got", err)
+	}
+	if !b.ShouldSequence() || b.coordinator.getLockout(ctx) != "self" {
+		t.Fatal("lost lockout after failed handover")
+	}
+
+	atomic.StoreInt32(&seq.postedAtomic, 1)
+	if err := b.completeHandover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The mutex is left locked for the lockout manager
+	b.mutex.Unlock()
+	if b.ShouldSequence() || !b.handedOver {
+		t.Error("still sequencing after handover")
+	}
+	if lockout := b.coordinator.getLockout(ctx); lockout != "" {
+		t.Error("lockout not released, held by", lockout)
+	}
+	if seqNum := b.coordinator.getLatestSeqNum(ctx); seqNum.Cmp(big.NewInt(10)) != 0 {
+		t.Error("wrong latest sequence number", seqNum)
+	}
+	if err := b.SendTransaction(ctx, types.NewTx(&types.LegacyTx{})); err == nil {
+		t.Error("sequenced transaction after handover")
+	}
+}
+
+func TestHandoverToIncomingSequencer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	incomingService := &handoverTestIncoming{}
+	incoming := newHandoverTestIncoming(t, incomingService)
+	defer incoming.Close()
+
+	seq := &handoverTestSequencer{}
+	b := newHandoverTestLockout(t, seq, "self,"+incoming.URL)
+	go b.lockoutManager(ctx)
+	for attempts := 0; !b.ShouldSequence(); attempts++ {
+		if attempts == 100 {
+			t.Fatal("lockout manager didn't acquire lockout")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	setHandoverTestLive(t, b, incoming.URL)
+
+	// One transaction is still being sequenced and another is held for a
+	// nonce gap
+	atomic.StoreInt64(&seq.queuedAtomic, 1)
+	seq.held = []*types.Transaction{types.NewTx(&types.LegacyTx{Nonce: 2})}
+
+	handoverResult := make(chan error, 1)
+	go func() {
+		handoverResult <- b.Handover(ctx)
+	}()
+	for !b.HandoverInProgress() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sendResult := make(chan error, 1)
+	go func() {
+		sendResult <- b.SendTransaction(ctx, types.NewTx(&types.LegacyTx{Nonce: 1}))
+	}()
+
+	select {
+	case err := <-handoverResult:
+		t.Fatal("handover finished before the queue drained", err)
+	case err := <-sendResult:
+		t.Fatal("transaction not held during handover", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	atomic.StoreInt64(&seq.queuedAtomic, 0)
+	atomic.StoreInt32(&seq.postedAtomic, 1)
+	select {
+	case err := <-handoverResult:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("handover didn't finish")
+	}
+	if seqNum := b.coordinator.getLatestSeqNum(ctx); seqNum.Cmp(big.NewInt(10)) != 0 {
+		t.Error("wrong latest sequence number", seqNum)
+	}
+
+	// The incoming sequencer takes the lockout once it's caught up
+	if err := b.coordinator.store.set(ctx, LOCKOUT_KEY, incoming.URL, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-sendResult:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("held transaction wasn't forwarded")
+	}
+	for attempts := 0; len(incomingService.received()) < 2; attempts++ {
+		if attempts == 100 {
+			t.Fatal("transactions not forwarded to incoming sequencer", incomingService.received())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&seq.sentAtomic) != 0 {
+		t.Error("transaction sent to outgoing sequencer")
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
 	utils2 "github.com/offchainlabs/arbitrum/packages/arb-rpc-node/utils"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcaster"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
@@ -89,12 +90,28 @@ func SetupBatcher(
 	config *configuration.Config,
 	walletConfig *configuration.Wallet,
 ) (batcher.TransactionBatcher, chan error, error) {
+	txFilter, err := batcher.NewTxFilterFromConfig(config.Node.TxFilter)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error loading transaction filter")
+	}
 	switch batcherMode := batcherMode.(type) {
 	case ForwarderBatcherMode:
 		newBatcher, err := batcher.NewForwarder(ctx, batcherMode.Config)
 		if err != nil {
 			return nil, nil, err
 		}
+		newBatcher.SetTxFilter(txFilter)
+		forwarderConfig := batcherMode.Config
+		if len(forwarderConfig.LockoutRedis) != 0 || len(forwarderConfig.LockoutDir) != 0 {
+			coordinator, err := newLockoutCoordinator(configuration.Lockout{
+				Redis: forwarderConfig.LockoutRedis,
+				Dir:   forwarderConfig.LockoutDir,
+			})
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "error connecting to sequencer lockout")
+			}
+			newBatcher.SetActiveTargetSource(coordinator.getLockout)
+		}
 		return newBatcher, nil, nil
 	case ErrorBatcherMode:
 		return &ErrorBatcher{err: batcherMode.Error}, nil, nil
@@ -117,6 +134,7 @@ func SetupBatcher(
 		if err != nil {
 			return nil, nil, err
 		}
+		newBatcher.SetTxFilter(txFilter)
 		return newBatcher, nil, nil
 	case StatefulBatcherMode:
 		var auth transactauth.TransactAuth
@@ -137,6 +155,7 @@ func SetupBatcher(
 		if err != nil {
 			return nil, nil, err
 		}
+		newBatcher.SetTxFilter(txFilter)
 		return newBatcher, nil, nil
 	case SequencerBatcherMode:
 		rollup, err := ethbridgecontracts.NewRollupUserFacet(rollupAddress.ToEthAddress(), client)
@@ -164,6 +183,7 @@ func SetupBatcher(
 			batcherMode.Auth,
 			dataSigner,
 			feedBroadcaster,
+			txFilter,
 			config,
 			walletConfig)
 		if err != nil {
@@ -181,6 +201,13 @@ func SetupBatcher(
 }
 
 func LaunchPublicServer(ctx context.Context, web3Server *rpc.Server, rpc configuration.RPC, ws configuration.WS) error {
+	rpcHandler, err := web3.ClientIPHandler(web3Server, rpc.RateLimit.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	if rpc.RateLimit.IPRate > 0 && ws.Port != "" {
+		logger.Warn().Msg("per-IP transaction rate limit doesn't apply to websocket requests")
+	}
 	if rpc.Port == ws.Port && rpc.Port != "" {
 		if rpc.Addr != ws.Addr {
 			return errors.New("if serving on same port, rpc and ws addreses must be the same")
@@ -188,13 +215,13 @@ func LaunchPublicServer(ctx context.Context, web3Server *rpc.Server, rpc configu
 		if rpc.Path == ws.Path {
 			return errors.New("if serving on same port, ws and rpc path must be different")
 		}
-		return utils2.LaunchRPCAndWS(ctx, web3Server, rpc.Addr, rpc.Port, rpc.Path, ws.Path)
+		return utils2.LaunchRPCAndWS(ctx, web3Server, rpcHandler, rpc.Addr, rpc.Port, rpc.Path, ws.Path)
 	}
 
 	errChan := make(chan error, 1)
 	if rpc.Port != "" {
 		go func() {
-			errChan <- utils2.LaunchRPC(ctx, web3Server, rpc.Addr, rpc.Port, rpc.Path)
+			errChan <- utils2.LaunchRPC(ctx, rpcHandler, rpc.Addr, rpc.Port, rpc.Path)
 		}()
 	}
 	if ws.Port != "" {
@@ -36,13 +36,26 @@ import (
 
 var logger = arblog.Logger.With().Str("component", "rpc").Logger()
 
+// lockoutSequencer is the sequencer a LockoutBatcher uses while it holds
+// the lockout, implemented by batcher.SequencerBatcher
+type lockoutSequencer interface {
+	batcher.TransactionBatcher
+	batcher.TxPoolReader
+	ReplayJournal(ctx context.Context) error
+	SequenceDelayedMessages(ctx context.Context, bypassLockout bool) error
+	QueueDepth() (int, int)
+	TakeHeldTransactions() []*types.Transaction
+	WaitForBatchesPosted(ctx context.Context) error
+	BatchesPosted(ctx context.Context) (bool, error)
+}
+
 type LockoutBatcher struct {
 	// Mutex protects currentBatcher and lockoutExpiresAt
 	mutex            sync.RWMutex
-	sequencerBatcher *batcher.SequencerBatcher
+	sequencerBatcher lockoutSequencer
 	core             core.ArbOutputLookup
 	inboxReader      *monitor.InboxReader
-	redis            *lockoutRedis
+	coordinator      *lockoutCoordinator
 	errChan          chan error
 	config           configuration.Lockout
 
@@ -52,6 +65,14 @@ type LockoutBatcher struct {
 	lastLockedSeqNum    *big.Int
 	currentBatcher      batcher.TransactionBatcher
 	deadUntil           time.Time
+
+	// Set while a planned handover is in progress, protected by mutex
+	handover *handoverBatcher
+	// Handover requests the lockout manager to release the lockout once
+	// everything has been posted
+	handoverRequests chan chan error
+	// Only accessed by the lockout manager
+	handedOver bool
 }
 
 func SetupLockout(
@@ -62,7 +83,7 @@ func SetupLockout(
 	config configuration.Lockout,
 	errChan chan error,
 ) (*LockoutBatcher, error) {
-	redis, err := newLockoutRedis(config)
+	coordinator, err := newLockoutCoordinator(config)
 	if err != nil {
 		return nil, err
 	}
@@ -72,11 +93,12 @@ func SetupLockout(
 		core:             core,
 		inboxReader:      inboxReader,
 		config:           config,
-		redis:            redis,
+		coordinator:      coordinator,
 		errChan:          errChan,
+		handoverRequests: make(chan chan error),
 	}
 	newBatcher.currentBatcher = newBatcher.getErrorBatcher(errors.New("sequencer lockout manager starting up"))
-	newBatcher.sequencerBatcher.LockoutManager = newBatcher
+	seqBatcher.LockoutManager = newBatcher
 	go newBatcher.lockoutManager(ctx)
 	return newBatcher, nil
 }
@@ -99,8 +121,8 @@ func (b *LockoutBatcher) lockoutManager(ctx context.Context) {
 		}
 		b.currentBatcher = b.getErrorBatcher(errors.New("sequencer lockout manager starting up"))
 		backgroundContext := context.Background()
-		b.redis.releaseLockout(backgroundContext, &b.lockoutExpiresAt)
-		b.redis.releaseLiveliness(backgroundContext, &b.livelinessExpiresAt)
+		b.coordinator.releaseLockout(backgroundContext, &b.lockoutExpiresAt)
+		b.coordinator.releaseLiveliness(backgroundContext, &b.livelinessExpiresAt)
 		b.mutex.Unlock()
 		holdingMutex = false
 		logger.Debug().Msg("shut down sequencer lockout manager and released locks")
@@ -119,7 +141,7 @@ func (b *LockoutBatcher) lockoutManager(ctx context.Context) {
 		}
 	})()
 	for {
-		alive := time.Now().After(b.deadUntil)
+		alive := time.Now().After(b.deadUntil) && !b.handedOver
 		if alive && !b.hasSequencerLockout() {
 			currentSeqNum, err := b.core.GetMessageCount()
 			if err != nil {
@@ -135,31 +157,31 @@ func (b *LockoutBatcher) lockoutManager(ctx context.Context) {
 				alive = false
 				if b.livelinessExpiresAt.After(time.Now()) {
 					logger.Warn().Str("ourSeqNum", currentSeqNum.String()).Str("targetSeqNum", b.lastLockedSeqNum.String()).Msg("fell behind sequencer position")
-					b.redis.releaseLiveliness(ctx, &b.livelinessExpiresAt)
+					b.coordinator.releaseLiveliness(ctx, &b.livelinessExpiresAt)
 				}
 			}
-			b.lastLockedSeqNum = b.redis.getLatestSeqNum(ctx)
+			b.lastLockedSeqNum = b.coordinator.getLatestSeqNum(ctx)
 		}
 		if alive {
-			b.redis.acquireOrUpdateLiveliness(ctx, &b.livelinessExpiresAt)
+			b.coordinator.acquireOrUpdateLiveliness(ctx, &b.livelinessExpiresAt)
 			if b.livelinessExpiresAt.Before(time.Now()) {
 				logger.Warn().Str("rpc", b.config.SelfRPCURL).Msg("failed to acquire liveliness lockout, is another sequencer running with this RPC URL?")
 			}
 		}
-		selectedSeq := b.redis.selectSequencer(ctx)
+		selectedSeq := b.coordinator.selectSequencer(ctx, "")
 		if selectedSeq == b.config.SelfRPCURL {
 			if !holdingMutex {
 				b.mutex.Lock()
 				holdingMutex = true
 			}
 			if b.livelinessExpiresAt.After(time.Now()) {
-				b.redis.acquireOrUpdateLockout(ctx, &b.lockoutExpiresAt)
+				b.coordinator.acquireOrUpdateLockout(ctx, &b.lockoutExpiresAt)
 			}
 			var fatalError error
 			if b.hasSequencerLockout() {
 				if b.currentBatcher != b.sequencerBatcher {
 					logger.Info().Str("rpc", b.config.SelfRPCURL).Msg("acquired sequencer lockout")
-					targetSeqNum := b.redis.getLatestSeqNum(ctx)
+					targetSeqNum := b.coordinator.getLatestSeqNum(ctx)
 					b.lastLockedSeqNum = targetSeqNum
 					attemptCatchupUntil := b.lockoutExpiresAt.Add(-b.config.MaxLatency)
 					for {
@@ -196,6 +218,14 @@ func (b *LockoutBatcher) lockoutManager(ctx context.Context) {
 						case <-time.After(100 * time.Millisecond):
 						}
 					}
+					if fatalError == nil && b.hasSequencerLockout() {
+						// Only replay once we hold the lockout, so we never deliver
+						// or broadcast our journal while another sequencer is active
+						err := b.sequencerBatcher.ReplayJournal(ctx)
+						if err != nil {
+							fatalError = errors.Wrap(err, "failed to replay sequencer journal")
+						}
+					}
 					if fatalError == nil && b.hasSequencerLockout() {
 						err := b.sequencerBatcher.SequenceDelayedMessages(ctx, true)
 						if err != nil {
@@ -216,14 +246,14 @@ func (b *LockoutBatcher) lockoutManager(ctx context.Context) {
 				if fatalError == nil {
 					seqNum, err := b.core.GetMessageCount()
 					if err == nil {
-						b.redis.updateLatestSeqNum(ctx, seqNum, b.lockoutExpiresAt)
+						b.coordinator.updateLatestSeqNum(ctx, seqNum, b.lockoutExpiresAt)
 						b.lastLockedSeqNum = seqNum
 					} else {
 						logger.Warn().Err(err).Msg("error getting sequence number")
 					}
 				} else {
-					b.redis.releaseLockout(ctx, &b.lockoutExpiresAt)
-					b.redis.releaseLiveliness(ctx, &b.livelinessExpiresAt)
+					b.coordinator.releaseLockout(ctx, &b.lockoutExpiresAt)
+					b.coordinator.releaseLiveliness(ctx, &b.livelinessExpiresAt)
 					b.deadUntil = time.Now().Add(SEQUENCER_INIT_FATAL_ERROR_BACKOFF)
 				}
 			}
@@ -240,11 +270,11 @@ func (b *LockoutBatcher) lockoutManager(ctx context.Context) {
 				if b.hasSequencerLockout() {
 					seqNum, err := b.core.GetMessageCount()
 					if err == nil {
-						b.redis.updateLatestSeqNum(ctx, seqNum, b.lockoutExpiresAt)
+						b.coordinator.updateLatestSeqNum(ctx, seqNum, b.lockoutExpiresAt)
 					} else {
 						logger.Warn().Err(err).Msg("error getting sequence number")
 					}
-					b.redis.releaseLockout(ctx, &b.lockoutExpiresAt)
+					b.coordinator.releaseLockout(ctx, &b.lockoutExpiresAt)
 				}
 				b.inboxReader.MessageDeliveryMutex.Unlock()
 				b.currentBatcher = nil
@@ -256,7 +286,7 @@ func (b *LockoutBatcher) lockoutManager(ctx context.Context) {
 				b.currentSeq = selectedSeq
 				b.mutex.Unlock()
 				holdingMutex = false
-			} else if b.redis.getLockout(ctx) == selectedSeq {
+			} else if b.coordinator.getLockout(ctx) == selectedSeq {
 				logger.Info().Str("rpc", selectedSeq).Msg("forwarding to new sequencer")
 				var err error
 				b.currentBatcher, err = batcher.NewForwarder(ctx, configuration.Forwarder{Target: selectedSeq})
@@ -285,6 +315,17 @@ func (b *LockoutBatcher) lockoutManager(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
+		case resultChan := <-b.handoverRequests:
+			if holdingMutex {
+				resultChan <- errors.New("not the active sequencer")
+				break
+			}
+			err := b.completeHandover(ctx)
+			if err == nil {
+				// Keep the mutex until we're forwarding to the new sequencer
+				holdingMutex = true
+			}
+			resultChan <- err
 		case <-time.After(refreshDelay):
 		}
 	}
@@ -304,6 +345,9 @@ func (b *LockoutBatcher) ShouldSequence() bool {
 func (b *LockoutBatcher) getBatcher() batcher.TransactionBatcher {
 	b.mutex.RLock()
 	defer b.mutex.RUnlock()
+	if b.handover != nil {
+		return b.handover
+	}
 	if b.currentBatcher == b.sequencerBatcher && !b.hasSequencerLockout() {
 		return b.getErrorBatcher(errors.New("sequencer lockout expired"))
 	}
@@ -326,6 +370,13 @@ func (b *LockoutBatcher) Aggregator() *common.Address {
 	return b.getBatcher().Aggregator()
 }
 
+func (b *LockoutBatcher) TxPoolContent() *batcher.TxPoolContent {
+	if reader, ok := b.getBatcher().(batcher.TxPoolReader); ok {
+		return reader.TxPoolContent()
+	}
+	return nil
+}
+
 func (b *LockoutBatcher) Start(ctx context.Context) {
 	b.sequencerBatcher.Start(ctx)
 }
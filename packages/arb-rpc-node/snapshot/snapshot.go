@@ -108,13 +108,40 @@ func (s *Snapshot) MaxGasPriceBid() *big.Int {
 // AddMessage can only be called if the snapshot is uniquely owned
 // If an error is returned, s is unmodified
 func (s *Snapshot) AddMessage(ctx context.Context, msg message.Message, sender common.Address, targetHash common.Hash) (*evm.TxResult, error) {
+	res, _, err := s.AddMessageAtTime(ctx, msg, sender, targetHash, nil, false)
+	return res, err
+}
+
+// AddMessageAtTime is like AddMessage, but delivers the message to ArbOS as
+// if it had arrived at the given L1 block number and timestamp, unless
+// chainTime is nil. If trace is set, the debug prints tracing the message's
+// execution are returned as well
+func (s *Snapshot) AddMessageAtTime(
+	ctx context.Context,
+	msg message.Message,
+	sender common.Address,
+	targetHash common.Hash,
+	chainTime *inbox.ChainTime,
+	trace bool,
+) (*evm.TxResult, []value.Value, error) {
+	messageTime := zeroChainTime()
+	if chainTime != nil {
+		messageTime = *chainTime
+	}
 	mach := s.mach.Clone()
-	res, _, err := s.addMessage(ctx, msg, sender, targetHash, addMessageMaxAVMGas, false)
+	res, debugPrints, err := s.addMessage(ctx, msg, sender, targetHash, messageTime, addMessageMaxAVMGas, trace)
 	if err != nil {
 		// Revert the machine
 		s.mach = mach
 	}
-	return res, err
+	return res, debugPrints, err
+}
+
+func zeroChainTime() inbox.ChainTime {
+	return inbox.ChainTime{
+		BlockNum:  common.NewTimeBlocksInt(0),
+		Timestamp: big.NewInt(0),
+	}
 }
 
 const addMessageMaxAVMGas = 100000000000
@@ -126,13 +153,10 @@ func (s *Snapshot) addMessage(
 	msg message.Message,
 	sender common.Address,
 	targetHash common.Hash,
+	chainTime inbox.ChainTime,
 	maxAVMGas uint64,
 	trace bool,
 ) (*evm.TxResult, []value.Value, error) {
-	chainTime := inbox.ChainTime{
-		BlockNum:  common.NewTimeBlocksInt(0),
-		Timestamp: big.NewInt(0),
-	}
 	inboxMsg := message.NewInboxMessage(msg, sender, s.nextInboxSeqNum, big.NewInt(0), chainTime)
 	res, debugPrints, err := runTxUnchecked(ctx, s.mach, inboxMsg, maxAVMGas, trace)
 	if err != nil {
@@ -171,6 +195,10 @@ func (s *Snapshot) Height() *common.TimeBlocks {
 	return s.time.BlockNum
 }
 
+func (s *Snapshot) Timestamp() *big.Int {
+	return s.time.Timestamp
+}
+
 func (s *Snapshot) EstimateGas(
 	ctx context.Context,
 	tx *types.Transaction,
@@ -482,7 +510,7 @@ func (s *Snapshot) AddContractMessage(
 	if s.chainId != nil {
 		targetHash = hashing.SoliditySHA3(hashing.Uint256(s.chainId), hashing.Uint256(s.nextInboxSeqNum))
 	}
-	return s.addMessage(ctx, message.NewSafeL2Message(msg), sender, targetHash, maxAVMGas, trace)
+	return s.addMessage(ctx, message.NewSafeL2Message(msg), sender, targetHash, zeroChainTime(), maxAVMGas, trace)
 }
 
 func (s *Snapshot) addArbosTestMessage(ctx context.Context, data []byte) error {
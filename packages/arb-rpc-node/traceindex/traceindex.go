@@ -0,0 +1,387 @@
+/*
+* Copyright 2021, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package traceindex
+
+import (
+	"context"
+	"encoding/binary"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arblog"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+var logger = arblog.Logger.With().Str("component", "traceindex").Logger()
+
+// Tracing a block starts from the machine at the end of the previous block,
+// so the genesis block isn't indexed
+const firstIndexedBlock = 1
+
+const (
+	roleSender   byte = 1
+	roleReceiver byte = 2
+)
+
+var (
+	headKey         = []byte("h")
+	addressPrefix   = []byte("a")
+	blockListPrefix = []byte("b")
+)
+
+// Index records which blocks and transactions each address appears in as
+// the sender or receiver of a trace frame. Blocks are traced in the
+// background as the TxDB adds them, so the index may lag behind the chain
+type Index struct {
+	db     ethdb.Database
+	driver *txdb.IndexDriver
+}
+
+// builder traces blocks for the index's driver
+type builder struct {
+	txDB       *txdb.TxDB
+	db         ethdb.Database
+	coreConfig *configuration.Core
+}
+
+func New(txDB *txdb.TxDB, coreConfig *configuration.Core, path string) (*Index, error) {
+	db, err := rawdb.NewLevelDBDatabase(path, 0, 0, "", false)
+	if err != nil {
+		return nil, err
+	}
+	next := uint64(firstIndexedBlock)
+	head, err := db.Get(headKey)
+	if err == nil && len(head) == 8 {
+		next = binary.BigEndian.Uint64(head)
+	}
+	b := &builder{
+		txDB:       txDB,
+		db:         db,
+		coreConfig: coreConfig,
+	}
+	return &Index{
+		db:     db,
+		driver: txdb.NewIndexDriver(txDB, b, db, "trace", next),
+	}, nil
+}
+
+func encodeUint64(val uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, val)
+	return data
+}
+
+func addressKey(account common.Address, block uint64, txIndex uint64) []byte {
+	key := append([]byte{}, addressPrefix...)
+	key = append(key, account.Bytes()...)
+	key = append(key, encodeUint64(block)...)
+	return append(key, encodeUint64(txIndex)...)
+}
+
+func blockListKey(block uint64) []byte {
+	return append(append([]byte{}, blockListPrefix...), encodeUint64(block)...)
+}
+
+// IndexedHeight returns the number of the first block which hasn't been
+// indexed yet
+func (i *Index) IndexedHeight() uint64 {
+	return i.driver.Next()
+}
+
+func (i *Index) AddBlock(*machine.BlockInfo, *evm.BlockInfo, []*evm.TxResult) error {
+	i.driver.Notify()
+	return nil
+}
+
+func (i *Index) Reorg(height uint64) error {
+	return i.driver.Reorg(height)
+}
+
+func (i *Index) Start(ctx context.Context) error {
+	return i.driver.Start(ctx, i)
+}
+
+func (b *builder) UnitsAvailable(blockCount uint64) uint64 {
+	return blockCount
+}
+
+func (b *builder) ReorgUnit(height uint64) uint64 {
+	if height < firstIndexedBlock {
+		return firstIndexedBlock
+	}
+	return height
+}
+
+func (b *builder) Truncate(start, end uint64) error {
+	batch := b.db.NewBatch()
+	for block := start; block < end; block++ {
+		blockList, err := b.db.Get(blockListKey(block))
+		if err != nil {
+			continue
+		}
+		for offset := common.HashLength; offset+common.AddressLength <= len(blockList); offset += common.AddressLength {
+			prefix := append(append([]byte{}, addressPrefix...), blockList[offset:offset+common.AddressLength]...)
+			prefix = append(prefix, encodeUint64(block)...)
+			it := b.db.NewIterator(prefix, nil)
+			for it.Next() {
+				if err := batch.Delete(it.Key()); err != nil {
+					it.Release()
+					return err
+				}
+			}
+			it.Release()
+		}
+		if err := batch.Delete(blockListKey(block)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Put(headKey, encodeUint64(start)); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+func (b *builder) Valid(block uint64) (bool, error) {
+	if block < firstIndexedBlock {
+		return true, nil
+	}
+	blockList, err := b.db.Get(blockListKey(block))
+	if err != nil || len(blockList) < common.HashLength {
+		return false, nil
+	}
+	info, err := b.txDB.GetBlock(block)
+	if err != nil {
+		return false, err
+	}
+	return info != nil && info.Header.Hash() == common.BytesToHash(blockList[:common.HashLength]), nil
+}
+
+type blockEntries struct {
+	accounts []common.Address
+	roles    map[common.Address]map[uint64]byte
+}
+
+func (e *blockEntries) add(account common.Address, txIndex uint64, role byte) {
+	txRoles, ok := e.roles[account]
+	if !ok {
+		txRoles = make(map[uint64]byte)
+		e.roles[account] = txRoles
+		e.accounts = append(e.accounts, account)
+	}
+	txRoles[txIndex] |= role
+}
+
+func (e *blockEntries) addFrame(frame evm.Frame, txIndex uint64, isTopLevelCreate bool) {
+	callFrame := frame.GetCallFrame()
+	e.add(callFrame.Call.From.ToEthAddress(), txIndex, roleSender)
+	if _, ok := frame.(*evm.CallFrame); ok && !isTopLevelCreate && callFrame.Call.To != nil {
+		e.add(callFrame.Call.To.ToEthAddress(), txIndex, roleReceiver)
+	}
+	for _, nested := range callFrame.Nested {
+		e.addFrame(nested, txIndex, false)
+	}
+}
+
+func (b *builder) traceBlock(block *machine.BlockInfo) (*blockEntries, error) {
+	blockLog, txResults, err := b.txDB.GetBlockResults(block)
+	if err != nil {
+		return nil, err
+	}
+	if blockLog == nil {
+		return nil, errors.New("block reorged while indexing")
+	}
+	cursor, err := b.txDB.Lookup.GetExecutionCursorAtEndOfBlock(block.Header.Number.Uint64()-1, true)
+	if err != nil {
+		return nil, err
+	}
+	maxGas := int64(b.coreConfig.CheckpointMaxExecutionGas)
+	if maxGas == 0 {
+		maxGas = 100000000000
+	}
+
+	entries := &blockEntries{roles: make(map[common.Address]map[uint64]byte)}
+	logIndex := blockLog.FirstAVMLog()
+	for txIndex := uint64(0); txIndex < blockLog.BlockStats.TxCount.Uint64(); txIndex++ {
+		txRes := txResults[txIndex]
+		debugPrints, err := b.txDB.Lookup.AdvanceExecutionCursorWithTracing(
+			cursor,
+			big.NewInt(maxGas),
+			true,
+			true,
+			logIndex,
+			new(big.Int).Add(logIndex, big.NewInt(1)),
+		)
+		logIndex.Add(logIndex, big.NewInt(1))
+		if err != nil {
+			return nil, err
+		}
+		logLines := make([]evm.EVMLogLine, 0, len(debugPrints))
+		for _, debugPrint := range debugPrints {
+			logLine, err := evm.NewLogLineFromValue(debugPrint.Value)
+			if err != nil {
+				return nil, err
+			}
+			logLines = append(logLines, logLine)
+		}
+		trace, err := evm.GetTraceFromLogLines(logLines)
+		if err == nil {
+			var root evm.Frame
+			root, err = trace.FrameTree()
+			if err == nil && root != nil {
+				entries.addFrame(root, txIndex, txRes.IsContractCreation())
+			}
+		}
+		if err != nil {
+			logger.
+				Warn().
+				Uint64("block", block.Header.Number.Uint64()).
+				Str("txhash", txRes.IncomingRequest.MessageID.String()).
+				Err(err).
+				Msg("error getting trace for transaction")
+		}
+	}
+	return entries, nil
+}
+
+func (b *builder) Build(height uint64) (func() error, error) {
+	block, err := b.txDB.GetBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errors.Errorf("block %v not found", height)
+	}
+	entries, err := b.traceBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		batch := b.db.NewBatch()
+		blockList := append([]byte{}, block.Header.Hash().Bytes()...)
+		for _, account := range entries.accounts {
+			blockList = append(blockList, account.Bytes()...)
+			for txIndex, role := range entries.roles[account] {
+				if err := batch.Put(addressKey(account, height, txIndex), []byte{role}); err != nil {
+					return err
+				}
+			}
+		}
+		if err := batch.Put(blockListKey(height), blockList); err != nil {
+			return err
+		}
+		if err := batch.Put(headKey, encodeUint64(height+1)); err != nil {
+			return err
+		}
+		return batch.Write()
+	}, nil
+}
+
+func (i *Index) addressBlocks(accounts []common.Address, role byte, start, end uint64, blocks map[uint64]struct{}) {
+	for _, account := range accounts {
+		prefix := append(append([]byte{}, addressPrefix...), account.Bytes()...)
+		it := i.db.NewIterator(prefix, encodeUint64(start))
+		for it.Next() {
+			key := it.Key()
+			if len(key) != len(prefix)+16 {
+				continue
+			}
+			block := binary.BigEndian.Uint64(key[len(prefix) : len(prefix)+8])
+			if block > end {
+				break
+			}
+			if len(it.Value()) == 1 && it.Value()[0]&role != 0 {
+				blocks[block] = struct{}{}
+			}
+		}
+		it.Release()
+	}
+}
+
+// Blocks returns the blocks between start and end inclusive which may
+// contain a trace frame sent by one of the from addresses and received by
+// one of the to addresses. If only one of the lists is given, the other
+// side isn't checked. Blocks which haven't been indexed yet are always
+// included
+func (i *Index) Blocks(from, to []common.Address, start, end uint64) []uint64 {
+	var blocks []uint64
+	i.driver.View(func(next uint64) {
+		blocks = i.blocks(from, to, start, end, next)
+	})
+	return blocks
+}
+
+// blocks must be called from within View so that next stays current
+func (i *Index) blocks(from, to []common.Address, start, end uint64, next uint64) []uint64 {
+	blocks := make([]uint64, 0)
+	for block := start; block < firstIndexedBlock && block <= end; block++ {
+		blocks = append(blocks, block)
+	}
+	indexedStart := start
+	if indexedStart < firstIndexedBlock {
+		indexedStart = firstIndexedBlock
+	}
+	indexedEnd := end
+	if next <= end {
+		indexedEnd = next - 1
+	}
+	if indexedStart <= indexedEnd && (len(from) > 0 || len(to) > 0) {
+		var matches map[uint64]struct{}
+		if len(from) > 0 {
+			matches = make(map[uint64]struct{})
+			i.addressBlocks(from, roleSender, indexedStart, indexedEnd, matches)
+		}
+		if len(to) > 0 {
+			toMatches := make(map[uint64]struct{})
+			i.addressBlocks(to, roleReceiver, indexedStart, indexedEnd, toMatches)
+			if matches == nil {
+				matches = toMatches
+			} else {
+				for block := range matches {
+					if _, ok := toMatches[block]; !ok {
+						delete(matches, block)
+					}
+				}
+			}
+		}
+		indexed := make([]uint64, 0, len(matches))
+		for block := range matches {
+			indexed = append(indexed, block)
+		}
+		sort.Slice(indexed, func(a, b int) bool { return indexed[a] < indexed[b] })
+		blocks = append(blocks, indexed...)
+	} else {
+		for block := indexedStart; block <= indexedEnd; block++ {
+			blocks = append(blocks, block)
+		}
+	}
+	unindexedStart := next
+	if unindexedStart < start {
+		unindexedStart = start
+	}
+	for block := unindexedStart; block <= end; block++ {
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+// lastBlockMatching returns the last block matching a condition which holds
+// for every block up to some height and for none after it, or nil if no
+// block matches
+func (db *TxDB) lastBlockMatching(matches func(*machine.BlockInfo) (bool, error)) (*machine.BlockInfo, error) {
+	latest, err := db.LatestBlock()
+	if err != nil {
+		return nil, err
+	}
+	var searchErr error
+	count := int(latest.Header.Number.Uint64()) + 1
+	firstUnmatched := sort.Search(count, func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		info, err := db.GetBlock(uint64(i))
+		if err != nil || info == nil {
+			searchErr = err
+			return true
+		}
+		ok, err := matches(info)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return !ok
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+	if firstUnmatched == 0 {
+		return nil, nil
+	}
+	return db.GetBlock(uint64(firstUnmatched - 1))
+}
+
+// LatestBlockWithLogCount returns the last block whose block log is among
+// the first logCount logs
+func (db *TxDB) LatestBlockWithLogCount(logCount *big.Int) (*machine.BlockInfo, error) {
+	return db.lastBlockMatching(func(info *machine.BlockInfo) (bool, error) {
+		return new(big.Int).SetUint64(info.BlockLog).Cmp(logCount) < 0, nil
+	})
+}
+
+// LatestBlockWithMessageCount returns the last block which was completed
+// after reading no more than messageCount inbox messages
+func (db *TxDB) LatestBlockWithMessageCount(messageCount *big.Int) (*machine.BlockInfo, error) {
+	return db.lastBlockMatching(func(info *machine.BlockInfo) (bool, error) {
+		blockLog, err := core.GetZeroOrOneLog(db.Lookup, new(big.Int).SetUint64(info.BlockLog))
+		if err != nil {
+			return false, err
+		}
+		if blockLog.Value == nil {
+			return false, nil
+		}
+		return blockLog.Inbox.Count.Cmp(messageCount) <= 0, nil
+	})
+}
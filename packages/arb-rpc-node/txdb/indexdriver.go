@@ -0,0 +1,227 @@
+/*
+* Copyright 2021, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package txdb
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// IndexBuilder is the part of a background index specific to what it
+// stores. The index is built in order one unit at a time, where a unit is a
+// block or a fixed range of blocks, and each unit's storage records the
+// next unit to build along with it
+type IndexBuilder interface {
+	// UnitsAvailable returns the number of units that can be built from the
+	// first blockCount blocks
+	UnitsAvailable(blockCount uint64) uint64
+	// ReorgUnit returns the first unit covering blocks at or above height
+	ReorgUnit(height uint64) uint64
+	// Build reads what's needed to index unit, returning a function which
+	// stores it. Build is called without the driver's mutex held and the
+	// returned function is only called, with the mutex held, if no reorg
+	// happened in the meantime
+	Build(unit uint64) (func() error, error)
+	// Valid returns whether unit was indexed from blocks still in the chain
+	Valid(unit uint64) (bool, error)
+	// Truncate removes units from start up to end, recording start as the
+	// next unit to build. It's called with the driver's mutex held
+	Truncate(start, end uint64) error
+}
+
+// IndexDriver builds an index in the background as the TxDB adds blocks and
+// removes the parts of it covering reorged blocks. A generation counter,
+// bumped on every reorg, lets units be built without holding the mutex
+type IndexDriver struct {
+	txDB    *TxDB
+	builder IndexBuilder
+	closer  io.Closer
+	name    string
+
+	// mutex protects next and generation which are also updated by Reorg
+	mutex      sync.Mutex
+	next       uint64
+	generation uint64
+
+	newBlockChan chan struct{}
+}
+
+// NewIndexDriver returns a driver for the index built by builder, which
+// has been built up to next. closer is closed when the driver stops
+func NewIndexDriver(txDB *TxDB, builder IndexBuilder, closer io.Closer, name string, next uint64) *IndexDriver {
+	return &IndexDriver{
+		txDB:         txDB,
+		builder:      builder,
+		closer:       closer,
+		name:         name,
+		next:         next,
+		newBlockChan: make(chan struct{}, 1),
+	}
+}
+
+// Next returns the first unit which hasn't been built yet
+func (d *IndexDriver) Next() uint64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.next
+}
+
+// View calls f with the mutex held, so that the index isn't modified while
+// f reads the units before next
+func (d *IndexDriver) View(f func(next uint64)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	f(d.next)
+}
+
+// Notify wakes up the background thread to build any new units
+func (d *IndexDriver) Notify() {
+	select {
+	case d.newBlockChan <- struct{}{}:
+	default:
+	}
+}
+
+// AddUnit stores unit with store immediately if it's the next one to build,
+// otherwise it wakes up the background thread to catch up
+func (d *IndexDriver) AddUnit(unit uint64, store func() error) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if unit != d.next {
+		d.Notify()
+		return nil
+	}
+	if err := store(); err != nil {
+		return err
+	}
+	d.next = unit + 1
+	return nil
+}
+
+// Reorg removes the units covering blocks at or above height
+func (d *IndexDriver) Reorg(height uint64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.reorgImpl(d.builder.ReorgUnit(height))
+}
+
+// Must be called with the mutex held
+func (d *IndexDriver) reorgImpl(unit uint64) error {
+	d.generation++
+	if unit >= d.next {
+		return nil
+	}
+	if err := d.builder.Truncate(unit, d.next); err != nil {
+		return err
+	}
+	d.next = unit
+	return nil
+}
+
+// checkHead removes any units that no longer match the chain, which can
+// happen if the node reorged while the index was closed
+func (d *IndexDriver) checkHead() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for d.next > 0 {
+		last := d.next - 1
+		valid, err := d.builder.Valid(last)
+		if err != nil {
+			return err
+		}
+		if valid {
+			return nil
+		}
+		logger.Warn().Str("index", d.name).Uint64("unit", last).Msg("rolling back stale index entry")
+		if err := d.reorgImpl(last); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *IndexDriver) buildNext(next uint64, generation uint64) error {
+	store, err := d.builder.Build(next)
+	if err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.generation != generation || d.next != next {
+		// Reorg happened or AddUnit stored the unit first
+		return nil
+	}
+	if err := store(); err != nil {
+		return err
+	}
+	d.next = next + 1
+	return nil
+}
+
+func (d *IndexDriver) catchUp(ctx context.Context) error {
+	for ctx.Err() == nil {
+		blockCount, err := d.txDB.BlockCount()
+		if err != nil {
+			return err
+		}
+		d.mutex.Lock()
+		next := d.next
+		generation := d.generation
+		d.mutex.Unlock()
+		if next >= d.builder.UnitsAvailable(blockCount) {
+			return nil
+		}
+		if err := d.buildNext(next, generation); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (d *IndexDriver) mainThread(ctx context.Context) {
+	defer d.closer.Close()
+	for {
+		if err := d.catchUp(ctx); err != nil && ctx.Err() == nil {
+			logger.Error().Err(err).Str("index", d.name).Msg("error updating index")
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		select {
+		case <-d.newBlockChan:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Start rolls back any stale units, registers indexer with the TxDB and
+// starts building the index in the background. indexer must pass the
+// TxDB's calls on to the driver
+func (d *IndexDriver) Start(ctx context.Context, indexer BlockIndexer) error {
+	if err := d.checkHead(); err != nil {
+		return err
+	}
+	d.txDB.AddIndexer(indexer)
+	go d.mainThread(ctx)
+	return nil
+}
@@ -0,0 +1,58 @@
+/*
+* Copyright 2021, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package txdb
+
+import (
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+// BlockIndexer maintains an index derived from the chain. AddBlock is called
+// for every block the TxDB saves and Reorg is called whenever blocks at or
+// above the given height are removed
+type BlockIndexer interface {
+	AddBlock(block *machine.BlockInfo, blockInfo *evm.BlockInfo, txResults []*evm.TxResult) error
+	Reorg(height uint64) error
+}
+
+func (db *TxDB) AddIndexer(indexer BlockIndexer) {
+	db.indexersMutex.Lock()
+	defer db.indexersMutex.Unlock()
+	db.indexers = append(db.indexers, indexer)
+}
+
+func (db *TxDB) getIndexers() []BlockIndexer {
+	db.indexersMutex.Lock()
+	defer db.indexersMutex.Unlock()
+	return append([]BlockIndexer(nil), db.indexers...)
+}
+
+func (db *TxDB) indexBlock(block *machine.BlockInfo, blockInfo *evm.BlockInfo, txResults []*evm.TxResult) {
+	for _, indexer := range db.getIndexers() {
+		if err := indexer.AddBlock(block, blockInfo, txResults); err != nil {
+			logger.Error().Err(err).Uint64("block", blockInfo.BlockNum.Uint64()).Msg("error indexing block")
+		}
+	}
+}
+
+func (db *TxDB) reorgIndexers(height uint64) {
+	for _, indexer := range db.getIndexers() {
+		if err := indexer.Reorg(height); err != nil {
+			logger.Error().Err(err).Uint64("height", height).Msg("error reorging index")
+		}
+	}
+}
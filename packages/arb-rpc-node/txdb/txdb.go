@@ -22,6 +22,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/arblog"
 	"math/big"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
@@ -64,6 +65,9 @@ type TxDB struct {
 	snapshotLRUCache   *lru.Cache
 	blockInfoLRUCache  *lru.Cache
 	snapshotTimedCache *blockcache.BlockCache
+
+	indexersMutex sync.Mutex
+	indexers      []BlockIndexer
 }
 
 func New(
@@ -270,6 +274,7 @@ func (db *TxDB) DeleteLogs(avmLogs []core.ValueAndInbox) error {
 		if err != nil {
 			return err
 		}
+		db.reorgIndexers(reorgBlockHeight)
 
 		if db.snapshotLRUCache != nil {
 			for i := oldHeight; i > reorgBlockHeight; i-- {
@@ -400,6 +405,7 @@ func (db *TxDB) handleBlockReceipt(blockInfo *evm.BlockInfo) (*types.Header, err
 	if db.blockInfoLRUCache != nil {
 		db.blockInfoLRUCache.Add(header.Number.Uint64(), arbBlockInfo)
 	}
+	db.indexBlock(arbBlockInfo, blockInfo, txResults)
 
 	db.chainFeed.Send(ethcore.ChainEvent{Block: block, Hash: block.Hash(), Logs: ethLogs})
 	db.chainHeadFeed.Send(ethcore.ChainEvent{Block: block, Hash: block.Hash(), Logs: ethLogs})
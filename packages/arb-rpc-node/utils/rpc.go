@@ -18,6 +18,7 @@ package utils
 
 import (
 	"context"
+	"crypto/subtle"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/arblog"
 	"net/http"
 
@@ -53,6 +54,23 @@ func LaunchRPC(ctx context.Context, handler http.Handler, addr, port, path strin
 	return launchServer(ctx, r, addr, port, "rpc")
 }
 
+// LaunchAuthenticatedRPC is like LaunchRPC but rejects requests which don't
+// have an "Authorization: Bearer <token>" header with the given token
+func LaunchAuthenticatedRPC(ctx context.Context, handler http.Handler, addr, port, path, token string) error {
+	if len(token) == 0 {
+		return errors.New("must have nonempty token")
+	}
+	expected := []byte("Bearer " + token)
+	authHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	return LaunchRPC(ctx, authHandler, addr, port, path)
+}
+
 func LaunchWS(ctx context.Context, server *rpc.Server, addr, port, path string) error {
 	r := mux.NewRouter()
 	wsRoutes, err := setupPaths(r, path)
@@ -66,7 +84,9 @@ func LaunchWS(ctx context.Context, server *rpc.Server, addr, port, path string)
 	return launchServer(ctx, r, addr, port, "websocket")
 }
 
-func LaunchRPCAndWS(ctx context.Context, server *rpc.Server, addr, port, rpcPath, wsPath string) error {
+// LaunchRPCAndWS serves HTTP requests with rpcHandler, which should pass
+// them on to server, and websocket connections with server
+func LaunchRPCAndWS(ctx context.Context, server *rpc.Server, rpcHandler http.Handler, addr, port, rpcPath, wsPath string) error {
 	r := mux.NewRouter()
 	rpcRoutes, err := setupPaths(r, rpcPath)
 	if err != nil {
@@ -77,7 +97,7 @@ func LaunchRPCAndWS(ctx context.Context, server *rpc.Server, addr, port, rpcPath
 		return err
 	}
 	for _, route := range rpcRoutes {
-		route.Handler(server).Methods("GET", "POST", "OPTIONS")
+		route.Handler(rpcHandler).Methods("GET", "POST", "OPTIONS")
 	}
 	wsHandler := server.WebsocketHandler([]string{"*"})
 	for _, route := range wsRoutes {
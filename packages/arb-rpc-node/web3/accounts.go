@@ -41,7 +41,7 @@ type Accounts struct {
 	nonMutating bool
 }
 
-func NewAccounts(ethServer *Server, privateKeys []*ecdsa.PrivateKey, nonMutating bool) *Accounts {
+func NewAccounts(ethServer *Server, fwdSrv *ForwarderServer, privateKeys []*ecdsa.PrivateKey, nonMutating bool) *Accounts {
 	keys := make(map[common.Address]*ecdsa.PrivateKey)
 	addresses := make([]common.Address, 0, len(privateKeys))
 	for _, privKey := range privateKeys {
@@ -51,6 +51,7 @@ func NewAccounts(ethServer *Server, privateKeys []*ecdsa.PrivateKey, nonMutating
 	}
 	return &Accounts{
 		srv:         ethServer,
+		fwdSrv:      fwdSrv,
 		addresses:   addresses,
 		privateKeys: keys,
 		signer:      types.NewEIP155Signer(new(big.Int).SetUint64(uint64(ethServer.ChainId()))),
@@ -142,7 +143,7 @@ func (s *Accounts) SendTransaction(ctx context.Context, args *SendTransactionArg
 		return [32]byte{}, err
 	}
 
-	if err := s.srv.srv.SendTransaction(ctx, signedTx); err != nil {
+	if _, err := s.fwdSrv.sendTransaction(ctx, signedTx); err != nil {
 		return [32]byte{}, err
 	}
 	return signedTx.Hash(), nil
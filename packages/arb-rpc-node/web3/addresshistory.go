@@ -0,0 +1,147 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/addressindex"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+const (
+	defaultAddressHistoryLimit = 100
+	maxAddressHistoryLimit     = 1000
+)
+
+type AddressTransactionResult struct {
+	*TransactionResult
+	IsSender    bool `json:"isSender"`
+	IsRecipient bool `json:"isRecipient"`
+}
+
+type AddressHistoryResult struct {
+	Transactions []*AddressTransactionResult `json:"transactions"`
+	// Last block searched, which may be before the requested toBlock if the
+	// index hasn't caught up yet
+	ToBlock    hexutil.Uint64 `json:"toBlock"`
+	NextCursor hexutil.Bytes  `json:"nextCursor,omitempty"`
+}
+
+func encodeAddressCursor(entry *addressindex.Entry) hexutil.Bytes {
+	cursor := make([]byte, 16)
+	binary.BigEndian.PutUint64(cursor[:8], entry.Block)
+	binary.BigEndian.PutUint64(cursor[8:], entry.TxIndex)
+	return cursor
+}
+
+func decodeAddressCursor(cursor hexutil.Bytes) (uint64, uint64, error) {
+	if len(cursor) != 16 {
+		return 0, 0, errors.New("invalid cursor")
+	}
+	return binary.BigEndian.Uint64(cursor[:8]), binary.BigEndian.Uint64(cursor[8:]), nil
+}
+
+// GetTransactionsByAddress returns the transactions sent or received by an
+// address between fromBlock and toBlock inclusive. If there are more than
+// limit results, nextCursor is set and can be passed back to get the next
+// page
+func (a *Arb) GetTransactionsByAddress(
+	address common.Address,
+	fromBlock rpc.BlockNumber,
+	toBlock rpc.BlockNumber,
+	cursor *hexutil.Bytes,
+	limit *hexutil.Uint64,
+) (*AddressHistoryResult, error) {
+	if a.addressIndex == nil {
+		return nil, errors.New("address index is not enabled")
+	}
+	start, err := a.srv.BlockNum(&fromBlock)
+	if err != nil {
+		return nil, err
+	}
+	end, err := a.srv.BlockNum(&toBlock)
+	if err != nil {
+		return nil, err
+	}
+	startTxIndex := uint64(0)
+	if cursor != nil {
+		cursorBlock, cursorTxIndex, err := decodeAddressCursor(*cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursorBlock < start {
+			return nil, errors.New("cursor before fromBlock")
+		}
+		start = cursorBlock
+		startTxIndex = cursorTxIndex
+	}
+	maxResults := defaultAddressHistoryLimit
+	if limit != nil {
+		maxResults = int(*limit)
+		if maxResults <= 0 || maxResults > maxAddressHistoryLimit {
+			return nil, errors.Errorf("limit must be between 1 and %v", maxAddressHistoryLimit)
+		}
+	}
+
+	indexedHeight := a.addressIndex.IndexedHeight()
+	if indexedHeight == 0 || start >= indexedHeight {
+		return nil, errors.Errorf("address index has only reached block %v", indexedHeight)
+	}
+	if end >= indexedHeight {
+		end = indexedHeight - 1
+	}
+	res := &AddressHistoryResult{
+		Transactions: make([]*AddressTransactionResult, 0),
+		ToBlock:      hexutil.Uint64(end),
+	}
+	if start > end {
+		return res, nil
+	}
+
+	entries, next := a.addressIndex.Transactions(address, start, startTxIndex, end, maxResults)
+	var block *machine.BlockInfo
+	for _, entry := range entries {
+		if block == nil || block.Header.Number.Uint64() != entry.Block {
+			block, err = a.srv.BlockInfoByNumber(entry.Block)
+			if err != nil {
+				return nil, err
+			}
+			if block == nil {
+				return nil, errors.Errorf("block %v not found", entry.Block)
+			}
+		}
+		tx, err := a.eth.getTransactionByBlockAndIndex(block, hexutil.Uint64(entry.TxIndex))
+		if err != nil {
+			return nil, err
+		}
+		res.Transactions = append(res.Transactions, &AddressTransactionResult{
+			TransactionResult: tx,
+			IsSender:          entry.Role&addressindex.RoleSender != 0,
+			IsRecipient:       entry.Role&addressindex.RoleRecipient != 0,
+		})
+	}
+	if next != nil {
+		res.NextCursor = encodeAddressCursor(next)
+	}
+	return res, nil
+}
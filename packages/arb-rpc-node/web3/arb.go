@@ -19,12 +19,21 @@ package web3
 import (
 	ethcommon "github.com/ethereum/go-ethereum/common"
 
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/addressindex"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/aggregator"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
 )
 
 type Arb struct {
-	srv *aggregator.Server
+	srv          *aggregator.Server
+	eth          *Server
+	addressIndex *addressindex.Index
+}
+
+// NewArb creates the arb namespace. addressIndex may be nil, in which case
+// arb_getTransactionsByAddress is unavailable
+func NewArb(srv *aggregator.Server, eth *Server, addressIndex *addressindex.Index) *Arb {
+	return &Arb{srv: srv, eth: eth, addressIndex: addressIndex}
 }
 
 func (a *Arb) GetAggregator() *batcher.AggregatorInfo {
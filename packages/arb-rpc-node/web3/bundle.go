@@ -0,0 +1,200 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+const maxBundleTxs = 100
+
+// BundleOverrides changes the L1 block number and timestamp the bundle is
+// executed at. If only one is given, the other is taken from the block the
+// bundle is executed on top of
+type BundleOverrides struct {
+	Timestamp     *hexutil.Uint64 `json:"timestamp"`
+	L1BlockNumber *hexutil.Uint64 `json:"l1BlockNumber"`
+}
+
+type BundleTxResult struct {
+	TxHash     common.Hash     `json:"txHash"`
+	From       common.Address  `json:"from"`
+	To         *common.Address `json:"to"`
+	ResultCode hexutil.Uint64  `json:"resultCode"`
+	Result     string          `json:"result"`
+	ReturnData hexutil.Bytes   `json:"returnData"`
+	GasUsed    hexutil.Uint64  `json:"gasUsed"`
+	Logs       []*types.Log    `json:"logs"`
+}
+
+type CallBundleResult struct {
+	Results   []*BundleTxResult `json:"results"`
+	GasUsed   hexutil.Uint64    `json:"gasUsed"`
+	StateDiff StateDiff         `json:"stateDiff"`
+}
+
+func bundleChainTime(snap *snapshot.Snapshot, overrides *BundleOverrides) *inbox.ChainTime {
+	if overrides == nil || (overrides.Timestamp == nil && overrides.L1BlockNumber == nil) {
+		return nil
+	}
+	chainTime := &inbox.ChainTime{
+		BlockNum:  snap.Height().Clone(),
+		Timestamp: new(big.Int).Set(snap.Timestamp()),
+	}
+	if overrides.L1BlockNumber != nil {
+		chainTime.BlockNum = arbcommon.NewTimeBlocks(new(big.Int).SetUint64(uint64(*overrides.L1BlockNumber)))
+	}
+	if overrides.Timestamp != nil {
+		chainTime.Timestamp = new(big.Int).SetUint64(uint64(*overrides.Timestamp))
+	}
+	return chainTime
+}
+
+// bundleTraceFrames returns the call frames of a bundle transaction, or nil
+// if they couldn't be rendered from its trace
+func bundleTraceFrames(txRes *evm.TxResult, debugPrints []value.Value) []TraceFrame {
+	evmTrace, _, err := extractTrace(debugPrints)
+	if err == nil {
+		var frames []TraceFrame
+		frames, err = renderTraceFrames(txRes, evmTrace)
+		if err == nil {
+			return frames
+		}
+	}
+	logger.Warn().Err(err).Str("txhash", txRes.IncomingRequest.MessageID.String()).Msg("error tracing bundle transaction")
+	return nil
+}
+
+// bundleAccounts returns every account whose balance, nonce or code could
+// have been changed by the transaction, including those touched by internal
+// calls in frames. Without frames, only the accounts visible from the
+// transaction's result are included
+func bundleAccounts(accounts []common.Address, seen map[common.Address]bool, res *BundleTxResult, txRes *evm.TxResult, frames []TraceFrame) []common.Address {
+	add := func(account common.Address) {
+		if !seen[account] {
+			seen[account] = true
+			accounts = append(accounts, account)
+		}
+	}
+	add(res.From)
+	if res.To != nil {
+		add(*res.To)
+	}
+	if txRes.IsContractCreation() && txRes.ResultCode == evm.ReturnCode {
+		if created, ok := txRes.GetCreatedContractAddress(); ok {
+			add(created)
+		}
+	}
+	for _, l := range res.Logs {
+		add(l.Address)
+	}
+	for _, account := range touchedAccounts(frames) {
+		add(account)
+	}
+	return accounts
+}
+
+// CallBundle executes the given signed transactions in order on top of the
+// given block, with each transaction seeing the effects of the ones before it
+func (a *Arb) CallBundle(ctx context.Context, txs []hexutil.Bytes, blockNum rpc.BlockNumberOrHash, overrides *BundleOverrides) (*CallBundleResult, error) {
+	if len(txs) == 0 {
+		return nil, errors.New("bundle must contain at least one transaction")
+	}
+	if len(txs) > maxBundleTxs {
+		return nil, errors.Errorf("bundle contains %v transactions, max is %v", len(txs), maxBundleTxs)
+	}
+	base, err := a.eth.getSnapshotForNumberOrHash(ctx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	// The snapshot may be shared so work on a copy
+	snap := base.Clone()
+	chainTime := bundleChainTime(snap, overrides)
+	signer := types.NewEIP155Signer(a.srv.ChainId())
+
+	result := &CallBundleResult{Results: make([]*BundleTxResult, 0, len(txs))}
+	seen := make(map[common.Address]bool)
+	accounts := make([]common.Address, 0)
+	totalGasUsed := new(big.Int)
+	for i, encodedTx := range txs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(encodedTx); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode transaction %v", i)
+		}
+		sender, err := types.Sender(signer, tx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to recover sender of transaction %v", i)
+		}
+		msg, err := message.NewL2Message(message.SignedTransaction{Tx: tx})
+		if err != nil {
+			return nil, err
+		}
+		arbSender := arbcommon.NewAddressFromEth(sender)
+		targetHash := arbcommon.NewHashFromEth(tx.Hash())
+		txRes, debugPrints, err := snap.AddMessageAtTime(ctx, msg, arbSender, targetHash, chainTime, true)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to execute transaction %v", i)
+		}
+
+		gasUsed := txRes.CalcGasUsed()
+		totalGasUsed.Add(totalGasUsed, gasUsed)
+		res := &BundleTxResult{
+			TxHash:     tx.Hash(),
+			From:       sender,
+			To:         tx.To(),
+			ResultCode: hexutil.Uint64(txRes.ResultCode),
+			Result:     txRes.ResultCode.String(),
+			ReturnData: txRes.ReturnData,
+			GasUsed:    hexutil.Uint64(gasUsed.Uint64()),
+			Logs:       txRes.EthLogs(arbcommon.Hash{}),
+		}
+		result.Results = append(result.Results, res)
+		accounts = bundleAccounts(accounts, seen, res, txRes, bundleTraceFrames(txRes, debugPrints))
+	}
+	result.GasUsed = hexutil.Uint64(totalGasUsed.Uint64())
+
+	// Like trace stateDiff, storage isn't diffed
+	result.StateDiff = make(StateDiff)
+	for _, account := range accounts {
+		beforeState, err := getAccountState(ctx, base, account)
+		if err != nil {
+			return nil, err
+		}
+		afterState, err := getAccountState(ctx, snap, account)
+		if err != nil {
+			return nil, err
+		}
+		if accountDiff := diffAccount(beforeState, afterState); accountDiff != nil {
+			result.StateDiff[account] = accountDiff
+		}
+	}
+	return result, nil
+}
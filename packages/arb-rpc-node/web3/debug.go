@@ -0,0 +1,226 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+)
+
+const (
+	callTracer     = "callTracer"
+	prestateTracer = "prestateTracer"
+)
+
+// Debug implements the geth debug_traceTransaction and debug_traceCall
+// methods for the built in callTracer and prestateTracer
+type Debug struct {
+	t *Trace
+}
+
+func NewDebug(t *Trace) *Debug {
+	return &Debug{t: t}
+}
+
+type TraceConfig struct {
+	Tracer *string `json:"tracer"`
+}
+
+type CallTracerFrame struct {
+	Type    string            `json:"type"`
+	From    common.Address    `json:"from"`
+	To      *common.Address   `json:"to,omitempty"`
+	Value   *hexutil.Big      `json:"value,omitempty"`
+	Gas     hexutil.Uint64    `json:"gas"`
+	GasUsed hexutil.Uint64    `json:"gasUsed"`
+	Input   hexutil.Bytes     `json:"input"`
+	Output  hexutil.Bytes     `json:"output,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Calls   []CallTracerFrame `json:"calls,omitempty"`
+}
+
+// PrestateAccount is the state of an account before the transaction. Like
+// stateDiff, storage is always empty since ArbOS doesn't report the slots
+// read by a transaction
+type PrestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+type Prestate map[common.Address]*PrestateAccount
+
+func getPrestate(ctx context.Context, before *snapshot.Snapshot, frames []TraceFrame) (Prestate, error) {
+	prestate := make(Prestate)
+	for _, account := range touchedAccounts(frames) {
+		state, err := getAccountState(ctx, before, account)
+		if err != nil {
+			return nil, err
+		}
+		prestate[account] = &PrestateAccount{
+			Balance: (*hexutil.Big)(state.balance),
+			Nonce:   state.nonce.Uint64(),
+			Code:    state.code,
+			Storage: make(map[common.Hash]common.Hash),
+		}
+	}
+	return prestate, nil
+}
+
+func callTracerError(result evm.ResultType) string {
+	switch result {
+	case evm.RevertCode:
+		return "execution reverted"
+	case evm.ExecutionRanOutOfGas:
+		return "out of gas"
+	default:
+		return result.String()
+	}
+}
+
+func renderCallTracerFrame(frame evm.Frame) CallTracerFrame {
+	callFrame := frame.GetCallFrame()
+	res := CallTracerFrame{
+		From:  callFrame.Call.From.ToEthAddress(),
+		Value: (*hexutil.Big)(callFrame.Call.Value),
+		Gas:   hexutil.Uint64(callFrame.Call.Gas.Uint64()),
+	}
+	if callFrame.Return != nil {
+		res.GasUsed = hexutil.Uint64(callFrame.Return.GasUsed.Uint64())
+		res.Output = callFrame.Return.ReturnData
+		if callFrame.Return.Result != evm.ReturnCode {
+			res.Error = callTracerError(callFrame.Return.Result)
+		}
+	}
+
+	switch frame := frame.(type) {
+	case *evm.CreateFrame:
+		res.Type = "CREATE"
+		to := frame.Create.ContractAddress.ToEthAddress()
+		res.To = &to
+		res.Input = frame.Create.Code
+	case *evm.Create2Frame:
+		res.Type = "CREATE2"
+		to := frame.Create.ContractAddress.ToEthAddress()
+		res.To = &to
+		res.Input = frame.Create.Code
+	default:
+		res.Type = strings.ToUpper(callFrame.Call.Type.RPCString())
+		if callFrame.Call.To != nil {
+			to := callFrame.Call.To.ToEthAddress()
+			res.To = &to
+		}
+		res.Input = callFrame.Call.Data
+		if callFrame.Call.Type == evm.DelegateCall || callFrame.Call.Type == evm.StaticCall {
+			res.Value = nil
+		}
+	}
+
+	for _, nested := range callFrame.Nested {
+		res.Calls = append(res.Calls, renderCallTracerFrame(nested))
+	}
+	return res
+}
+
+func renderCallTracer(txTrace *rawTxTrace) (*CallTracerFrame, error) {
+	root, err := txTrace.evmTrace.FrameTree()
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, errors.New("transaction produced no trace")
+	}
+	res := renderCallTracerFrame(root)
+
+	// Top level call could actually be contract creation, which
+	// renderTraceFrames has already worked out
+	if len(txTrace.frames) > 0 && txTrace.frames[0].Type == "create" {
+		topLevel := txTrace.frames[0]
+		res.Type = "CREATE"
+		res.To = nil
+		res.Input = topLevel.Action.Init
+		res.Output = nil
+		if topLevel.Result != nil {
+			res.To = topLevel.Result.Address
+			if topLevel.Result.Code != nil {
+				res.Output = *topLevel.Result.Code
+			}
+		}
+	}
+	return &res, nil
+}
+
+func parseTracer(config *TraceConfig) (traceOptions, string, error) {
+	if config == nil || config.Tracer == nil {
+		return traceOptions{}, "", errors.New("only the callTracer and prestateTracer tracers are supported")
+	}
+	switch *config.Tracer {
+	case callTracer:
+		return traceOptions{}, callTracer, nil
+	case prestateTracer:
+		return traceOptions{prestate: true}, prestateTracer, nil
+	default:
+		return traceOptions{}, "", errors.Errorf("unsupported tracer: %v", *config.Tracer)
+	}
+}
+
+func renderTracerResult(tracer string, txTrace *rawTxTrace) (interface{}, error) {
+	if tracer == prestateTracer {
+		return txTrace.prestate, nil
+	}
+	return renderCallTracer(txTrace)
+}
+
+func (d *Debug) TraceTransaction(ctx context.Context, txHash common.Hash, config *TraceConfig) (interface{}, error) {
+	opts, tracer, err := parseTracer(config)
+	if err != nil {
+		return nil, err
+	}
+	txTrace, _, err := d.t.transaction(ctx, txHash.Bytes(), opts)
+	if err != nil {
+		return nil, err
+	}
+	if txTrace == nil {
+		return nil, errors.Errorf("transaction %v not found", txHash.Hex())
+	}
+	return renderTracerResult(tracer, txTrace)
+}
+
+func (d *Debug) TraceCall(ctx context.Context, callArgs CallTxArgs, blockNum rpc.BlockNumberOrHash, config *TraceConfig) (interface{}, error) {
+	opts, tracer, err := parseTracer(config)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := d.t.s.getSnapshotForNumberOrHash(ctx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	txTrace, err := d.t.traceCall(ctx, callArgs, opts, snap)
+	if err != nil {
+		return nil, err
+	}
+	return renderTracerResult(tracer, txTrace)
+}
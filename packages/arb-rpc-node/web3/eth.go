@@ -385,59 +385,97 @@ func (s *Server) GetTransactionReceipt(ctx context.Context, txHash hexutil.Bytes
 	if err != nil || res == nil {
 		return nil, err
 	}
-
-	receipt := res.ToEthReceipt(arbcommon.NewHashFromEth(info.Header.Hash()))
-
 	tx, err := evm.GetTransaction(res)
 	if err != nil {
 		return nil, err
 	}
-
-	var contractAddress *common.Address
-	emptyAddress := common.Address{}
-	if receipt.ContractAddress != emptyAddress {
-		contractAddress = &receipt.ContractAddress
-	}
-
 	var l1InboxBatchInfo *L1InboxBatchInfo
 	if opts != nil && opts.ReturnL1InboxBatchInfo {
-		if s.sequencerInboxWatcher == nil {
-			return nil, errors.New("RPC L1 lookups disabled")
-		}
-		lookup := s.srv.GetLookup()
-		seqNum := new(big.Int).Sub(inboxState.Count, big.NewInt(1))
-		batch, err := s.sequencerInboxWatcher.LookupBatchContaining(ctx, lookup, seqNum)
+		l1InboxBatchInfo, err = s.getL1InboxBatchInfo(ctx, inboxState)
 		if err != nil {
 			return nil, err
 		}
-		if batch != nil {
-			if batch.GetAfterCount().Cmp(inboxState.Count) < 0 {
-				return nil, errors.New("retrieved too early sequencer batch")
-			}
-			expectedTxAcc, expectedBatchAcc, err := lookup.GetInboxAccPair(seqNum, new(big.Int).Sub(batch.GetAfterCount(), big.NewInt(1)))
+	}
+	return makeTransactionReceiptResult(tx, info.Header.Hash(), l1InboxBatchInfo), nil
+}
+
+func (s *Server) GetBlockReceipts(ctx context.Context, blockNum rpc.BlockNumberOrHash, opts *ArbGetTxReceiptOpts) ([]*GetTransactionReceiptResult, error) {
+	info, err := s.blockInfoForNumberOrHash(blockNum)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	_, results, err := s.srv.GetMachineBlockResults(info)
+	if err != nil || results == nil {
+		return nil, err
+	}
+	blockHash := info.Header.Hash()
+	processedTxes := evm.FilterEthTxResults(results)
+	receipts := make([]*GetTransactionReceiptResult, 0, len(processedTxes))
+	for _, tx := range processedTxes {
+		var l1InboxBatchInfo *L1InboxBatchInfo
+		if opts != nil && opts.ReturnL1InboxBatchInfo {
+			// Block results don't include the inbox state so we need to look it up for each request
+			_, inboxState, _, err := s.srv.GetRequestResult(tx.Result.IncomingRequest.MessageID)
 			if err != nil {
 				return nil, err
 			}
-			if expectedTxAcc != inboxState.Accumulator || expectedBatchAcc != batch.GetAfterAcc() {
-				return nil, errors.New("inconsistent sequencer inbox state")
-			}
-			currentBlockHeight, err := s.sequencerInboxWatcher.CurrentBlockHeight(ctx)
+			l1InboxBatchInfo, err = s.getL1InboxBatchInfo(ctx, inboxState)
 			if err != nil {
 				return nil, err
 			}
-			rawLog := batch.GetRawLog()
-			blockNum := new(big.Int).SetUint64(rawLog.BlockNumber)
-			confirmations := new(big.Int).Sub(currentBlockHeight, blockNum)
-			if confirmations.Sign() >= 0 {
-				l1InboxBatchInfo = &L1InboxBatchInfo{
-					Confirmations: (*hexutil.Big)(confirmations),
-					BlockNumber:   (*hexutil.Big)(blockNum),
-					LogAddress:    rawLog.Address,
-					LogTopics:     rawLog.Topics,
-					LogData:       rawLog.Data,
-				}
-			}
 		}
+		receipts = append(receipts, makeTransactionReceiptResult(tx, blockHash, l1InboxBatchInfo))
+	}
+	return receipts, nil
+}
+
+func (s *Server) getL1InboxBatchInfo(ctx context.Context, inboxState core.InboxState) (*L1InboxBatchInfo, error) {
+	if s.sequencerInboxWatcher == nil {
+		return nil, errors.New("RPC L1 lookups disabled")
+	}
+	lookup := s.srv.GetLookup()
+	seqNum := new(big.Int).Sub(inboxState.Count, big.NewInt(1))
+	batch, err := s.sequencerInboxWatcher.LookupBatchContaining(ctx, lookup, seqNum)
+	if err != nil || batch == nil {
+		return nil, err
+	}
+	if batch.GetAfterCount().Cmp(inboxState.Count) < 0 {
+		return nil, errors.New("retrieved too early sequencer batch")
+	}
+	expectedTxAcc, expectedBatchAcc, err := lookup.GetInboxAccPair(seqNum, new(big.Int).Sub(batch.GetAfterCount(), big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	if expectedTxAcc != inboxState.Accumulator || expectedBatchAcc != batch.GetAfterAcc() {
+		return nil, errors.New("inconsistent sequencer inbox state")
+	}
+	currentBlockHeight, err := s.sequencerInboxWatcher.CurrentBlockHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rawLog := batch.GetRawLog()
+	blockNum := new(big.Int).SetUint64(rawLog.BlockNumber)
+	confirmations := new(big.Int).Sub(currentBlockHeight, blockNum)
+	if confirmations.Sign() < 0 {
+		return nil, nil
+	}
+	return &L1InboxBatchInfo{
+		Confirmations: (*hexutil.Big)(confirmations),
+		BlockNumber:   (*hexutil.Big)(blockNum),
+		LogAddress:    rawLog.Address,
+		LogTopics:     rawLog.Topics,
+		LogData:       rawLog.Data,
+	}, nil
+}
+
+func makeTransactionReceiptResult(tx *evm.ProcessedTx, blockHash common.Hash, l1InboxBatchInfo *L1InboxBatchInfo) *GetTransactionReceiptResult {
+	res := tx.Result
+	receipt := res.ToEthReceipt(arbcommon.NewHashFromEth(blockHash))
+
+	var contractAddress *common.Address
+	emptyAddress := common.Address{}
+	if receipt.ContractAddress != emptyAddress {
+		contractAddress = &receipt.ContractAddress
 	}
 
 	return &GetTransactionReceiptResult{
@@ -464,7 +502,7 @@ func (s *Server) GetTransactionReceipt(ctx context.Context, txHash hexutil.Bytes
 		},
 		L1BlockNumber:    (*hexutil.Big)(res.IncomingRequest.L1BlockNumber),
 		L1InboxBatchInfo: l1InboxBatchInfo,
-	}, nil
+	}
 }
 
 func feeSetToFeeSetResult(feeset *evm.FeeSet) *FeeSetResult {
@@ -684,12 +722,16 @@ func (s *Server) getSnapshot(ctx context.Context, blockNum *rpc.BlockNumber) (*s
 		return snap, nil
 	}
 
-	snap, err := s.srv.GetSnapshot(ctx, uint64(*blockNum))
+	height, err := s.srv.BlockNum(blockNum)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := s.srv.GetSnapshot(ctx, height)
 	if err != nil {
 		return nil, err
 	}
 	if snap == nil {
-		return nil, errors.Errorf("unsupported block number %v", uint64(*blockNum))
+		return nil, errors.Errorf("unsupported block number %v", height)
 	}
 	return snap, nil
 }
@@ -243,6 +243,6 @@ func (c *EthClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types
 }
 
 func (c *EthClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
-	gasPriceRaw, err := c.srv.GasPrice(ctx)
-	return (*big.Int)(gasPriceRaw), err
+	tipCap, err := c.srv.MaxPriorityFeePerGas(ctx)
+	return (*big.Int)(tipCap), err
 }
@@ -27,26 +27,30 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/aggregator"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
 )
 
 const nonMutatingModeError = "mutating transactions are disabled on this node"
 
 type ForwarderServer struct {
-	srv    *aggregator.Server
-	ethSrv *Server
-	mode   configuration.RpcMode
+	srv     *aggregator.Server
+	ethSrv  *Server
+	mode    configuration.RpcMode
+	limiter *txRateLimiter
 }
 
 func NewForwarderServer(
 	srv *aggregator.Server,
 	ethSrv *Server,
 	mode configuration.RpcMode,
+	rateLimit configuration.RateLimit,
 ) *ForwarderServer {
 	return &ForwarderServer{
-		srv:    srv,
-		ethSrv: ethSrv,
-		mode:   mode,
+		srv:     srv,
+		ethSrv:  ethSrv,
+		mode:    mode,
+		limiter: newTxRateLimiter(rateLimit),
 	}
 }
 
@@ -55,17 +59,29 @@ func (f *ForwarderServer) GetTransactionCount(ctx context.Context, address *comm
 }
 
 func (f *ForwarderServer) SendRawTransaction(ctx context.Context, data hexutil.Bytes) (hexutil.Bytes, error) {
-	if f.mode == configuration.NonMutatingRpcMode {
-		return nil, errors.New(nonMutatingModeError)
-	}
-
 	tx := new(types.Transaction)
 	if err := rlp.DecodeBytes(data, tx); err != nil {
 		return nil, err
 	}
-	err := f.srv.SendTransaction(ctx, tx)
-	if err != nil {
+	if _, err := f.sendTransaction(ctx, tx); err != nil {
 		return nil, err
 	}
 	return tx.Hash().Bytes(), nil
 }
+
+// sendTransaction applies the rate limits before passing tx to the batcher.
+// A transaction the sequencer is holding for an earlier nonce has been
+// accepted, so rather than an error it's reported by returning held
+func (f *ForwarderServer) sendTransaction(ctx context.Context, tx *types.Transaction) (held bool, err error) {
+	if f.mode == configuration.NonMutatingRpcMode {
+		return false, errors.New(nonMutatingModeError)
+	}
+	if err := f.limiter.check(ctx, tx); err != nil {
+		return false, err
+	}
+	err = f.srv.SendTransaction(ctx, tx)
+	if errors.Cause(err) == batcher.ErrTxHeld {
+		return true, nil
+	}
+	return false, err
+}
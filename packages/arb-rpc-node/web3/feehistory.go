@@ -0,0 +1,232 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+)
+
+const (
+	maxFeeHistoryBlocks = 1024
+
+	// Matches the defaults of the go-ethereum gas price oracle
+	priorityFeeCheckBlocks = 20
+	priorityFeePercentile  = 60
+)
+
+type FeeHistoryResult struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas,omitempty"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+type txReward struct {
+	reward  *big.Int
+	gasUsed *big.Int
+}
+
+// blockBaseFee is the price per ArbGas every transaction in the block was
+// charged for computation
+func blockBaseFee(blockInfo *evm.BlockInfo) *big.Int {
+	return blockInfo.GasSummary.PricePerArbGasTotal
+}
+
+// txRewards returns the amount each transaction paid per unit of L2
+// computation above the block's base price, sorted by amount
+func txRewards(txResults []*evm.TxResult, baseFee *big.Int) []txReward {
+	rewards := make([]txReward, 0, len(txResults))
+	for _, res := range evm.FilterEthTxResults(txResults) {
+		feeStats := res.Result.FeeStats
+		gasUsed := feeStats.UnitsUsed.L2Computation
+		price := feeStats.Price.L2Computation
+		if gasUsed.Sign() > 0 {
+			price = new(big.Int).Div(feeStats.Paid.L2Computation, gasUsed)
+		}
+		reward := new(big.Int).Sub(price, baseFee)
+		if reward.Sign() < 0 {
+			reward.SetInt64(0)
+		}
+		rewards = append(rewards, txReward{reward: reward, gasUsed: gasUsed})
+	}
+	sort.Slice(rewards, func(i, j int) bool {
+		return rewards[i].reward.Cmp(rewards[j].reward) < 0
+	})
+	return rewards
+}
+
+// rewardPercentiles weights each transaction by the gas it used, the same
+// way go-ethereum does
+func rewardPercentiles(rewards []txReward, percentiles []float64) []*hexutil.Big {
+	res := make([]*hexutil.Big, len(percentiles))
+	if len(rewards) == 0 {
+		for i := range res {
+			res[i] = (*hexutil.Big)(big.NewInt(0))
+		}
+		return res
+	}
+	gasUsed := big.NewInt(0)
+	for _, reward := range rewards {
+		gasUsed.Add(gasUsed, reward.gasUsed)
+	}
+	gasUsedFloat, _ := new(big.Float).SetInt(gasUsed).Float64()
+	txIndex := 0
+	sumGasUsed, _ := new(big.Float).SetInt(rewards[0].gasUsed).Float64()
+	for i, p := range percentiles {
+		thresholdGasUsed := gasUsedFloat * p / 100
+		for sumGasUsed < thresholdGasUsed && txIndex < len(rewards)-1 {
+			txIndex++
+			txGasUsed, _ := new(big.Float).SetInt(rewards[txIndex].gasUsed).Float64()
+			sumGasUsed += txGasUsed
+		}
+		res[i] = (*hexutil.Big)(rewards[txIndex].reward)
+	}
+	return res
+}
+
+func validatePercentiles(percentiles []float64) error {
+	for i, p := range percentiles {
+		if p < 0 || p > 100 {
+			return errors.Errorf("invalid reward percentile: %v", p)
+		}
+		if i > 0 && p < percentiles[i-1] {
+			return errors.Errorf("invalid reward percentile: #%v:%v > #%v:%v", i-1, percentiles[i-1], i, p)
+		}
+	}
+	return nil
+}
+
+func (s *Server) FeeHistory(ctx context.Context, blockCount rpc.DecimalOrHex, newestBlock rpc.BlockNumber, percentiles []float64) (*FeeHistoryResult, error) {
+	if err := validatePercentiles(percentiles); err != nil {
+		return nil, err
+	}
+	count := uint64(blockCount)
+	if count > maxFeeHistoryBlocks {
+		count = maxFeeHistoryBlocks
+	}
+	newest, err := s.srv.BlockNum(&newestBlock)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return &FeeHistoryResult{OldestBlock: (*hexutil.Big)(new(big.Int).SetUint64(newest + 1))}, nil
+	}
+	if count > newest+1 {
+		count = newest + 1
+	}
+	oldest := newest + 1 - count
+
+	res := &FeeHistoryResult{
+		OldestBlock:  (*hexutil.Big)(new(big.Int).SetUint64(oldest)),
+		BaseFee:      make([]*hexutil.Big, 0, count+1),
+		GasUsedRatio: make([]float64, 0, count),
+	}
+	if len(percentiles) > 0 {
+		res.Reward = make([][]*hexutil.Big, 0, count)
+	}
+	for height := oldest; height <= newest; height++ {
+		block, err := s.srv.BlockInfoByNumber(height)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, errors.Errorf("block %v not found", height)
+		}
+		blockInfo, txResults, err := s.srv.GetMachineBlockResults(block)
+		if err != nil {
+			return nil, err
+		}
+		if blockInfo == nil {
+			return nil, errors.Errorf("block %v reorged", height)
+		}
+		baseFee := blockBaseFee(blockInfo)
+		res.BaseFee = append(res.BaseFee, (*hexutil.Big)(baseFee))
+
+		gasUsedRatio := float64(0)
+		if gasLimit := blockInfo.GasLimit(); gasLimit.Sign() > 0 {
+			gasUsedRatio, _ = new(big.Rat).SetFrac(blockInfo.BlockStats.GasUsed, gasLimit).Float64()
+		}
+		res.GasUsedRatio = append(res.GasUsedRatio, gasUsedRatio)
+
+		if len(percentiles) > 0 {
+			rewards := txRewards(txResults, baseFee)
+			res.Reward = append(res.Reward, rewardPercentiles(rewards, percentiles))
+		}
+	}
+
+	// The last entry is the base fee of the block after the newest one
+	nextBaseFee, err := s.nextBaseFee(ctx, newest)
+	if err != nil {
+		return nil, err
+	}
+	res.BaseFee = append(res.BaseFee, (*hexutil.Big)(nextBaseFee))
+	return res, nil
+}
+
+func (s *Server) nextBaseFee(ctx context.Context, height uint64) (*big.Int, error) {
+	next, err := s.srv.BlockInfoByNumber(height + 1)
+	if err != nil {
+		return nil, err
+	}
+	if next != nil {
+		blockInfo, err := s.srv.BlockLogFromInfo(next)
+		if err != nil {
+			return nil, err
+		}
+		if blockInfo != nil {
+			return blockBaseFee(blockInfo), nil
+		}
+	}
+	snap, err := s.srv.PendingSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := snap.GetPricesInWei(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return prices[5], nil
+}
+
+// MaxPriorityFeePerGas suggests a tip using the rewards paid in recent
+// blocks. ArbOS charges every transaction the same price, so this is
+// usually zero
+func (s *Server) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big, error) {
+	history, err := s.FeeHistory(ctx, priorityFeeCheckBlocks, rpc.LatestBlockNumber, []float64{priorityFeePercentile})
+	if err != nil {
+		return nil, err
+	}
+	if len(history.Reward) == 0 {
+		return (*hexutil.Big)(big.NewInt(0)), nil
+	}
+	rewards := make([]*big.Int, 0, len(history.Reward))
+	for _, blockRewards := range history.Reward {
+		rewards = append(rewards, blockRewards[0].ToInt())
+	}
+	sort.Slice(rewards, func(i, j int) bool {
+		return rewards[i].Cmp(rewards[j]) < 0
+	})
+	return (*hexutil.Big)(rewards[(len(rewards)-1)*priorityFeePercentile/100]), nil
+}
@@ -26,7 +26,9 @@ import (
 
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/addressindex"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/aggregator"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/traceindex"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
 )
 
@@ -38,7 +40,11 @@ type ServerConfig struct {
 	Mode          configuration.RpcMode
 	MaxCallAVMGas uint64
 	Tracing       configuration.Tracing
+	TraceIndex    *traceindex.Index
+	AddressIndex  *addressindex.Index
 	DevopsStubs   bool
+	TxPool        bool
+	RateLimit     configuration.RateLimit
 }
 
 func GenerateWeb3Server(server *aggregator.Server, privateKeys []*ecdsa.PrivateKey, config ServerConfig, coreConfig *configuration.Core, plugins map[string]interface{}, inboxReader *monitor.InboxReader) (*rpc.Server, error) {
@@ -50,7 +56,7 @@ func GenerateWeb3Server(server *aggregator.Server, privateKeys []*ecdsa.PrivateK
 	}
 
 	ethServer := NewServer(server, config, sequencerInboxWatcher)
-	forwarderServer := NewForwarderServer(server, ethServer, config.Mode)
+	forwarderServer := NewForwarderServer(server, ethServer, config.Mode, config.RateLimit)
 
 	if err := s.RegisterName("eth", forwarderServer); err != nil {
 		return nil, err
@@ -65,19 +71,33 @@ func GenerateWeb3Server(server *aggregator.Server, privateKeys []*ecdsa.PrivateK
 			return nil, err
 		}
 
-		if err := s.RegisterName("eth", NewAccounts(ethServer, privateKeys, config.Mode == configuration.NonMutatingRpcMode)); err != nil {
+		if err := s.RegisterName("eth", NewAccounts(ethServer, forwarderServer, privateKeys, config.Mode == configuration.NonMutatingRpcMode)); err != nil {
 			return nil, err
 		}
 
-		if err := s.RegisterName("arb", &Arb{srv: server}); err != nil {
+		if err := s.RegisterName("arb", NewArb(server, ethServer, config.AddressIndex)); err != nil {
 			return nil, err
 		}
 
+		if err := s.RegisterName("arb", NewSyncSender(ethServer, forwarderServer)); err != nil {
+			return nil, err
+		}
+
+		if config.TxPool {
+			if err := s.RegisterName("txpool", NewTxPool(server)); err != nil {
+				return nil, err
+			}
+		}
+
 		if config.Tracing.Enable {
 			tracer := NewTracer(ethServer, coreConfig)
+			tracer.index = config.TraceIndex
 			if err := s.RegisterName(config.Tracing.Namespace, tracer); err != nil {
 				return nil, err
 			}
+			if err := s.RegisterName("debug", NewDebug(tracer)); err != nil {
+				return nil, err
+			}
 		}
 
 		if len(privateKeys) > 0 {
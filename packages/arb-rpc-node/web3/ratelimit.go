@@ -0,0 +1,227 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+// RateLimitedErrorCode is the JSON-RPC error code returned for throttled
+// transactions, matching the "limit exceeded" code of EIP-1474
+const RateLimitedErrorCode = -32005
+
+// Buckets for the least recently seen keys are dropped beyond this, which
+// only makes the limit more lenient for those keys
+const rateLimitMaxKeys = 100_000
+
+var (
+	senderThrottledCounter = metrics.NewRegisteredCounter("arbitrum/rpc/ratelimit/sender/throttled", nil)
+	ipThrottledCounter     = metrics.NewRegisteredCounter("arbitrum/rpc/ratelimit/ip/throttled", nil)
+	ipUnknownCounter       = metrics.NewRegisteredCounter("arbitrum/rpc/ratelimit/ip/unknown", nil)
+)
+
+type rateLimitedError struct {
+	msg string
+}
+
+func (e *rateLimitedError) Error() string {
+	return e.msg
+}
+
+func (e *rateLimitedError) ErrorCode() int {
+	return RateLimitedErrorCode
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// keyedRateLimiter keeps a token bucket for each key
+type keyedRateLimiter struct {
+	mutex   sync.Mutex
+	rate    float64
+	burst   float64
+	buckets *lru.Cache
+}
+
+func newKeyedRateLimiter(rate float64, burst int) *keyedRateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	buckets, err := lru.New(rateLimitMaxKeys)
+	if err != nil {
+		panic(err)
+	}
+	return &keyedRateLimiter{rate: rate, burst: float64(burst), buckets: buckets}
+}
+
+// allow takes a token from key's bucket, returning false if it's empty
+func (l *keyedRateLimiter) allow(key interface{}, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var bucket *tokenBucket
+	if val, ok := l.buckets.Get(key); ok {
+		bucket = val.(*tokenBucket)
+		bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+		if bucket.tokens > l.burst {
+			bucket.tokens = l.burst
+		}
+	} else {
+		bucket = &tokenBucket{tokens: l.burst}
+		l.buckets.Add(key, bucket)
+	}
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// txRateLimiter limits transactions by sender and by the client IP the
+// request came from
+type txRateLimiter struct {
+	bySender *keyedRateLimiter
+	byIP     *keyedRateLimiter
+}
+
+func newTxRateLimiter(config configuration.RateLimit) *txRateLimiter {
+	return &txRateLimiter{
+		bySender: newKeyedRateLimiter(config.SenderRate, config.SenderBurst),
+		byIP:     newKeyedRateLimiter(config.IPRate, config.IPBurst),
+	}
+}
+
+type clientIPKey struct{}
+
+// ClientIPHandler records the client IP of each HTTP request for the per-IP
+// rate limit. Requests from one of trustedProxies, given as IPs or CIDR
+// ranges, are attributed to the last address in X-Forwarded-For that isn't
+// also a trusted proxy. Websocket connections don't pass the request's
+// context on to their calls, so the per-IP limit only applies over HTTP
+func ClientIPHandler(handler http.Handler, trustedProxies []string) (http.Handler, error) {
+	trusted := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, errors.Errorf("invalid trusted proxy %v", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy %v", proxy)
+		}
+		trusted = append(trusted, ipNet)
+	}
+	isTrusted := func(ip net.IP) bool {
+		for _, ipNet := range trusted {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := requestClientIP(r, isTrusted); ip != nil {
+			r = r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip))
+		}
+		handler.ServeHTTP(w, r)
+	}), nil
+}
+
+func requestClientIP(r *http.Request, isTrusted func(net.IP) bool) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrusted(ip) {
+		return ip
+	}
+	var forwarded []string
+	for _, header := range r.Header["X-Forwarded-For"] {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		forwardedIP := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if forwardedIP == nil {
+			// Anything before this can't be trusted either
+			break
+		}
+		ip = forwardedIP
+		if !isTrusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// clientIP returns the IP recorded by ClientIPHandler, or nil if ctx isn't
+// from an HTTP request
+func clientIP(ctx context.Context) net.IP {
+	ip, _ := ctx.Value(clientIPKey{}).(net.IP)
+	return ip
+}
+
+func (l *txRateLimiter) check(ctx context.Context, tx *types.Transaction) error {
+	now := time.Now()
+	if l.byIP != nil {
+		if ip := clientIP(ctx); ip == nil {
+			// Websocket or in-process requests, which only the sender limit
+			// applies to
+			ipUnknownCounter.Inc(1)
+		} else if !l.byIP.allow(ip.String(), now) {
+			ipThrottledCounter.Inc(1)
+			return &rateLimitedError{msg: "too many transactions from this IP"}
+		}
+	}
+	if l.bySender != nil {
+		sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			return err
+		}
+		if !l.bySender.allow(sender, now) {
+			senderThrottledCounter.Inc(1)
+			return &rateLimitedError{msg: "too many transactions from this sender"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+)
+
+const (
+	syncReceiptTimeout      = 10 * time.Second
+	syncReceiptPollInterval = 10 * time.Millisecond
+)
+
+type SendRawTransactionSyncResult struct {
+	Receipt        *GetTransactionReceiptResult `json:"receipt"`
+	SequenceNumber *hexutil.Big                 `json:"sequenceNumber"`
+	// True if the transaction has been executed by the sequencer but the
+	// batch containing it isn't known to have been posted to L1
+	SoftConfirmation bool `json:"softConfirmation"`
+	// True if the sequencer is holding the transaction until its sender's
+	// earlier nonces arrive, in which case there's no receipt yet
+	Queued bool `json:"queued"`
+}
+
+// SyncSender adds arb_sendRawTransactionSync to the arb namespace
+type SyncSender struct {
+	ethSrv *Server
+	fwdSrv *ForwarderServer
+}
+
+func NewSyncSender(ethSrv *Server, fwdSrv *ForwarderServer) *SyncSender {
+	return &SyncSender{ethSrv: ethSrv, fwdSrv: fwdSrv}
+}
+
+// SendRawTransactionSync submits a transaction and returns its receipt as
+// soon as the sequencer has executed it, saving clients from polling
+// eth_getTransactionReceipt. The L1 batch is only looked up if requested in
+// opts, in which case SoftConfirmation is false once the batch is posted.
+// A transaction held for an earlier nonce returns straight away as Queued
+func (s *SyncSender) SendRawTransactionSync(ctx context.Context, data hexutil.Bytes, opts *ArbGetTxReceiptOpts) (*SendRawTransactionSyncResult, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(data, tx); err != nil {
+		return nil, err
+	}
+	held, err := s.fwdSrv.sendTransaction(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return &SendRawTransactionSyncResult{Queued: true}, nil
+	}
+
+	// The sequencer returns once the transaction has executed, but the
+	// receipt may not have been indexed yet, and a node forwarding to the
+	// sequencer still needs to receive it from the feed
+	ctx, cancel := context.WithTimeout(ctx, syncReceiptTimeout)
+	defer cancel()
+	txHash := tx.Hash().Bytes()
+	for {
+		res, info, inboxState, _, err := s.ethSrv.getTransactionInfoByHash(txHash)
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			processedTx, err := evm.GetTransaction(res)
+			if err != nil {
+				return nil, err
+			}
+			var l1InboxBatchInfo *L1InboxBatchInfo
+			if opts != nil && opts.ReturnL1InboxBatchInfo {
+				l1InboxBatchInfo, err = s.ethSrv.getL1InboxBatchInfo(ctx, inboxState)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return &SendRawTransactionSyncResult{
+				Receipt:          makeTransactionReceiptResult(processedTx, info.Header.Hash(), l1InboxBatchInfo),
+				SequenceNumber:   (*hexutil.Big)(res.IncomingRequest.Provenance.L1SeqNum),
+				SoftConfirmation: l1InboxBatchInfo == nil,
+			}, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Errorf("transaction %v was sent but its receipt isn't available yet", tx.Hash().Hex())
+		case <-time.After(syncReceiptPollInterval):
+		}
+	}
+}
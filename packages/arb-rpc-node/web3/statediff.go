@@ -0,0 +1,189 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+type diffKind int
+
+const (
+	diffSame diffKind = iota
+	diffBorn
+	diffDied
+	diffChanged
+)
+
+// Diff is a single entry of an OpenEthereum style state diff. It serializes
+// to "=" if the value didn't change, {"+": to} if it was created,
+// {"-": from} if it was removed and {"*": {"from": from, "to": to}} otherwise
+type Diff struct {
+	kind diffKind
+	from interface{}
+	to   interface{}
+}
+
+type diffFromTo struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+func (d Diff) MarshalJSON() ([]byte, error) {
+	switch d.kind {
+	case diffBorn:
+		return json.Marshal(map[string]interface{}{"+": d.to})
+	case diffDied:
+		return json.Marshal(map[string]interface{}{"-": d.from})
+	case diffChanged:
+		return json.Marshal(map[string]interface{}{"*": diffFromTo{From: d.from, To: d.to}})
+	default:
+		return json.Marshal("=")
+	}
+}
+
+// AccountDiff is the state diff of a single account. ArbOS doesn't provide a
+// way to enumerate the storage slots written by a transaction, so Storage is
+// always nil and serializes to null rather than claiming nothing changed
+type AccountDiff struct {
+	Balance Diff                 `json:"balance"`
+	Code    Diff                 `json:"code"`
+	Nonce   Diff                 `json:"nonce"`
+	Storage map[common.Hash]Diff `json:"storage"`
+}
+
+type StateDiff map[common.Address]*AccountDiff
+
+type accountState struct {
+	balance *big.Int
+	nonce   *big.Int
+	code    []byte
+}
+
+func (a *accountState) exists() bool {
+	return a.balance.Sign() != 0 || a.nonce.Sign() != 0 || len(a.code) > 0
+}
+
+func getAccountState(ctx context.Context, snap *snapshot.Snapshot, account common.Address) (*accountState, error) {
+	arbAccount := arbcommon.NewAddressFromEth(account)
+	balance, err := snap.GetBalance(ctx, arbAccount)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := snap.GetTransactionCount(ctx, arbAccount)
+	if err != nil {
+		return nil, err
+	}
+	code, err := snap.GetCode(ctx, arbAccount)
+	if err != nil {
+		return nil, err
+	}
+	return &accountState{balance: balance, nonce: nonce, code: code}, nil
+}
+
+func diffValues(same bool, from, to interface{}) Diff {
+	if same {
+		return Diff{kind: diffSame}
+	}
+	return Diff{kind: diffChanged, from: from, to: to}
+}
+
+// diffAccount returns nil if the account is unchanged
+func diffAccount(before, after *accountState) *AccountDiff {
+	existedBefore := before.exists()
+	existsAfter := after.exists()
+	if !existedBefore && !existsAfter {
+		return nil
+	}
+	if !existedBefore {
+		return &AccountDiff{
+			Balance: Diff{kind: diffBorn, to: (*hexutil.Big)(after.balance)},
+			Code:    Diff{kind: diffBorn, to: hexutil.Bytes(after.code)},
+			Nonce:   Diff{kind: diffBorn, to: (*hexutil.Big)(after.nonce)},
+		}
+	}
+	if !existsAfter {
+		return &AccountDiff{
+			Balance: Diff{kind: diffDied, from: (*hexutil.Big)(before.balance)},
+			Code:    Diff{kind: diffDied, from: hexutil.Bytes(before.code)},
+			Nonce:   Diff{kind: diffDied, from: (*hexutil.Big)(before.nonce)},
+		}
+	}
+	sameBalance := before.balance.Cmp(after.balance) == 0
+	sameNonce := before.nonce.Cmp(after.nonce) == 0
+	sameCode := bytes.Equal(before.code, after.code)
+	if sameBalance && sameNonce && sameCode {
+		return nil
+	}
+	return &AccountDiff{
+		Balance: diffValues(sameBalance, (*hexutil.Big)(before.balance), (*hexutil.Big)(after.balance)),
+		Code:    diffValues(sameCode, hexutil.Bytes(before.code), hexutil.Bytes(after.code)),
+		Nonce:   diffValues(sameNonce, (*hexutil.Big)(before.nonce), (*hexutil.Big)(after.nonce)),
+	}
+}
+
+func touchedAccounts(frames []TraceFrame) []common.Address {
+	seen := make(map[common.Address]struct{})
+	accounts := make([]common.Address, 0)
+	add := func(account common.Address) {
+		if _, ok := seen[account]; ok {
+			return
+		}
+		seen[account] = struct{}{}
+		accounts = append(accounts, account)
+	}
+	for _, frame := range frames {
+		add(frame.Action.From)
+		if frame.Action.To != nil {
+			add(*frame.Action.To)
+		}
+		if frame.Result != nil && frame.Result.Address != nil {
+			add(*frame.Result.Address)
+		}
+	}
+	return accounts
+}
+
+// getStateDiff compares the balance, nonce and code of every account touched
+// by the given frames between the two snapshots. Storage isn't diffed, see
+// AccountDiff
+func getStateDiff(ctx context.Context, before, after *snapshot.Snapshot, frames []TraceFrame) (StateDiff, error) {
+	diff := make(StateDiff)
+	for _, account := range touchedAccounts(frames) {
+		beforeState, err := getAccountState(ctx, before, account)
+		if err != nil {
+			return nil, err
+		}
+		afterState, err := getAccountState(ctx, after, account)
+		if err != nil {
+			return nil, err
+		}
+		if accountDiff := diffAccount(beforeState, afterState); accountDiff != nil {
+			diff[account] = accountDiff
+		}
+	}
+	return diff, nil
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/traceindex"
 	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
@@ -72,15 +73,16 @@ type TraceFrame struct {
 
 type TraceResult struct {
 	Output             hexutil.Bytes     `json:"output"`
-	StateDiff          *int              `json:"stateDiff"`
+	StateDiff          StateDiff         `json:"stateDiff"`
 	Trace              []TraceFrame      `json:"trace"`
-	VmTrace            *int              `json:"vmTrace"`
+	VmTrace            *VmTrace          `json:"vmTrace"`
 	DestroyedContracts *[]common.Address `json:"destroyedContracts"`
 }
 
 type Trace struct {
 	s          *Server
 	coreConfig *configuration.Core
+	index      *traceindex.Index
 }
 
 func NewTracer(s *Server, coreConfig *configuration.Core) *Trace {
@@ -95,25 +97,24 @@ func extractValuesFromEmissions(emissions []core.MachineEmission) []value.Value
 	return values
 }
 
-func extractTrace(debugPrints []value.Value) (*evm.EVMTrace, error) {
-	var trace *evm.EVMTrace
+func extractTrace(debugPrints []value.Value) (*evm.EVMTrace, []*evm.EVMOpcodeLog, error) {
+	logLines := make([]evm.EVMLogLine, 0, len(debugPrints))
+	opcodes := make([]*evm.EVMOpcodeLog, 0)
 	for _, debugPrint := range debugPrints {
 		parsedLog, err := evm.NewLogLineFromValue(debugPrint)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		foundTrace, ok := parsedLog.(*evm.EVMTrace)
-		if ok {
-			if trace != nil {
-				return nil, errors.New("found multiple traces")
-			}
-			trace = foundTrace
+		if opcode, ok := parsedLog.(*evm.EVMOpcodeLog); ok {
+			opcodes = append(opcodes, opcode)
 		}
+		logLines = append(logLines, parsedLog)
 	}
-	if trace == nil {
-		return nil, errors.New("found no trace")
+	trace, err := evm.GetTraceFromLogLines(logLines)
+	if err != nil {
+		return nil, nil, err
 	}
-	return trace, nil
+	return trace, opcodes, nil
 }
 
 func getDestroyedContracts(ctx context.Context, snap *snapshot.Snapshot, frames []TraceFrame) ([]common.Address, error) {
@@ -273,19 +274,28 @@ func renderTraceFrames(txRes *evm.TxResult, trace *evm.EVMTrace) ([]TraceFrame,
 	return resFrames, nil
 }
 
-func authenticateTraceType(traceTypes []string) (bool, error) {
+type traceOptions struct {
+	destroyed bool
+	stateDiff bool
+	vmTrace   bool
+	prestate  bool
+}
+
+func authenticateTraceType(traceTypes []string) (traceOptions, error) {
 	types := make(map[string]struct{})
 	for _, typ := range traceTypes {
-		if typ != "trace" && typ != "deletedContracts" {
-			return false, errors.Errorf("unsupported trace type: %v", typ)
+		if typ != "trace" && typ != "deletedContracts" && typ != "stateDiff" && typ != "vmTrace" {
+			return traceOptions{}, errors.Errorf("unsupported trace type: %v", typ)
 		}
 		types[typ] = struct{}{}
 	}
 	if _, found := types["trace"]; !found {
-		return false, errors.New("must specify trace type as 'trace'")
+		return traceOptions{}, errors.New("must specify trace type as 'trace'")
 	}
 	_, traceDestroys := types["deletedContracts"]
-	return traceDestroys, nil
+	_, traceStateDiff := types["stateDiff"]
+	_, traceVm := types["vmTrace"]
+	return traceOptions{destroyed: traceDestroys, stateDiff: traceStateDiff, vmTrace: traceVm}, nil
 }
 
 func (t *Trace) getSnapAfterTx(ctx context.Context, cursor core.ExecutionCursor) (*snapshot.Snapshot, error) {
@@ -340,11 +350,19 @@ func fillInTopLevelCreate(ctx context.Context, frames []TraceFrame, snap *snapsh
 	}
 }
 
-func (t *Trace) traceTransaction(ctx context.Context, cursor core.ExecutionCursor, res *evm.TxResult, logNumber *big.Int, traceDestroyed bool) (*rawTxTrace, error) {
+func (t *Trace) traceTransaction(ctx context.Context, cursor core.ExecutionCursor, res *evm.TxResult, logNumber *big.Int, opts traceOptions) (*rawTxTrace, error) {
 	maxGas := int64(t.coreConfig.CheckpointMaxExecutionGas)
 	if maxGas == 0 {
 		maxGas = 100000000000
 	}
+	var snapBefore *snapshot.Snapshot
+	if opts.stateDiff || opts.vmTrace || opts.prestate {
+		var err error
+		snapBefore, err = t.getSnapAfterTx(ctx, cursor.Clone())
+		if err != nil {
+			return nil, err
+		}
+	}
 	debugPrints, err := t.s.srv.GetLookup().AdvanceExecutionCursorWithTracing(
 		cursor,
 		big.NewInt(maxGas),
@@ -356,18 +374,18 @@ func (t *Trace) traceTransaction(ctx context.Context, cursor core.ExecutionCurso
 	if err != nil {
 		return nil, err
 	}
-	vmTrace, err := extractTrace(extractValuesFromEmissions(debugPrints))
+	evmTrace, opcodes, err := extractTrace(extractValuesFromEmissions(debugPrints))
 	if err != nil {
 		return nil, err
 	}
-	frames, err := renderTraceFrames(res, vmTrace)
+	frames, err := renderTraceFrames(res, evmTrace)
 	if err != nil {
 		return nil, err
 	}
 
 	var snap *snapshot.Snapshot
 	neadsCode := needsTopLevelCreate(frames)
-	if neadsCode || traceDestroyed {
+	if neadsCode || opts.destroyed || opts.stateDiff || opts.vmTrace {
 		snap, err = t.getSnapAfterTx(ctx, cursor.Clone())
 		if err != nil {
 			return nil, err
@@ -378,7 +396,7 @@ func (t *Trace) traceTransaction(ctx context.Context, cursor core.ExecutionCurso
 	}
 
 	var destroyed *[]common.Address
-	if traceDestroyed {
+	if opts.destroyed {
 		destroyedTmp, err := getDestroyedContracts(ctx, snap, frames)
 		if err != nil {
 			return nil, err
@@ -386,14 +404,42 @@ func (t *Trace) traceTransaction(ctx context.Context, cursor core.ExecutionCurso
 		destroyed = &destroyedTmp
 	}
 
+	var stateDiff StateDiff
+	if opts.stateDiff {
+		stateDiff, err = getStateDiff(ctx, snapBefore, snap, frames)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var vmTrace *VmTrace
+	if opts.vmTrace {
+		vmTrace, err = getVmTrace(ctx, evmTrace, opcodes, frames, snapBefore, snap)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var prestate Prestate
+	if opts.prestate {
+		prestate, err = getPrestate(ctx, snapBefore, frames)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &rawTxTrace{
 		frames:    frames,
 		res:       res,
+		evmTrace:  evmTrace,
 		destroyed: destroyed,
+		stateDiff: stateDiff,
+		vmTrace:   vmTrace,
+		prestate:  prestate,
 	}, nil
 }
 
-func (t *Trace) transaction(ctx context.Context, txHash hexutil.Bytes, traceDestroyed bool) (*rawTxTrace, *machine.BlockInfo, error) {
+func (t *Trace) transaction(ctx context.Context, txHash hexutil.Bytes, opts traceOptions) (*rawTxTrace, *machine.BlockInfo, error) {
 	res, blockInfo, _, logNumber, err := t.s.getTransactionInfoByHash(txHash)
 	if err != nil || res == nil {
 		return nil, nil, err
@@ -403,17 +449,21 @@ func (t *Trace) transaction(ctx context.Context, txHash hexutil.Bytes, traceDest
 	if err != nil {
 		return nil, nil, err
 	}
-	txTrace, err := t.traceTransaction(ctx, cursor, res, logNumber, traceDestroyed)
+	txTrace, err := t.traceTransaction(ctx, cursor, res, logNumber, opts)
 	return txTrace, blockInfo, err
 }
 
 type rawTxTrace struct {
 	frames    []TraceFrame
 	res       *evm.TxResult
+	evmTrace  *evm.EVMTrace
 	destroyed *[]common.Address
+	stateDiff StateDiff
+	vmTrace   *VmTrace
+	prestate  Prestate
 }
 
-func (t *Trace) block(ctx context.Context, blockNum rpc.BlockNumberOrHash, traceDestroyed bool) ([]*rawTxTrace, *machine.BlockInfo, core.ExecutionCursor, error) {
+func (t *Trace) block(ctx context.Context, blockNum rpc.BlockNumberOrHash, opts traceOptions) ([]*rawTxTrace, *machine.BlockInfo, core.ExecutionCursor, error) {
 	blockInfo, err := t.s.blockInfoForNumberOrHash(blockNum)
 	if err != nil || blockInfo == nil {
 		return nil, nil, nil, err
@@ -436,7 +486,7 @@ func (t *Trace) block(ctx context.Context, blockNum rpc.BlockNumberOrHash, trace
 	res := make([]*rawTxTrace, 0, len(txResults))
 	for i := uint64(0); i < blockLog.BlockStats.TxCount.Uint64(); i++ {
 		txRes := txResults[i]
-		txTrace, err := t.traceTransaction(ctx, cursor, txRes, logIndex, traceDestroyed)
+		txTrace, err := t.traceTransaction(ctx, cursor, txRes, logIndex, opts)
 		logIndex.Add(logIndex, big.NewInt(1))
 		if err != nil {
 			logger.
@@ -452,10 +502,10 @@ func (t *Trace) block(ctx context.Context, blockNum rpc.BlockNumberOrHash, trace
 	return res, blockInfo, cursor, nil
 }
 
-func (t *Trace) handleCallRequest(ctx context.Context, callArgs CallTxArgs, traceDestroys bool, snap *snapshot.Snapshot) (*TraceResult, error) {
+func (t *Trace) traceCall(ctx context.Context, callArgs CallTxArgs, opts traceOptions, snapBefore *snapshot.Snapshot) (*rawTxTrace, error) {
 	from, msg := buildCallMsg(callArgs)
 	// We're mutating so we need unique ownership
-	snap = snap.Clone()
+	snap := snapBefore.Clone()
 	callRes, debugPrints, err := snap.AddContractMessage(ctx, msg, from, t.s.maxAVMGas, true)
 	if err != nil {
 		return nil, err
@@ -463,11 +513,11 @@ func (t *Trace) handleCallRequest(ctx context.Context, callArgs CallTxArgs, trac
 	if callRes.ResultCode != evm.ReturnCode && callRes.ResultCode != evm.RevertCode {
 		return nil, evm.HandleCallError(callRes, t.s.ganacheMode)
 	}
-	vmTrace, err := extractTrace(debugPrints)
+	evmTrace, opcodes, err := extractTrace(debugPrints)
 	if err != nil {
 		return nil, err
 	}
-	frames, err := renderTraceFrames(callRes, vmTrace)
+	frames, err := renderTraceFrames(callRes, evmTrace)
 	if err != nil {
 		return nil, err
 	}
@@ -476,7 +526,7 @@ func (t *Trace) handleCallRequest(ctx context.Context, callArgs CallTxArgs, trac
 	}
 
 	var destroyed *[]common.Address
-	if traceDestroys {
+	if opts.destroyed {
 		destroyedTmp, err := getDestroyedContracts(ctx, snap, frames)
 		if err != nil {
 			return nil, err
@@ -484,15 +534,57 @@ func (t *Trace) handleCallRequest(ctx context.Context, callArgs CallTxArgs, trac
 		destroyed = &destroyedTmp
 	}
 
+	var stateDiff StateDiff
+	if opts.stateDiff {
+		stateDiff, err = getStateDiff(ctx, snapBefore, snap, frames)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var vmTrace *VmTrace
+	if opts.vmTrace {
+		vmTrace, err = getVmTrace(ctx, evmTrace, opcodes, frames, snapBefore, snap)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var prestate Prestate
+	if opts.prestate {
+		prestate, err = getPrestate(ctx, snapBefore, frames)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &rawTxTrace{
+		frames:    frames,
+		res:       callRes,
+		evmTrace:  evmTrace,
+		destroyed: destroyed,
+		stateDiff: stateDiff,
+		vmTrace:   vmTrace,
+		prestate:  prestate,
+	}, nil
+}
+
+func (t *Trace) handleCallRequest(ctx context.Context, callArgs CallTxArgs, opts traceOptions, snapBefore *snapshot.Snapshot) (*TraceResult, error) {
+	txTrace, err := t.traceCall(ctx, callArgs, opts, snapBefore)
+	if err != nil {
+		return nil, err
+	}
 	return &TraceResult{
-		Output:             callRes.ReturnData,
-		Trace:              frames,
-		DestroyedContracts: destroyed,
+		Output:             txTrace.res.ReturnData,
+		StateDiff:          txTrace.stateDiff,
+		Trace:              txTrace.frames,
+		VmTrace:            txTrace.vmTrace,
+		DestroyedContracts: txTrace.destroyed,
 	}, nil
 }
 
 func (t *Trace) Call(ctx context.Context, callArgs CallTxArgs, traceTypes []string, blockNum rpc.BlockNumberOrHash) (*TraceResult, error) {
-	traceDestroys, err := authenticateTraceType(traceTypes)
+	opts, err := authenticateTraceType(traceTypes)
 	if err != nil {
 		return nil, err
 	}
@@ -501,7 +593,7 @@ func (t *Trace) Call(ctx context.Context, callArgs CallTxArgs, traceTypes []stri
 	if err != nil {
 		return nil, err
 	}
-	return t.handleCallRequest(ctx, callArgs, traceDestroys, snap)
+	return t.handleCallRequest(ctx, callArgs, opts, snap)
 }
 
 type CallTraceRequest struct {
@@ -521,13 +613,13 @@ func (at *CallTraceRequest) UnmarshalJSON(b []byte) error {
 }
 
 func (t *Trace) CallMany(ctx context.Context, calls []*CallTraceRequest, blockNum rpc.BlockNumberOrHash) ([]*TraceResult, error) {
-	traceDestroys := make([]bool, 0, len(calls))
+	callOpts := make([]traceOptions, 0, len(calls))
 	for _, call := range calls {
-		traceDestroy, err := authenticateTraceType(call.traceTypes)
+		opts, err := authenticateTraceType(call.traceTypes)
 		if err != nil {
 			return nil, err
 		}
-		traceDestroys = append(traceDestroys, traceDestroy)
+		callOpts = append(callOpts, opts)
 	}
 	snap, err := t.s.getSnapshotForNumberOrHash(ctx, blockNum)
 	if err != nil {
@@ -536,7 +628,7 @@ func (t *Trace) CallMany(ctx context.Context, calls []*CallTraceRequest, blockNu
 
 	traces := make([]*TraceResult, 0, len(calls))
 	for i, call := range calls {
-		frame, err := t.handleCallRequest(ctx, call.callArgs, traceDestroys[i], snap)
+		frame, err := t.handleCallRequest(ctx, call.callArgs, callOpts[i], snap)
 		if err != nil {
 			return nil, err
 		}
@@ -546,11 +638,11 @@ func (t *Trace) CallMany(ctx context.Context, calls []*CallTraceRequest, blockNu
 }
 
 func (t *Trace) ReplayBlockTransactions(ctx context.Context, blockNum rpc.BlockNumberOrHash, traceTypes []string) ([]*TraceResult, error) {
-	traceDestroys, err := authenticateTraceType(traceTypes)
+	opts, err := authenticateTraceType(traceTypes)
 	if err != nil {
 		return nil, err
 	}
-	txTraces, blockInfo, _, err := t.block(ctx, blockNum, traceDestroys)
+	txTraces, blockInfo, _, err := t.block(ctx, blockNum, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -562,7 +654,9 @@ func (t *Trace) ReplayBlockTransactions(ctx context.Context, blockNum rpc.BlockN
 		}
 		results = append(results, &TraceResult{
 			Output:             txTrace.res.ReturnData,
+			StateDiff:          txTrace.stateDiff,
 			Trace:              txTrace.frames,
+			VmTrace:            txTrace.vmTrace,
 			DestroyedContracts: txTrace.destroyed,
 		})
 	}
@@ -570,18 +664,20 @@ func (t *Trace) ReplayBlockTransactions(ctx context.Context, blockNum rpc.BlockN
 }
 
 func (t *Trace) ReplayTransaction(ctx context.Context, txHash hexutil.Bytes, traceTypes []string) (*TraceResult, error) {
-	traceDestroys, err := authenticateTraceType(traceTypes)
+	opts, err := authenticateTraceType(traceTypes)
 	if err != nil {
 		return nil, err
 	}
-	txTrace, _, err := t.transaction(ctx, txHash, traceDestroys)
+	txTrace, _, err := t.transaction(ctx, txHash, opts)
 	if err != nil || txTrace.res == nil {
 		return nil, err
 	}
 
 	return &TraceResult{
 		Output:             txTrace.res.ReturnData,
+		StateDiff:          txTrace.stateDiff,
 		Trace:              txTrace.frames,
+		VmTrace:            txTrace.vmTrace,
 		DestroyedContracts: txTrace.destroyed,
 	}, nil
 }
@@ -614,7 +710,7 @@ func addChainContext(frame *TraceFrame, context *chainContext) {
 }
 
 func (t *Trace) Transaction(ctx context.Context, txHash hexutil.Bytes) ([]TraceFrame, error) {
-	txTrace, blockInfo, err := t.transaction(ctx, txHash, false)
+	txTrace, blockInfo, err := t.transaction(ctx, txHash, traceOptions{})
 	if err != nil || txTrace == nil {
 		return nil, err
 	}
@@ -645,7 +741,7 @@ func (t *Trace) Get(ctx context.Context, txHash hexutil.Bytes, path []hexutil.Ui
 }
 
 func (t *Trace) Block(ctx context.Context, blockNum rpc.BlockNumberOrHash) ([]TraceFrame, error) {
-	txTraces, blockInfo, _, err := t.block(ctx, blockNum, false)
+	txTraces, blockInfo, _, err := t.block(ctx, blockNum, traceOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -689,23 +785,37 @@ func (t *Trace) Filter(ctx context.Context, filter *FilterRequest) ([]TraceFrame
 	if fromBlockInfo.LogCount > toBlockInfo.LogCount {
 		return nil, nil
 	}
-	start := rpc.BlockNumber(fromBlockInfo.Header.Number.Int64())
-	end := rpc.BlockNumber(toBlockInfo.Header.Number.Int64())
+	start := fromBlockInfo.Header.Number.Uint64()
+	end := toBlockInfo.Header.Number.Uint64()
 
 	fromAddrFilter := make(map[common.Address]struct{})
+	var fromAddrs []common.Address
 	if filter.FromAddress != nil {
-		for _, addr := range *filter.FromAddress {
+		fromAddrs = *filter.FromAddress
+		for _, addr := range fromAddrs {
 			fromAddrFilter[addr] = struct{}{}
 		}
 	}
 
 	toAddrFilter := make(map[common.Address]struct{})
+	var toAddrs []common.Address
 	if filter.ToAddress != nil {
-		for _, addr := range *filter.ToAddress {
+		toAddrs = *filter.ToAddress
+		for _, addr := range toAddrs {
 			toAddrFilter[addr] = struct{}{}
 		}
 	}
 
+	var blocks []uint64
+	if t.index != nil {
+		blocks = t.index.Blocks(fromAddrs, toAddrs, start, end)
+	} else {
+		blocks = make([]uint64, 0, end-start+1)
+		for blockNum := start; blockNum <= end; blockNum++ {
+			blocks = append(blocks, blockNum)
+		}
+	}
+
 	totalTraces := uint64(0)
 	if filter.After != nil {
 		totalTraces += *filter.After
@@ -717,8 +827,8 @@ func (t *Trace) Filter(ctx context.Context, filter *FilterRequest) ([]TraceFrame
 	}
 	traces := make([]TraceFrame, 0)
 blockLoop:
-	for blockNum := start; blockNum <= end; blockNum++ {
-		txTraces, blockInfo, _, err := t.block(ctx, rpc.BlockNumberOrHashWithNumber(blockNum), false)
+	for _, blockNum := range blocks {
+		txTraces, blockInfo, _, err := t.block(ctx, rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(blockNum)), traceOptions{})
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,127 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/aggregator"
+)
+
+// TxPool implements the txpool namespace, which on a sequencer reports the
+// transactions waiting to be sequenced (pending) and those held waiting for
+// an earlier nonce (queued)
+type TxPool struct {
+	srv *aggregator.Server
+}
+
+func NewTxPool(srv *aggregator.Server) *TxPool {
+	return &TxPool{srv: srv}
+}
+
+func makePendingTransactionResult(tx *types.Transaction, from common.Address) *TransactionResult {
+	vVal, rVal, sVal := tx.RawSignatureValues()
+	subtype := hexutil.Uint64(message.CompressedECDSA)
+	return &TransactionResult{
+		From:     from,
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: (*hexutil.Big)(tx.GasPrice()),
+		Hash:     tx.Hash(),
+		Input:    tx.Data(),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		To:       tx.To(),
+		Value:    (*hexutil.Big)(tx.Value()),
+		V:        (*hexutil.Big)(vVal),
+		R:        (*hexutil.Big)(rVal),
+		S:        (*hexutil.Big)(sVal),
+
+		ArbType:    hexutil.Uint64(message.L2Type),
+		ArbSubType: &subtype,
+	}
+}
+
+func formatTxPool(
+	txes map[common.Address][]*types.Transaction,
+	format func(*types.Transaction, common.Address) interface{},
+) map[string]map[string]interface{} {
+	res := make(map[string]map[string]interface{}, len(txes))
+	for sender, senderTxes := range txes {
+		dump := make(map[string]interface{}, len(senderTxes))
+		for _, tx := range senderTxes {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx, sender)
+		}
+		res[sender.Hex()] = dump
+	}
+	return res
+}
+
+// Content returns the unsequenced transactions grouped by sender and nonce
+func (t *TxPool) Content() (map[string]map[string]map[string]interface{}, error) {
+	content, err := t.srv.TxPoolContent()
+	if err != nil {
+		return nil, err
+	}
+	format := func(tx *types.Transaction, from common.Address) interface{} {
+		return makePendingTransactionResult(tx, from)
+	}
+	return map[string]map[string]map[string]interface{}{
+		"pending": formatTxPool(content.Pending, format),
+		"queued":  formatTxPool(content.Queued, format),
+	}, nil
+}
+
+// Status returns the number of pending and queued transactions
+func (t *TxPool) Status() (map[string]hexutil.Uint, error) {
+	content, err := t.srv.TxPoolContent()
+	if err != nil {
+		return nil, err
+	}
+	count := func(txes map[common.Address][]*types.Transaction) hexutil.Uint {
+		total := 0
+		for _, senderTxes := range txes {
+			total += len(senderTxes)
+		}
+		return hexutil.Uint(total)
+	}
+	return map[string]hexutil.Uint{
+		"pending": count(content.Pending),
+		"queued":  count(content.Queued),
+	}, nil
+}
+
+// Inspect returns a textual summary of each unsequenced transaction
+func (t *TxPool) Inspect() (map[string]map[string]map[string]interface{}, error) {
+	content, err := t.srv.TxPoolContent()
+	if err != nil {
+		return nil, err
+	}
+	format := func(tx *types.Transaction, _ common.Address) interface{} {
+		if to := tx.To(); to != nil {
+			return fmt.Sprintf("%s: %v wei + %v gas × %v wei", to.Hex(), tx.Value(), tx.Gas(), tx.GasPrice())
+		}
+		return fmt.Sprintf("contract creation: %v wei + %v gas × %v wei", tx.Value(), tx.Gas(), tx.GasPrice())
+	}
+	return map[string]map[string]map[string]interface{}{
+		"pending": formatTxPool(content.Pending, format),
+		"queued":  formatTxPool(content.Queued, format),
+	}, nil
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// VmTraceOp is a single executed opcode. ArbOS only reports the program
+// counter and opcode of each executed instruction, so Cost and Ex are always
+// nil. They're still serialized, as null, so that the ops have the same
+// fields as OpenEthereum's
+type VmTraceOp struct {
+	Pc   uint64          `json:"pc"`
+	Op   string          `json:"op"`
+	Cost *hexutil.Uint64 `json:"cost"`
+	Ex   *VmTraceEx      `json:"ex"`
+	Sub  *VmTrace        `json:"sub"`
+}
+
+// VmTraceEx is OpenEthereum's record of an opcode's effects, which ArbOS
+// doesn't report
+type VmTraceEx struct {
+	Mem   *VmTraceMem     `json:"mem"`
+	Push  []hexutil.Big   `json:"push"`
+	Store *VmTraceStore   `json:"store"`
+	Used  *hexutil.Uint64 `json:"used"`
+}
+
+type VmTraceMem struct {
+	Data hexutil.Bytes  `json:"data"`
+	Off  hexutil.Uint64 `json:"off"`
+}
+
+type VmTraceStore struct {
+	Key hexutil.Big `json:"key"`
+	Val hexutil.Big `json:"val"`
+}
+
+type VmTrace struct {
+	Code hexutil.Bytes `json:"code"`
+	Ops  []VmTraceOp   `json:"ops"`
+}
+
+func isCallOrCreateOp(op vm.OpCode) bool {
+	switch op {
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL, vm.CREATE, vm.CREATE2:
+		return true
+	default:
+		return false
+	}
+}
+
+func isHaltingOp(op vm.OpCode) bool {
+	switch op {
+	case vm.STOP, vm.RETURN, vm.REVERT, vm.SELFDESTRUCT, vm.INVALID:
+		return true
+	default:
+		return false
+	}
+}
+
+type vmTraceFrame struct {
+	trace     *VmTrace
+	frame     *evm.CallFrame
+	nextChild int
+	// Whether the last opcode executed in this frame is the one its return
+	// trace says it stopped at
+	atReturnPC bool
+}
+
+// failedBefore returns whether the frame failed with an error before opLog.
+// The return trace records the opcode a failed frame stopped at, so it ends
+// once it's executed that opcode and execution resumes after the call in
+// its caller. Checking both means a callee opcode which happens to share a
+// PC with either isn't taken for the end of the frame
+func (f *vmTraceFrame) failedBefore(opLog *evm.EVMOpcodeLog) bool {
+	if !frameFailed(f.frame) {
+		return false
+	}
+	knownReturnPC := f.frame.Return != nil && f.frame.Return.PC != nil
+	if knownReturnPC && !f.atReturnPC {
+		return false
+	}
+	call := f.frame.Call
+	if call == nil || call.PC == nil {
+		return knownReturnPC
+	}
+	return opLog.PC() == *call.PC+1
+}
+
+// renderVmTrace nests the flat list of executed opcodes by call frame. The
+// frame tree tells us which call or create opcode started each nested frame
+// and how it ended. A nested frame ends on a halting opcode, or if it failed
+// with an error, after the opcode its return trace records it stopping at
+func renderVmTrace(root evm.Frame, rootCode []byte, opcodes []*evm.EVMOpcodeLog, getCode func(evm.Frame) []byte) *VmTrace {
+	rootTrace := &VmTrace{Code: rootCode, Ops: make([]VmTraceOp, 0)}
+	if root == nil {
+		return rootTrace
+	}
+	stack := []*vmTraceFrame{{trace: rootTrace, frame: root.GetCallFrame()}}
+	for _, opLog := range opcodes {
+		current := stack[len(stack)-1]
+		if len(stack) > 1 && current.failedBefore(opLog) {
+			stack = stack[:len(stack)-1]
+			current = stack[len(stack)-1]
+		}
+
+		op := vm.OpCode(opLog.Op())
+		current.trace.Ops = append(current.trace.Ops, VmTraceOp{
+			Pc: opLog.PC(),
+			Op: op.String(),
+		})
+		if ret := current.frame.Return; ret != nil && ret.PC != nil {
+			current.atReturnPC = opLog.PC() == *ret.PC
+		}
+
+		if isHaltingOp(op) {
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		if !isCallOrCreateOp(op) || current.nextChild >= len(current.frame.Nested) {
+			continue
+		}
+		child := current.frame.Nested[current.nextChild]
+		childCallFrame := child.GetCallFrame()
+		if childCallFrame.Call.PC != nil && *childCallFrame.Call.PC != opLog.PC() {
+			continue
+		}
+		current.nextChild++
+		code := getCode(child)
+		sub := &VmTrace{Code: code, Ops: make([]VmTraceOp, 0)}
+		current.trace.Ops[len(current.trace.Ops)-1].Sub = sub
+		if len(code) > 0 {
+			stack = append(stack, &vmTraceFrame{trace: sub, frame: childCallFrame})
+		}
+	}
+	return rootTrace
+}
+
+func frameFailed(frame *evm.CallFrame) bool {
+	return frame.Return == nil || (frame.Return.Result != evm.ReturnCode && frame.Return.Result != evm.RevertCode)
+}
+
+// getVmTrace builds the vmTrace for a transaction. Code for nested calls is
+// looked up in the snapshot from before the transaction, falling back to the
+// snapshot after it for contracts created by the transaction
+func getVmTrace(ctx context.Context, trace *evm.EVMTrace, opcodes []*evm.EVMOpcodeLog, frames []TraceFrame, before, after *snapshot.Snapshot) (*VmTrace, error) {
+	root, err := trace.FrameTree()
+	if err != nil {
+		return nil, err
+	}
+	lookupCode := func(account arbcommon.Address) []byte {
+		code, err := before.GetCode(ctx, account)
+		if err == nil && len(code) > 0 {
+			return code
+		}
+		code, err = after.GetCode(ctx, account)
+		if err != nil {
+			logger.Warn().Err(err).Str("account", account.Hex()).Msg("failed to retrieve code for vmTrace")
+			return nil
+		}
+		return code
+	}
+	getCode := func(frame evm.Frame) []byte {
+		switch frame := frame.(type) {
+		case *evm.CreateFrame:
+			return frame.Create.Code
+		case *evm.Create2Frame:
+			return frame.Create.Code
+		default:
+			to := frame.GetCallFrame().Call.To
+			if to == nil {
+				return nil
+			}
+			return lookupCode(*to)
+		}
+	}
+
+	var rootCode []byte
+	if len(frames) > 0 && frames[0].Type == "create" {
+		rootCode = frames[0].Action.Init
+	} else if root != nil {
+		rootCode = getCode(root)
+	}
+	return renderVmTrace(root, rootCode, opcodes, getCode), nil
+}
@@ -32,6 +32,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/gobwas/httphead"
 	"github.com/gobwas/ws"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcaster"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
@@ -45,9 +46,10 @@ type BroadcastClient struct {
 
 	chainId uint64
 
-	connMutex *sync.Mutex
-	conn      net.Conn
-	errChan   chan error
+	connMutex   *sync.Mutex
+	conn        net.Conn
+	compression bool
+	errChan     chan error
 
 	retryMutex *sync.Mutex
 	retryCount int
@@ -181,10 +183,11 @@ func (bc *BroadcastClient) connect(ctx context.Context, messageReceiver chan bro
 			}
 			return nil
 		},
-		Timeout: 10 * time.Second,
+		Timeout:    10 * time.Second,
+		Extensions: []httphead.Option{wsbroadcastserver.DeflateOffer()},
 	}
 
-	conn, br, _, err := timeoutDialer.Dial(ctx, bc.websocketUrl)
+	conn, br, hs, err := timeoutDialer.Dial(ctx, bc.websocketUrl)
 	if err != nil {
 		logger.Warn().Err(err).Msg("broadcast client unable to connect")
 		return nil, nil, errors.Wrap(err, "broadcast client unable to connect")
@@ -204,9 +207,10 @@ func (bc *BroadcastClient) connect(ctx context.Context, messageReceiver chan bro
 
 	bc.connMutex.Lock()
 	bc.conn = conn
+	bc.compression = wsbroadcastserver.DeflateAccepted(hs.Extensions)
 	bc.connMutex.Unlock()
 
-	logger.Info().Uint64("chainId", bc.chainId).Uint64("feedServerVersion", feedServerVersion).Msg("Connected")
+	logger.Info().Uint64("chainId", bc.chainId).Uint64("feedServerVersion", feedServerVersion).Bool("compression", bc.compression).Msg("Connected")
 
 	return earlyFrameData, messageReceiver, nil
 }
@@ -220,7 +224,7 @@ func (bc *BroadcastClient) startBackgroundReader(ctx context.Context, messageRec
 			default:
 			}
 
-			msg, op, err := wsbroadcastserver.ReadData(ctx, bc.conn, earlyFrameData, bc.idleTimeout, ws.StateClientSide)
+			msg, op, err := wsbroadcastserver.ReadData(ctx, bc.conn, earlyFrameData, bc.idleTimeout, ws.StateClientSide, bc.compression)
 			if err != nil {
 				if bc.shuttingDown {
 					return
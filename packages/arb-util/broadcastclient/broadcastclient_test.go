@@ -355,3 +355,63 @@ func connectAndGetCachedMessages(ctx context.Context, t *testing.T, clientIndex
 
 	return nil
 }
+
+func TestReceiveCompressedMessages(t *testing.T) {
+	ctx := context.Background()
+
+	settings := configuration.DefaultFeedOutput()
+	settings.Port = "9745"
+	settings.Compression = true
+
+	b := broadcaster.NewBroadcaster(settings, 9745)
+
+	_, err := b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop()
+
+	// Cached messages are compressed for the client as it connects
+	newBroadcastMessage := broadcaster.SequencedMessages()
+	for i := 0; i < 3; i++ {
+		prevAcc, feedItem, signature := newBroadcastMessage()
+		if err := b.BroadcastSingle(prevAcc, feedItem.BatchItem, signature.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	broadcastClientErrChan := make(chan error)
+	broadcastClient := NewBroadcastClient("ws://127.0.0.1:9745/", 9745, nil, 20*time.Second, broadcastClientErrChan)
+	messageReceiver, err := broadcastClient.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broadcastClient.Close()
+
+	if !broadcastClient.compression {
+		t.Fatal("permessage-deflate not negotiated")
+	}
+
+	// New messages share a compressed frame
+	for i := 0; i < 3; i++ {
+		prevAcc, feedItem, signature := newBroadcastMessage()
+		if err := b.BroadcastSingle(prevAcc, feedItem.BatchItem, signature.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectedSeqNum := big.NewInt(41)
+	for i := 0; i < 6; i++ {
+		select {
+		case err := <-broadcastClientErrChan:
+			t.Fatalf("broadcast client error: %s", err.Error())
+		case receivedMsg := <-messageReceiver:
+			if receivedMsg.FeedItem.BatchItem.LastSeqNum.Cmp(expectedSeqNum) != 0 {
+				t.Errorf("expected seqnum %d but got %d instead", expectedSeqNum, receivedMsg.FeedItem.BatchItem.LastSeqNum)
+			}
+			expectedSeqNum = new(big.Int).Add(expectedSeqNum, big.NewInt(1))
+		case <-time.After(10 * time.Second):
+			t.Fatalf("expected 6 messages, only got %d messages", i)
+		}
+	}
+}
@@ -18,6 +18,11 @@ package broadcaster
 
 import (
 	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+
 	"github.com/offchainlabs/arbitrum/packages/arb-util/arblog"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
@@ -32,17 +37,37 @@ import (
 
 var logger = arblog.Logger.With().Str("component", "broadcaster").Logger()
 
+var (
+	broadcastBatchSizeHistogram = metrics.NewRegisteredHistogram("arbitrum/feed/broadcast/batch-size", nil, metrics.NewExpDecaySample(1028, 0.015))
+	broadcastFrameMeter         = metrics.NewRegisteredMeter("arbitrum/feed/broadcast/frames", nil)
+	broadcastMessageMeter       = metrics.NewRegisteredMeter("arbitrum/feed/broadcast/messages", nil)
+)
+
 type Broadcaster struct {
-	server           *wsbroadcastserver.WSBroadcastServer
-	catchupBuffer    wsbroadcastserver.CatchupBuffer
+	server        *wsbroadcastserver.WSBroadcastServer
+	catchupBuffer wsbroadcastserver.CatchupBuffer
+	coalesce      configuration.FeedCoalesce
+
+	// Guards the messages waiting to share a frame, and keeps confirmations
+	// ordered after them
+	mutex            sync.Mutex
+	pending          []*BroadcastFeedMessage
+	flushTimer       *time.Timer
+	stopped          bool
 	prevConfirmedAcc common.Hash
 }
 
 func NewBroadcaster(settings *configuration.FeedOutput, chainId uint64) *Broadcaster {
-	catchupBuffer := NewConfirmedAccumulatorCatchupBuffer()
+	var catchupBuffer wsbroadcastserver.CatchupBuffer
+	if len(settings.Catchup.Path) > 0 {
+		catchupBuffer = NewDiskCatchupBuffer(settings.Catchup)
+	} else {
+		catchupBuffer = NewConfirmedAccumulatorCatchupBuffer()
+	}
 	return &Broadcaster{
 		server:        wsbroadcastserver.NewWSBroadcastServer(settings, catchupBuffer, chainId),
 		catchupBuffer: catchupBuffer,
+		coalesce:      settings.Coalesce,
 	}
 }
 
@@ -51,12 +76,15 @@ func (b *Broadcaster) ClientCount() int32 {
 }
 
 func (b *Broadcaster) Start(ctx context.Context) (chan error, error) {
+	if diskBuffer, ok := b.catchupBuffer.(*DiskCatchupBuffer); ok {
+		if err := diskBuffer.Load(); err != nil {
+			return nil, err
+		}
+	}
 	return b.server.Start(ctx)
 }
 
 func (b *Broadcaster) BroadcastSingle(prevAcc common.Hash, batchItem inbox.SequencerBatchItem, signature []byte) error {
-	var broadcastMessages []*BroadcastFeedMessage
-
 	logger.Debug().Hex("acc", batchItem.Accumulator.Bytes()).Str("lastseqnum", batchItem.LastSeqNum.String()).Msg("sending batch Item")
 
 	msg := BroadcastFeedMessage{
@@ -67,35 +95,118 @@ func (b *Broadcaster) BroadcastSingle(prevAcc common.Hash, batchItem inbox.Seque
 		Signature: signature,
 	}
 
-	broadcastMessages = append(broadcastMessages, &msg)
-
-	bm := BroadcastMessage{
-		Version:  1,
-		Messages: broadcastMessages,
-	}
-
-	b.server.Broadcast(bm)
-	return nil
+	return b.BroadcastFeedMessages([]*BroadcastFeedMessage{&msg})
 }
 
 func (b *Broadcaster) Broadcast(prevAcc common.Hash, batchItems []inbox.SequencerBatchItem, dataSigner func([]byte) ([]byte, error)) error {
+	broadcastMessages := make([]*BroadcastFeedMessage, 0, len(batchItems))
 	for _, item := range batchItems {
 		signature, err := dataSigner(hashing.SoliditySHA3WithPrefix(hashing.Bytes32(item.Accumulator)).Bytes())
 		if err != nil {
 			return err
 		}
 
-		err = b.BroadcastSingle(prevAcc, item, signature)
-		if err != nil {
-			return err
-		}
+		logger.Debug().Hex("acc", item.Accumulator.Bytes()).Str("lastseqnum", item.LastSeqNum.String()).Msg("sending batch Item")
+
+		broadcastMessages = append(broadcastMessages, &BroadcastFeedMessage{
+			FeedItem: SequencerFeedItem{
+				BatchItem: item,
+				PrevAcc:   prevAcc,
+			},
+			Signature: signature,
+		})
 		prevAcc = item.Accumulator
 	}
 
+	return b.BroadcastFeedMessages(broadcastMessages)
+}
+
+// BroadcastFeedMessages sends already signed messages to clients. Messages
+// are combined into frames of up to the configured number of items, waiting
+// up to the configured delay for more to arrive
+func (b *Broadcaster) BroadcastFeedMessages(messages []*BroadcastFeedMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	maxItems := b.maxFrameItems()
+	for _, msg := range messages {
+		// Catch-up buffers check reorgs against the first message of a frame,
+		// so a message that doesn't follow on from the last starts a new one
+		if len(b.pending) > 0 && b.pending[len(b.pending)-1].FeedItem.BatchItem.Accumulator != msg.FeedItem.PrevAcc {
+			b.flushPending()
+		}
+		b.pending = append(b.pending, msg)
+		if len(b.pending) >= maxItems {
+			b.flushPending()
+		}
+	}
+
+	if len(b.pending) > 0 {
+		if b.coalesce.MaxDelay <= 0 {
+			b.flushPending()
+		} else if b.flushTimer == nil {
+			b.flushTimer = time.AfterFunc(b.coalesce.MaxDelay, b.flushOnTimer)
+		}
+	}
+
 	return nil
 }
 
+func (b *Broadcaster) maxFrameItems() int {
+	if b.coalesce.MaxItems < 1 {
+		return 1
+	}
+	return b.coalesce.MaxItems
+}
+
+func (b *Broadcaster) flushOnTimer() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.stopped {
+		b.flushPending()
+	}
+}
+
+// flushPending broadcasts every waiting message, must be called with the
+// mutex held
+func (b *Broadcaster) flushPending() {
+	if b.flushTimer != nil {
+		b.flushTimer.Stop()
+		b.flushTimer = nil
+	}
+
+	maxItems := b.maxFrameItems()
+	for len(b.pending) > 0 {
+		count := len(b.pending)
+		if count > maxItems {
+			count = maxItems
+		}
+		bm := BroadcastMessage{
+			Version:  1,
+			Messages: b.pending[:count:count],
+		}
+		b.server.Broadcast(bm)
+		b.pending = b.pending[count:]
+
+		broadcastBatchSizeHistogram.Update(int64(count))
+		broadcastFrameMeter.Mark(1)
+		broadcastMessageMeter.Mark(int64(count))
+	}
+	b.pending = nil
+}
+
 func (b *Broadcaster) ConfirmedAccumulator(accumulator common.Hash) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// Clients should see messages before their confirmation
+	b.flushPending()
+
 	logger.
 		Debug().
 		Hex("prevAcc", b.prevConfirmedAcc.Bytes()).
@@ -123,5 +234,15 @@ func (b *Broadcaster) MessageCacheCount() int {
 }
 
 func (b *Broadcaster) Stop() {
+	b.mutex.Lock()
+	b.flushPending()
+	b.stopped = true
+	b.mutex.Unlock()
+
 	b.server.Stop()
+	if diskBuffer, ok := b.catchupBuffer.(*DiskCatchupBuffer); ok {
+		if err := diskBuffer.Close(); err != nil {
+			logger.Warn().Err(err).Msg("error closing catch-up buffer")
+		}
+	}
 }
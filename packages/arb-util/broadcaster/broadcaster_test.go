@@ -252,3 +252,100 @@ func TestBroadcasterReorganizesCacheBasedOnAccumulator(t *testing.T) {
 
 	//TODO: Add some more assertions about the state of the cache
 }
+
+func readBroadcastMessage(t *testing.T, conn net.Conn) BroadcastMessage {
+	t.Helper()
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := wsutil.ReadServerData(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bm BroadcastMessage
+	if err := json.Unmarshal(data, &bm); err != nil {
+		t.Fatal(err)
+	}
+	return bm
+}
+
+func TestBroadcasterCoalescesMessages(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	broadcasterSettings := configuration.DefaultFeedOutput()
+	broadcasterSettings.Port = "9644"
+	broadcasterSettings.Coalesce.MaxItems = 4
+	broadcasterSettings.Coalesce.MaxDelay = 100 * time.Millisecond
+
+	b := NewBroadcaster(broadcasterSettings, chainId)
+
+	_, err := b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop()
+
+	conn, _, _, err := ws.DefaultDialer.Dial(ctx, "ws://127.0.0.1:9644/")
+	if err != nil {
+		t.Fatalf("Can not connect: %v\n", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	registerTimeout := time.After(2 * time.Second)
+	for b.ClientCount() != 1 {
+		select {
+		case <-registerTimeout:
+			t.Fatal("client not registered")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	newBroadcastMessage := SequencedMessages()
+	var lastAcc common.Hash
+	for i := 0; i < 10; i++ {
+		prevAcc, feedItem, signature := newBroadcastMessage()
+		err = b.BroadcastSingle(prevAcc, feedItem.BatchItem, signature.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastAcc = feedItem.BatchItem.Accumulator
+	}
+
+	// Full frames are sent right away and the rest once the window closes
+	for _, expected := range []int{4, 4, 2} {
+		bm := readBroadcastMessage(t, conn)
+		if len(bm.Messages) != expected {
+			t.Errorf("expected %d messages in frame, got %d", expected, len(bm.Messages))
+		}
+	}
+
+	// A reorg starts a new frame
+	prevAcc, feedItem, signature := newBroadcastMessage()
+	err = b.BroadcastSingle(prevAcc, feedItem.BatchItem, signature.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, reorgItem, reorgSignature := newBroadcastMessage()
+	err = b.BroadcastSingle(lastAcc, reorgItem.BatchItem, reorgSignature.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Waiting messages are sent before a confirmation
+	b.ConfirmedAccumulator(lastAcc)
+	b.ConfirmedAccumulator(lastAcc)
+
+	bm := readBroadcastMessage(t, conn)
+	if len(bm.Messages) != 1 || bm.Messages[0].FeedItem.BatchItem.Accumulator != feedItem.BatchItem.Accumulator {
+		t.Error("expected frame with message before reorg")
+	}
+	bm = readBroadcastMessage(t, conn)
+	if len(bm.Messages) != 1 || bm.Messages[0].FeedItem.PrevAcc != lastAcc {
+		t.Error("expected frame with reorged message")
+	}
+	bm = readBroadcastMessage(t, conn)
+	if !bm.ConfirmedAccumulator.IsConfirmed || len(bm.Messages) != 0 {
+		t.Error("expected confirmation after messages")
+	}
+}
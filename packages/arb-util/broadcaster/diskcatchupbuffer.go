@@ -0,0 +1,505 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package broadcaster
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/wsbroadcastserver"
+)
+
+const (
+	catchupSegmentSuffix = ".seg"
+	// Messages written to a segment file before starting the next one
+	catchupSegmentMessages = 4096
+	// Messages sent to a registering client per write
+	catchupChunkMessages = 1024
+	// Each record is framed as [payload length u32][crc32 u32][payload]
+	catchupRecordHeader = 8
+)
+
+type catchupEntry struct {
+	lastSeqNum *big.Int
+	acc        common.Hash
+	timestamp  time.Time
+	segment    uint64
+	offset     int64
+	length     int64
+}
+
+// DiskCatchupBuffer keeps broadcast messages in a log of segment files so
+// that clients can catch up from any sequence number still inside
+// retention, including after the broadcaster restarts. Unlike
+// ConfirmedAccumulatorCatchupBuffer, messages are kept after they're
+// confirmed and only dropped by count and age
+type DiskCatchupBuffer struct {
+	settings configuration.FeedCatchup
+
+	mutex           sync.Mutex
+	entries         []*catchupEntry
+	firstSegment    uint64
+	segment         uint64
+	segmentSize     int64
+	segmentMessages int
+	file            *os.File
+	cacheSize       int32
+}
+
+func NewDiskCatchupBuffer(settings configuration.FeedCatchup) *DiskCatchupBuffer {
+	return &DiskCatchupBuffer{settings: settings}
+}
+
+func (q *DiskCatchupBuffer) segmentPath(segment uint64) string {
+	return filepath.Join(q.settings.Path, fmt.Sprintf("%016x%s", segment, catchupSegmentSuffix))
+}
+
+func encodeCatchupRecord(msg *BroadcastFeedMessage, timestamp time.Time) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding catch-up message")
+	}
+	payload := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(payload, uint64(timestamp.UnixNano()))
+	payload = append(payload, data...)
+
+	record := make([]byte, catchupRecordHeader, catchupRecordHeader+len(payload))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	return append(record, payload...), nil
+}
+
+// decodeCatchupRecord decodes the record at the start of data, returning
+// its total length
+func decodeCatchupRecord(data []byte) (*BroadcastFeedMessage, time.Time, int64, error) {
+	if len(data) < catchupRecordHeader {
+		return nil, time.Time{}, 0, errors.New("truncated catch-up record header")
+	}
+	payloadLen := int64(binary.BigEndian.Uint32(data[:4]))
+	checksum := binary.BigEndian.Uint32(data[4:8])
+	if payloadLen < 8 || int64(len(data)) < catchupRecordHeader+payloadLen {
+		return nil, time.Time{}, 0, errors.New("truncated catch-up record")
+	}
+	payload := data[catchupRecordHeader : catchupRecordHeader+payloadLen]
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, time.Time{}, 0, errors.New("catch-up record checksum mismatch")
+	}
+	timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(payload[:8])))
+	var msg BroadcastFeedMessage
+	if err := json.Unmarshal(payload[8:], &msg); err != nil {
+		return nil, time.Time{}, 0, errors.Wrap(err, "error decoding catch-up message")
+	}
+	return &msg, timestamp, catchupRecordHeader + payloadLen, nil
+}
+
+func (q *DiskCatchupBuffer) segmentsOnDisk() ([]uint64, error) {
+	files, err := ioutil.ReadDir(q.settings.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading catch-up directory")
+	}
+	var segments []uint64
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, catchupSegmentSuffix) {
+			continue
+		}
+		segment, err := strconv.ParseUint(strings.TrimSuffix(name, catchupSegmentSuffix), 16, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+// Load reads the messages retained on disk, discarding anything after a
+// torn or corrupt record, and opens the log for writing
+func (q *DiskCatchupBuffer) Load() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.file != nil {
+		_ = q.file.Close()
+		q.file = nil
+	}
+	q.entries = nil
+	q.segmentSize = 0
+	q.segmentMessages = 0
+
+	if err := os.MkdirAll(q.settings.Path, os.ModePerm); err != nil {
+		return errors.Wrap(err, "error creating catch-up directory")
+	}
+	segments, err := q.segmentsOnDisk()
+	if err != nil {
+		return err
+	}
+
+	q.firstSegment = 0
+	q.segment = 0
+	if len(segments) > 0 {
+		q.firstSegment = segments[0]
+		q.segment = segments[len(segments)-1]
+	}
+	for i, segment := range segments {
+		data, err := ioutil.ReadFile(q.segmentPath(segment))
+		if err != nil {
+			return errors.Wrap(err, "error reading catch-up segment")
+		}
+		var offset int64
+		for offset < int64(len(data)) {
+			msg, timestamp, length, err := decodeCatchupRecord(data[offset:])
+			if err != nil {
+				logger.Warn().Err(err).Str("segment", q.segmentPath(segment)).Int64("offset", offset).Msg("discarding end of catch-up log")
+				break
+			}
+			q.entries = append(q.entries, &catchupEntry{
+				lastSeqNum: msg.FeedItem.BatchItem.LastSeqNum,
+				acc:        msg.FeedItem.BatchItem.Accumulator,
+				timestamp:  timestamp,
+				segment:    segment,
+				offset:     offset,
+				length:     length,
+			})
+			offset += length
+		}
+		if offset < int64(len(data)) {
+			// Later segments don't follow on from a damaged one
+			if err := os.Truncate(q.segmentPath(segment), offset); err != nil {
+				return errors.Wrap(err, "error truncating catch-up segment")
+			}
+			for _, later := range segments[i+1:] {
+				if err := os.Remove(q.segmentPath(later)); err != nil {
+					return errors.Wrap(err, "error removing catch-up segment")
+				}
+			}
+			q.segment = segment
+			break
+		}
+	}
+
+	for i := len(q.entries) - 1; i >= 0 && q.entries[i].segment == q.segment; i-- {
+		q.segmentSize = q.entries[i].offset + q.entries[i].length
+		q.segmentMessages++
+	}
+	if err := q.openSegment(); err != nil {
+		return err
+	}
+	q.prune(time.Now())
+	atomic.StoreInt32(&q.cacheSize, int32(len(q.entries)))
+
+	logger.Info().Int("count", len(q.entries)).Str("path", q.settings.Path).Msg("loaded catch-up messages")
+
+	return nil
+}
+
+func (q *DiskCatchupBuffer) openSegment() error {
+	file, err := os.OpenFile(q.segmentPath(q.segment), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "error opening catch-up segment")
+	}
+	// Drop anything past the last whole record
+	if err := file.Truncate(q.segmentSize); err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "error truncating catch-up segment")
+	}
+	q.file = file
+	return nil
+}
+
+// Close flushes the log to disk
+func (q *DiskCatchupBuffer) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Sync()
+	if closeErr := q.file.Close(); err == nil {
+		err = closeErr
+	}
+	q.file = nil
+	return err
+}
+
+func (q *DiskCatchupBuffer) removeSegments(from, to uint64) {
+	for segment := from; segment < to; segment++ {
+		if err := os.Remove(q.segmentPath(segment)); err != nil && !os.IsNotExist(err) {
+			logger.Warn().Err(err).Str("segment", q.segmentPath(segment)).Msg("error removing catch-up segment")
+		}
+	}
+}
+
+// truncate drops every message after the first count
+func (q *DiskCatchupBuffer) truncate(count int) error {
+	if count >= len(q.entries) {
+		return nil
+	}
+	if count == 0 {
+		// Nothing retained chains on, so start a fresh log
+		if err := q.file.Close(); err != nil {
+			logger.Warn().Err(err).Msg("error closing catch-up segment")
+		}
+		q.file = nil
+		q.removeSegments(q.firstSegment, q.segment+1)
+		q.entries = q.entries[:0]
+		q.segment++
+		q.firstSegment = q.segment
+		q.segmentSize = 0
+		q.segmentMessages = 0
+		return q.openSegment()
+	}
+
+	first := q.entries[count]
+	if first.segment != q.segment {
+		if err := q.file.Close(); err != nil {
+			logger.Warn().Err(err).Msg("error closing catch-up segment")
+		}
+		q.file = nil
+		q.removeSegments(first.segment+1, q.segment+1)
+		q.segment = first.segment
+	}
+	q.entries = q.entries[:count]
+	q.segmentSize = first.offset
+	q.segmentMessages = 0
+	for i := count - 1; i >= 0 && q.entries[i].segment == q.segment; i-- {
+		q.segmentMessages++
+	}
+	if q.file == nil {
+		return q.openSegment()
+	}
+	if err := q.file.Truncate(q.segmentSize); err != nil {
+		return errors.Wrap(err, "error truncating catch-up segment")
+	}
+	return nil
+}
+
+func (q *DiskCatchupBuffer) append(msg *BroadcastFeedMessage, timestamp time.Time) error {
+	record, err := encodeCatchupRecord(msg, timestamp)
+	if err != nil {
+		return err
+	}
+	if q.segmentMessages >= catchupSegmentMessages {
+		if err := q.file.Close(); err != nil {
+			logger.Warn().Err(err).Msg("error closing catch-up segment")
+		}
+		q.file = nil
+		q.segment++
+		q.segmentSize = 0
+		q.segmentMessages = 0
+		if err := q.openSegment(); err != nil {
+			return err
+		}
+	}
+	if _, err := q.file.Write(record); err != nil {
+		// Drop any partial write so the next record starts cleanly
+		_ = q.file.Truncate(q.segmentSize)
+		return errors.Wrap(err, "error writing catch-up message")
+	}
+	q.entries = append(q.entries, &catchupEntry{
+		lastSeqNum: msg.FeedItem.BatchItem.LastSeqNum,
+		acc:        msg.FeedItem.BatchItem.Accumulator,
+		timestamp:  timestamp,
+		segment:    q.segment,
+		offset:     q.segmentSize,
+		length:     int64(len(record)),
+	})
+	q.segmentSize += int64(len(record))
+	q.segmentMessages++
+	return nil
+}
+
+// prune drops messages outside of retention, removing segment files once
+// none of their messages are left
+func (q *DiskCatchupBuffer) prune(now time.Time) {
+	drop := 0
+	for drop < len(q.entries) {
+		overCount := q.settings.MaxCount > 0 && len(q.entries)-drop > q.settings.MaxCount
+		overAge := q.settings.MaxAge > 0 && now.Sub(q.entries[drop].timestamp) > q.settings.MaxAge
+		if !overCount && !overAge {
+			break
+		}
+		drop++
+	}
+	q.entries = q.entries[drop:]
+
+	oldestNeeded := q.segment
+	if len(q.entries) > 0 {
+		oldestNeeded = q.entries[0].segment
+	}
+	if oldestNeeded > q.firstSegment {
+		q.removeSegments(q.firstSegment, oldestNeeded)
+		q.firstSegment = oldestNeeded
+	}
+}
+
+// startIndex returns the index of the first message a client requesting
+// requestedSeqNum should be sent
+func (q *DiskCatchupBuffer) startIndex(requestedSeqNum *big.Int) int {
+	requestedLastSeqNum := new(big.Int).Sub(requestedSeqNum, big.NewInt(1))
+	return sort.Search(len(q.entries), func(i int) bool {
+		return q.entries[i].lastSeqNum.Cmp(requestedLastSeqNum) >= 0
+	})
+}
+
+// readMessages reads the messages in entries from disk
+func (q *DiskCatchupBuffer) readMessages(entries []*catchupEntry) ([]*BroadcastFeedMessage, error) {
+	messages := make([]*BroadcastFeedMessage, 0, len(entries))
+	var file *os.File
+	var fileSegment uint64
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+	for _, entry := range entries {
+		if file == nil || fileSegment != entry.segment {
+			if file != nil {
+				_ = file.Close()
+			}
+			var err error
+			file, err = os.Open(q.segmentPath(entry.segment))
+			if err != nil {
+				return nil, errors.Wrap(err, "error opening catch-up segment")
+			}
+			fileSegment = entry.segment
+		}
+		data := make([]byte, entry.length)
+		if _, err := file.ReadAt(data, entry.offset); err != nil {
+			return nil, errors.Wrap(err, "error reading catch-up message")
+		}
+		msg, _, _, err := decodeCatchupRecord(data)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func (q *DiskCatchupBuffer) OnRegisterClient(ctx context.Context, clientConnection *wsbroadcastserver.ClientConnection) error {
+	start := time.Now()
+
+	// send the newly connected client any retained messages starting with requested sequence number.
+	// The entries are copied so that the messages can be read and sent without holding the mutex.
+	// Segments are only truncated or removed by OnDoBroadcast, which the client manager doesn't
+	// call until the client is registered
+	q.mutex.Lock()
+	q.prune(start)
+	atomic.StoreInt32(&q.cacheSize, int32(len(q.entries)))
+	retained := q.entries[q.startIndex(clientConnection.RequestedSeqNum()):]
+	entries := make([]*catchupEntry, len(retained))
+	copy(entries, retained)
+	q.mutex.Unlock()
+
+	sent := 0
+	for len(entries) > 0 {
+		chunk := entries
+		if len(chunk) > catchupChunkMessages {
+			chunk = chunk[:catchupChunkMessages]
+		}
+		entries = entries[len(chunk):]
+		messages, err := q.readMessages(chunk)
+		if err != nil {
+			logger.Error().Err(err).Str("client", clientConnection.Name).Msg("error reading client cached messages")
+			return err
+		}
+		err = clientConnection.Write(&BroadcastMessage{
+			Version:  1,
+			Messages: messages,
+		})
+		if err != nil {
+			logger.Error().Err(err).Str("client", clientConnection.Name).Str("elapsed", time.Since(start).String()).Msg("error sending client cached messages")
+			return err
+		}
+		sent += len(messages)
+	}
+
+	logger.Info().Str("client", clientConnection.Name).Int("sent", sent).Str("elapsed", time.Since(start).String()).Msg("client registered")
+
+	return nil
+}
+
+func (q *DiskCatchupBuffer) OnDoBroadcast(bmi interface{}) error {
+	bm := bmi.(BroadcastMessage)
+	if len(bm.Messages) == 0 {
+		// Confirmations don't affect retention
+		return nil
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.file == nil {
+		return nil
+	}
+
+	// A failure to keep messages for catch-up shouldn't hold back the live feed
+	if err := q.addMessages(bm.Messages); err != nil {
+		logger.Error().Err(err).Msg("error saving catch-up messages")
+	}
+	q.prune(time.Now())
+	atomic.StoreInt32(&q.cacheSize, int32(len(q.entries)))
+
+	return nil
+}
+
+func (q *DiskCatchupBuffer) addMessages(messages []*BroadcastFeedMessage) error {
+	prevAcc := messages[0].FeedItem.PrevAcc
+	if len(q.entries) > 0 && q.entries[len(q.entries)-1].acc != prevAcc {
+		logger.Debug().Hex("acc", messages[0].FeedItem.BatchItem.Accumulator.Bytes()).Msg("broadcaster reorg")
+		i := len(q.entries) - 1
+		for ; i >= 0; i-- {
+			if q.entries[i].acc == prevAcc {
+				break
+			}
+		}
+		// If nothing matches, all existing messages are out of date
+		if err := q.truncate(i + 1); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for _, msg := range messages {
+		if err := q.append(msg, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *DiskCatchupBuffer) GetMessageCount() int {
+	return int(atomic.LoadInt32(&q.cacheSize))
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package broadcaster
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/wsbroadcastserver"
+)
+
+func chainedAccumulator(seqNum int64, fork byte) common.Hash {
+	return common.Hash{byte(seqNum), byte(seqNum >> 8), fork}
+}
+
+// createChainedBroadcastMessage returns a message whose accumulator is
+// derived from its sequence number and which follows on from prevAcc
+func createChainedBroadcastMessage(seqNum int64, prevAcc common.Hash, fork byte) BroadcastMessage {
+	return BroadcastMessage{
+		Version: 1,
+		Messages: []*BroadcastFeedMessage{{
+			FeedItem: SequencerFeedItem{
+				BatchItem: inbox.SequencerBatchItem{
+					LastSeqNum:        big.NewInt(seqNum),
+					Accumulator:       chainedAccumulator(seqNum, fork),
+					TotalDelayedCount: big.NewInt(0),
+					SequencerMessage:  []byte{byte(seqNum), fork},
+				},
+				PrevAcc: prevAcc,
+			},
+			Signature: []byte{},
+		}},
+	}
+}
+
+func broadcastChain(t *testing.T, buffer *DiskCatchupBuffer, from, to int64, prevAcc common.Hash, fork byte) common.Hash {
+	t.Helper()
+	for seqNum := from; seqNum < to; seqNum++ {
+		bm := createChainedBroadcastMessage(seqNum, prevAcc, fork)
+		if err := buffer.OnDoBroadcast(bm); err != nil {
+			t.Fatal(err)
+		}
+		prevAcc = bm.Messages[0].FeedItem.BatchItem.Accumulator
+	}
+	return prevAcc
+}
+
+func loadDiskCatchupBuffer(t *testing.T, settings configuration.FeedCatchup) *DiskCatchupBuffer {
+	t.Helper()
+	buffer := NewDiskCatchupBuffer(settings)
+	if err := buffer.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer
+}
+
+func checkCatchupMessages(t *testing.T, buffer *DiskCatchupBuffer, requestedSeqNum int64, expectedFirst int64, expectedCount int) []*BroadcastFeedMessage {
+	t.Helper()
+	entries := buffer.entries[buffer.startIndex(big.NewInt(requestedSeqNum)):]
+	messages, err := buffer.readMessages(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != expectedCount {
+		t.Fatalf("expected %d messages, got %d messages", expectedCount, len(messages))
+	}
+	if expectedCount > 0 && messages[0].FeedItem.BatchItem.LastSeqNum.Int64() != expectedFirst {
+		t.Errorf("expected lastSeqNum %d, got %d", expectedFirst, messages[0].FeedItem.BatchItem.LastSeqNum.Int64())
+	}
+	return messages
+}
+
+func TestDiskCatchupBufferRestart(t *testing.T) {
+	settings := configuration.FeedCatchup{Path: t.TempDir()}
+	buffer := loadDiskCatchupBuffer(t, settings)
+	// Span several segments
+	count := int64(catchupSegmentMessages*2 + 10)
+	lastAcc := broadcastChain(t, buffer, 0, count, common.Hash{}, 0)
+
+	// Confirmations don't drop anything
+	if err := buffer.OnDoBroadcast(BroadcastMessage{Version: 1, ConfirmedAccumulator: ConfirmedAccumulator{IsConfirmed: true, Accumulator: lastAcc}}); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.GetMessageCount() != int(count) {
+		t.Fatalf("expected %d messages, got %d", count, buffer.GetMessageCount())
+	}
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer = loadDiskCatchupBuffer(t, settings)
+	defer buffer.Close()
+	if buffer.GetMessageCount() != int(count) {
+		t.Fatalf("expected %d messages after restart, got %d", count, buffer.GetMessageCount())
+	}
+	checkCatchupMessages(t, buffer, 0, 0, int(count))
+	messages := checkCatchupMessages(t, buffer, 5000, 4999, int(count)-4999)
+	if messages[0].FeedItem.BatchItem.Accumulator != chainedAccumulator(4999, 0) {
+		t.Error("wrong message contents")
+	}
+	checkCatchupMessages(t, buffer, count+1, 0, 0)
+
+	// New messages continue the log
+	broadcastChain(t, buffer, count, count+5, lastAcc, 0)
+	checkCatchupMessages(t, buffer, count, count-1, 6)
+}
+
+func TestDiskCatchupBufferReorg(t *testing.T) {
+	settings := configuration.FeedCatchup{Path: t.TempDir()}
+	buffer := loadDiskCatchupBuffer(t, settings)
+	broadcastChain(t, buffer, 0, catchupSegmentMessages+20, common.Hash{}, 0)
+
+	// Reorg back into the previous segment
+	forkAcc := chainedAccumulator(4000, 0)
+	broadcastChain(t, buffer, 4001, 4011, forkAcc, 1)
+	if buffer.GetMessageCount() != 4011 {
+		t.Fatalf("expected 4011 messages, got %d", buffer.GetMessageCount())
+	}
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer = loadDiskCatchupBuffer(t, settings)
+	messages := checkCatchupMessages(t, buffer, 4001, 4000, 11)
+	if messages[1].FeedItem.BatchItem.SequencerMessage[1] != 1 {
+		t.Error("expected reorged message")
+	}
+
+	// Nothing matches, so everything is replaced
+	broadcastChain(t, buffer, 50, 60, common.Hash{9, 9, 9}, 2)
+	if buffer.GetMessageCount() != 10 {
+		t.Fatalf("expected 10 messages, got %d", buffer.GetMessageCount())
+	}
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer = loadDiskCatchupBuffer(t, settings)
+	defer buffer.Close()
+	checkCatchupMessages(t, buffer, 0, 50, 10)
+}
+
+func TestDiskCatchupBufferRetention(t *testing.T) {
+	settings := configuration.FeedCatchup{Path: t.TempDir(), MaxCount: catchupSegmentMessages + 100}
+	buffer := loadDiskCatchupBuffer(t, settings)
+	broadcastChain(t, buffer, 0, catchupSegmentMessages*3, common.Hash{}, 0)
+	if buffer.GetMessageCount() != settings.MaxCount {
+		t.Fatalf("expected %d messages, got %d", settings.MaxCount, buffer.GetMessageCount())
+	}
+	first := int64(catchupSegmentMessages*3 - settings.MaxCount)
+	checkCatchupMessages(t, buffer, 0, first, settings.MaxCount)
+
+	// Segments without retained messages are removed
+	segments, err := buffer.segmentsOnDisk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 {
+		t.Errorf("expected 2 segments, got %d", len(segments))
+	}
+
+	buffer.settings.MaxAge = time.Hour
+	buffer.prune(time.Now().Add(2 * time.Hour))
+	if len(buffer.entries) != 0 {
+		t.Errorf("expected all messages to expire, got %d", len(buffer.entries))
+	}
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskCatchupBufferTornWrite(t *testing.T) {
+	settings := configuration.FeedCatchup{Path: t.TempDir()}
+	buffer := loadDiskCatchupBuffer(t, settings)
+	lastAcc := broadcastChain(t, buffer, 0, 10, common.Hash{}, 0)
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash partway through writing a message
+	record, err := encodeCatchupRecord(createChainedBroadcastMessage(10, lastAcc, 0).Messages[0], time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(buffer.segmentPath(0), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(record[:len(record)-5]); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer = loadDiskCatchupBuffer(t, settings)
+	checkCatchupMessages(t, buffer, 0, 0, 10)
+	broadcastChain(t, buffer, 10, 12, lastAcc, 0)
+	if err := buffer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer = loadDiskCatchupBuffer(t, settings)
+	defer buffer.Close()
+	checkCatchupMessages(t, buffer, 0, 0, 12)
+}
+
+func TestDiskCatchupBufferRegisterUnlocked(t *testing.T) {
+	settings := configuration.FeedCatchup{Path: t.TempDir()}
+	buffer := loadDiskCatchupBuffer(t, settings)
+	defer buffer.Close()
+	count := int64(catchupChunkMessages + 10)
+	lastAcc := broadcastChain(t, buffer, 0, count, common.Hash{}, 0)
+
+	// Writes to the pipe block until the client reads them
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	manager := wsbroadcastserver.NewClientManager(nil, configuration.FeedOutput{Workers: 1, Queue: 1, MaxSendQueue: 1}, buffer)
+	client := wsbroadcastserver.NewClientConnection(serverConn, nil, manager, big.NewInt(0), false)
+	registerResult := make(chan error, 1)
+	go func() {
+		registerResult <- buffer.OnRegisterClient(context.Background(), client)
+	}()
+
+	// The buffer isn't locked while the client is being sent messages
+	broadcastResult := make(chan error, 1)
+	go func() {
+		broadcastResult <- buffer.OnDoBroadcast(createChainedBroadcastMessage(count, lastAcc, 0))
+	}()
+	select {
+	case err := <-broadcastResult:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("broadcast blocked by registering client")
+	}
+
+	received := int64(0)
+	for received < count {
+		data, _, err := wsutil.ReadServerData(clientConn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg BroadcastMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		for _, feedMsg := range msg.Messages {
+			if feedMsg.FeedItem.BatchItem.LastSeqNum.Int64() != received {
+				t.Fatal("expected message", received, "got", feedMsg.FeedItem.BatchItem.LastSeqNum)
+			}
+			received++
+		}
+	}
+	if err := <-registerResult; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -131,6 +131,20 @@ type FeedOutput struct {
 	RequireVersion bool          `koanf:"require-version"`
 	Workers        int           `koanf:"workers"`
 	MaxSendQueue   int           `koanf:"max-send-queue"`
+	Compression    bool          `koanf:"compression"`
+	Catchup        FeedCatchup   `koanf:"catchup"`
+	Coalesce       FeedCoalesce  `koanf:"coalesce"`
+}
+
+type FeedCoalesce struct {
+	MaxItems int           `koanf:"max-items"`
+	MaxDelay time.Duration `koanf:"max-delay"`
+}
+
+type FeedCatchup struct {
+	Path     string        `koanf:"path"`
+	MaxCount int           `koanf:"max-count"`
+	MaxAge   time.Duration `koanf:"max-age"`
 }
 
 func DefaultFeedOutput() *FeedOutput {
@@ -143,6 +157,13 @@ func DefaultFeedOutput() *FeedOutput {
 		Queue:         1,
 		Workers:       128,
 		MaxSendQueue:  4096,
+		Catchup: FeedCatchup{
+			MaxCount: 100_000,
+			MaxAge:   24 * time.Hour,
+		},
+		Coalesce: FeedCoalesce{
+			MaxItems: 64,
+		},
 	}
 }
 
@@ -163,12 +184,19 @@ type Healthcheck struct {
 
 type Lockout struct {
 	Redis         string        `koanf:"redis"`
+	Dir           string        `koanf:"dir"`
 	SelfRPCURL    string        `koanf:"self-rpc-url"`
 	Timeout       time.Duration `koanf:"timeout"`
 	MaxLatency    time.Duration `koanf:"max-latency"`
 	SeqNumTimeout time.Duration `koanf:"seq-num-timeout"`
 }
 
+// Enabled returns true if a backend is configured to hold the sequencer
+// lockout in
+func (l *Lockout) Enabled() bool {
+	return len(l.Redis) != 0 || len(l.Dir) != 0
+}
+
 type Aggregator struct {
 	InboxAddress string `koanf:"inbox-address"`
 	MaxBatchTime int64  `koanf:"max-batch-time"`
@@ -176,8 +204,9 @@ type Aggregator struct {
 }
 
 type Tracing struct {
-	Enable    bool   `koanf:"enable"`
-	Namespace string `koanf:"namespace"`
+	Enable       bool   `koanf:"enable"`
+	Namespace    string `koanf:"namespace"`
+	AddressIndex bool   `koanf:"address-index"`
 }
 
 type NitroExport struct {
@@ -190,10 +219,24 @@ type RPC struct {
 	Port              string      `koanf:"port"`
 	Path              string      `koanf:"path"`
 	EnableL1Calls     bool        `koanf:"enable-l1-calls"`
+	BloomIndex        bool        `koanf:"bloom-index"`
+	AddressTxIndex    bool        `koanf:"address-tx-index"`
 	Tracing           Tracing     `koanf:"tracing"`
 	NitroExport       NitroExport `koanf:"nitroexport"`
 	MaxCallGas        uint64      `koanf:"max-call-gas"`
 	EnableDevopsStubs bool        `koanf:"enable-devops-stubs"`
+	EnableTxPool      bool        `koanf:"enable-txpool"`
+	RateLimit         RateLimit   `koanf:"rate-limit"`
+}
+
+// RateLimit limits transaction submission with token buckets refilled at
+// the given rate per second. A rate of 0 disables that limit
+type RateLimit struct {
+	SenderRate     float64  `koanf:"sender-rate"`
+	SenderBurst    int      `koanf:"sender-burst"`
+	IPRate         float64  `koanf:"ip-rate"`
+	IPBurst        int      `koanf:"ip-burst"`
+	TrustedProxies []string `koanf:"trusted-proxies"`
 }
 
 type S3 struct {
@@ -209,6 +252,16 @@ type L1PostingStrategy struct {
 	HighGasDelayBlocks int64   `koanf:"high-gas-delay-blocks"`
 }
 
+// BatchPosting adjusts when the sequencer posts batches. When L1 gas is
+// above the l1-posting-strategy threshold, posting is delayed only while
+// the backlog is below SmallBacklogFraction of max-batch-gas-cost. Batches
+// are posted early once UrgentDelayFraction of the inbox's max delay blocks
+// have passed since the oldest unposted message was sequenced
+type BatchPosting struct {
+	SmallBacklogFraction float64 `koanf:"small-backlog-fraction"`
+	UrgentDelayFraction  float64 `koanf:"urgent-delay-fraction"`
+}
+
 type SequencerDangerous struct {
 	ReorgOutHugeMessages            bool `koanf:"reorg-out-huge-messages" json:"reorg-out-huge-messages"`
 	PublishBatchesWithoutLockout    bool `koanf:"publish-batches-without-lockout" json:"publish-batches-without-lockout"`
@@ -218,17 +271,46 @@ type SequencerDangerous struct {
 	DisableUserMessageSequencing    bool `koanf:"disable-user-message-sequencing" json:"disable-user-message-sequencing"`
 }
 
+type SequencerAdmin struct {
+	Enable    bool   `koanf:"enable"`
+	Addr      string `koanf:"addr"`
+	Port      string `koanf:"port"`
+	Path      string `koanf:"path"`
+	TokenFile string `koanf:"token-file"`
+}
+
+type HoldingPool struct {
+	Timeout      time.Duration `koanf:"timeout"`
+	MaxTxs       int           `koanf:"max-txs"`
+	MaxPerSender int           `koanf:"max-per-sender"`
+}
+
+// SequencerIntake configures the pipeline checking incoming transactions
+// before they're queued for sequencing
+type SequencerIntake struct {
+	Workers   int `koanf:"workers"`
+	QueueSize int `koanf:"queue-size"`
+}
+
 type Sequencer struct {
 	CreateBatchBlockInterval          int64              `koanf:"create-batch-block-interval"`
 	ContinueBatchPostingBlockInterval int64              `koanf:"continue-batch-posting-block-interval"`
 	DelayedMessagesTargetDelay        int64              `koanf:"delayed-messages-target-delay"`
 	Lockout                           Lockout            `koanf:"lockout"`
 	L1PostingStrategy                 L1PostingStrategy  `koanf:"l1-posting-strategy"`
+	BatchPosting                      BatchPosting       `koanf:"batch-posting"`
 	MaxBatchGasCost                   int64              `koanf:"max-batch-gas-cost"`
 	GasRefunderAddress                string             `koanf:"gas-refunder-address"`
 	GasRefunderExtraGas               uint64             `koanf:"gas-refunder-extra-gas"`
 	Dangerous                         SequencerDangerous `koanf:"dangerous"`
 	DebugTiming                       bool               `koanf:"debug-timing"`
+	Ordering                          string             `koanf:"ordering"`
+	OrderingPriorityWindow            time.Duration      `koanf:"ordering-priority-window"`
+	OrderingQueueSize                 int                `koanf:"ordering-queue-size"`
+	HoldingPool                       HoldingPool        `koanf:"holding-pool"`
+	Admin                             SequencerAdmin     `koanf:"admin"`
+	JournalFile                       string             `koanf:"journal-file"`
+	Intake                            SequencerIntake    `koanf:"intake"`
 }
 
 type WS struct {
@@ -238,9 +320,13 @@ type WS struct {
 }
 
 type Forwarder struct {
-	Target      string `koanf:"target"`
-	Submitter   string `koanf:"submitter-address"`
-	RpcModeImpl string `koanf:"rpc-mode"`
+	Target              string        `koanf:"target"`
+	Targets             []string      `koanf:"targets"`
+	Submitter           string        `koanf:"submitter-address"`
+	RpcModeImpl         string        `koanf:"rpc-mode"`
+	HealthCheckInterval time.Duration `koanf:"health-check-interval"`
+	LockoutRedis        string        `koanf:"lockout-redis"`
+	LockoutDir          string        `koanf:"lockout-dir"`
 }
 
 type RpcMode uint8
@@ -283,10 +369,16 @@ type Node struct {
 	LogIdleSleep    time.Duration `koanf:"log-idle-sleep"`
 	RPC             RPC           `koanf:"rpc"`
 	Sequencer       Sequencer     `koanf:"sequencer"`
+	TxFilter        TxFilter      `koanf:"tx-filter"`
 	TypeImpl        string        `koanf:"type"`
 	WS              WS            `koanf:"ws"`
 }
 
+type TxFilter struct {
+	DenyListFile   string        `koanf:"deny-list-file"`
+	ReloadInterval time.Duration `koanf:"reload-interval"`
+}
+
 type NodeType uint8
 
 const (
@@ -593,6 +685,8 @@ func ParseNode(ctx context.Context) (*Config, *Wallet, *ethutils.RPCEthClient, *
 
 	f.Uint64("node.chain-id", 42161, "chain id of the arbitrum chain")
 
+	f.String("node.tx-filter.deny-list-file", "", "file of addresses and 4-byte function selectors (one per line) to reject transactions from, to or calling")
+	f.Duration("node.tx-filter.reload-interval", 10*time.Second, "how often to check the deny list file for changes (0 to disable reloading)")
 	f.String("node.forwarder.submitter-address", "", "address of the node that will submit your transaction to the chain")
 	f.String("node.forwarder.rpc-mode", "full", "RPC mode: either full, non-mutating (no eth_sendRawTransaction), or forwarding-only (only requests forwarded upstream are permitted)")
 
@@ -607,10 +701,19 @@ func ParseNode(ctx context.Context) (*Config, *Wallet, *ethutils.RPCEthClient, *
 	f.Int("node.rpc.port", 8547, "RPC port")
 	f.String("node.rpc.path", "/", "RPC path")
 	f.Bool("node.rpc.enable-l1-calls", false, "If RPC calls which query the L1 node indirectly should be allowed")
+	f.Bool("node.rpc.bloom-index", false, "maintain bloombits sections to speed up eth_getLogs over wide block ranges")
+	f.Bool("node.rpc.address-tx-index", false, "maintain an index of transaction senders and recipients for arb_getTransactionsByAddress")
 	f.Bool("node.rpc.tracing.enable", false, "enable tracing api")
 	f.String("node.rpc.tracing.namespace", "arbtrace", "rpc namespace for tracing api")
+	f.Bool("node.rpc.tracing.address-index", false, "maintain an index of trace senders and receivers to speed up trace_filter")
 	f.Uint64("node.rpc.max-call-gas", 5000000, "Max computational arbgas limit when processing eth_call and eth_estimateGas")
 	f.Bool("node.rpc.enable-devops-stubs", false, "Enable fake versions of eth_syncing and eth_netPeers")
+	f.Bool("node.rpc.enable-txpool", false, "enable the txpool api, which lists the sequencer's transactions waiting to be sequenced")
+	f.Float64("node.rpc.rate-limit.sender-rate", 0, "transactions per second accepted from each sender (0 to disable)")
+	f.Int("node.rpc.rate-limit.sender-burst", 10, "transactions accepted from a sender in a burst before sender-rate applies")
+	f.Float64("node.rpc.rate-limit.ip-rate", 0, "transactions per second accepted from each client IP over HTTP, which isn't applied to websocket requests (0 to disable)")
+	f.Int("node.rpc.rate-limit.ip-burst", 20, "transactions accepted from a client IP in a burst before ip-rate applies")
+	f.StringSlice("node.rpc.rate-limit.trusted-proxies", []string{}, "IPs or CIDR ranges of reverse proxies whose X-Forwarded-For header gives the client IP for ip-rate")
 
 	f.Bool("node.rpc.nitroexport.enable", false, "Enable rpcs for nitro export (stored locally on node)")
 	f.String("node.rpc.nitroexport.basedir", "", "Base dir for nitro export")
@@ -619,7 +722,10 @@ func ParseNode(ctx context.Context) (*Config, *Wallet, *ethutils.RPCEthClient, *
 	f.Int64("node.sequencer.continue-batch-posting-block-interval", 2, "block interval to post the next batch after posting a partial one")
 	f.Int64("node.sequencer.delayed-messages-target-delay", 12, "delay before sequencing delayed messages")
 	f.String("node.sequencer.lockout.redis", "", "sequencer lockout redis instance URL")
+	f.String("node.sequencer.lockout.dir", "", "directory shared by sequencers on the same host to hold the lockout in, instead of redis")
 	f.String("node.sequencer.lockout.self-rpc-url", "", "own RPC URL for other sequencers to failover to")
+	f.Float64("node.sequencer.batch-posting.small-backlog-fraction", 0.5, "fraction of max-batch-gas-cost below which posting may be delayed for high L1 gas")
+	f.Float64("node.sequencer.batch-posting.urgent-delay-fraction", 0.75, "fraction of the inbox's max delay blocks after the oldest unposted message at which to post regardless of gas or batch interval")
 	f.Int64("node.sequencer.max-batch-gas-cost", 2_000_000, "max L1 batch gas cost to post before splitting it up into multiple batches")
 	f.String("node.sequencer.gas-refunder-address", "", "address of the L1 gas refunder contract (optional)")
 	f.Uint64("node.sequencer.gas-refunder-extra-gas", 50_000, "amount of extra gas to supply for the gas refunder operation")
@@ -630,6 +736,20 @@ func ParseNode(ctx context.Context) (*Config, *Wallet, *ethutils.RPCEthClient, *
 	f.Bool("node.sequencer.dangerous.disable-delayed-message-sequencing", false, "disable sequencing delayed messages (DANGEROUS)")
 	f.Bool("node.sequencer.dangerous.disable-user-message-sequencing", false, "disable sequencing user messages (DANGEROUS)")
 	f.Bool("node.sequencer.debug-timing", false, "log elapsed time throughout core sequencing loop")
+	f.String("node.sequencer.ordering", "fifo", "order to sequence queued transactions in (fifo, priority or round-robin)")
+	f.Bool("node.sequencer.admin.enable", false, "enable the arbadmin RPC namespace on a separate authenticated server")
+	f.String("node.sequencer.admin.addr", "127.0.0.1", "address of the sequencer admin RPC server")
+	f.Int("node.sequencer.admin.port", 8549, "port of the sequencer admin RPC server")
+	f.String("node.sequencer.admin.path", "/", "path of the sequencer admin RPC server")
+	f.String("node.sequencer.admin.token-file", "", "file containing the bearer token required by the sequencer admin RPC server")
+	f.Duration("node.sequencer.holding-pool.timeout", 30*time.Second, "how long to hold a transaction whose nonce is ahead of its sender's before dropping it (0 to disable)")
+	f.Int("node.sequencer.holding-pool.max-txs", 4096, "maximum number of transactions to hold waiting for an earlier nonce")
+	f.Int("node.sequencer.holding-pool.max-per-sender", 64, "maximum number of transactions held per sender, which is also the largest nonce gap accepted")
+	f.Int("node.sequencer.intake.workers", 0, "number of goroutines recovering senders and checking incoming transactions (0 for one per CPU)")
+	f.Int("node.sequencer.intake.queue-size", 1024, "maximum number of incoming transactions being checked before submissions block")
+	f.String("node.sequencer.journal-file", "sequencer-journal", "file recording sequenced messages until they're posted on L1, replayed on startup (empty to disable)")
+	f.Duration("node.sequencer.ordering-priority-window", 250*time.Millisecond, "with priority ordering, a transaction can be overtaken by higher gas price bids received up to this long after it, unless ordering-queue-size transactions are queued")
+	f.Int("node.sequencer.ordering-queue-size", 0, "maximum number of transactions waiting to be sequenced before new ones block, which also ends the priority window early (0 for 10, or 1024 with priority ordering)")
 
 	f.String("node.type", "forwarder", "forwarder, aggregator, sequencer or validator")
 
@@ -882,6 +1002,16 @@ func resolveDirectoryNames(out *Config, wallet *Wallet) error {
 		wallet.Fireblocks.FeedSigner.Pathname = path.Join(out.Persistent.Chain, wallet.Fireblocks.FeedSigner.Pathname)
 	}
 
+	// Make sequencer journal relative to chain directory if not already absolute
+	if len(out.Node.Sequencer.JournalFile) > 0 && !filepath.IsAbs(out.Node.Sequencer.JournalFile) {
+		out.Node.Sequencer.JournalFile = path.Join(out.Persistent.Chain, out.Node.Sequencer.JournalFile)
+	}
+
+	// Make feed catch-up directory relative to chain directory if not already absolute
+	if len(out.Feed.Output.Catchup.Path) > 0 && !filepath.IsAbs(out.Feed.Output.Catchup.Path) {
+		out.Feed.Output.Catchup.Path = path.Join(out.Persistent.Chain, out.Feed.Output.Catchup.Path)
+	}
+
 	// Make validator smart contract wallet address relative to chain directory if not already absolute
 	if !filepath.IsAbs(out.Validator.ContractWalletAddressFilename) {
 		out.Validator.ContractWalletAddressFilename = path.Join(out.Persistent.Chain, out.Validator.ContractWalletAddressFilename)
@@ -918,10 +1048,20 @@ func AddFeedOutputOptions(f *flag.FlagSet) {
 	f.Bool("feed.output.require-version", false, "disconnect if Arbitrum-Feed-Version HTTP header not present")
 	f.Int("feed.output.workers", 100, "Number of threads to reserve for HTTP to WS upgrade")
 	f.Int("feed.output.max-send-queue", 4096, "Maximum number of messages allowed to accumulate before client is disconnected")
+	f.Bool("feed.output.compression", false, "compress messages to clients that negotiate WebSocket permessage-deflate")
+	f.Int("feed.output.coalesce.max-items", 64, "maximum number of messages to send to clients in one frame (1 to send each message in its own frame)")
+	f.Duration("feed.output.coalesce.max-delay", 0, "how long to hold messages so they can share a frame (0 to only combine messages broadcast together)")
+	f.String("feed.output.catchup.path", "", "directory to keep catch-up messages in so clients can resume after a restart (kept in memory until confirmed if empty)")
+	f.Int("feed.output.catchup.max-count", 100_000, "maximum number of catch-up messages to keep on disk (0 for no limit)")
+	f.Duration("feed.output.catchup.max-age", 24*time.Hour, "maximum age of catch-up messages kept on disk (0 for no limit)")
 }
 
 func AddForwarderTarget(f *flag.FlagSet) {
 	f.String("node.forwarder.target", "", "url of another node to send transactions through")
+	f.StringSlice("node.forwarder.targets", []string{}, "urls of standby nodes to send transactions through when the target is down")
+	f.Duration("node.forwarder.health-check-interval", 5*time.Second, "how often to check that the forwarding targets are reachable")
+	f.String("node.forwarder.lockout-redis", "", "sequencer lockout redis instance URL to find the active sequencer from")
+	f.String("node.forwarder.lockout-dir", "", "sequencer lockout directory to find the active sequencer from")
 }
 
 func AddCore(f *flag.FlagSet, maxExecutionGas int) {
@@ -33,7 +33,7 @@ import (
 
 var preLondon = false
 
-func SimulatedBackend(t *testing.T) (*backends.SimulatedBackend, []*bind.TransactOpts) {
+func SimulatedBackend(t testing.TB) (*backends.SimulatedBackend, []*bind.TransactOpts) {
 	genesisAlloc := make(map[ethcommon.Address]ethcore.GenesisAccount)
 	auths := make([]*bind.TransactOpts, 0)
 	balance, _ := new(big.Int).SetString("10000000000000000000", 10) // 10 eth in wei
@@ -71,7 +71,7 @@ func MustGenerateKey(t *testing.T) *ecdsa.PrivateKey {
 	return key
 }
 
-func FailIfError(t *testing.T, err error) {
+func FailIfError(t testing.TB, err error) {
 	t.Helper()
 	if err != nil {
 		type stackTracer interface {
@@ -18,7 +18,6 @@ package wsbroadcastserver
 
 import (
 	"context"
-	"encoding/json"
 	"math/big"
 	"math/rand"
 	"net"
@@ -28,7 +27,6 @@ import (
 	"time"
 
 	"github.com/gobwas/ws"
-	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
 )
 
@@ -41,13 +39,14 @@ type ClientConnection struct {
 	Name            string
 	clientManager   *ClientManager
 	requestedSeqNum *big.Int
+	compression     bool
 
 	lastHeardUnix int64
 	cancelFunc    context.CancelFunc
 	out           chan []byte
 }
 
-func NewClientConnection(conn net.Conn, desc *netpoll.Desc, clientManager *ClientManager, newRequestedSeqNum *big.Int) *ClientConnection {
+func NewClientConnection(conn net.Conn, desc *netpoll.Desc, clientManager *ClientManager, newRequestedSeqNum *big.Int, compression bool) *ClientConnection {
 	var requestedSeqNum *big.Int
 	if newRequestedSeqNum != nil {
 		requestedSeqNum = newRequestedSeqNum
@@ -60,6 +59,7 @@ func NewClientConnection(conn net.Conn, desc *netpoll.Desc, clientManager *Clien
 		Name:            conn.RemoteAddr().String() + strconv.Itoa(rand.Intn(10)),
 		clientManager:   clientManager,
 		requestedSeqNum: requestedSeqNum,
+		compression:     compression,
 		lastHeardUnix:   time.Now().Unix(),
 		out:             make(chan []byte, clientManager.settings.MaxSendQueue),
 	}
@@ -131,21 +131,16 @@ func (cc *ClientConnection) readRequest(ctx context.Context, timeout time.Durati
 
 	atomic.StoreInt64(&cc.lastHeardUnix, time.Now().Unix())
 
-	return ReadData(ctx, cc.conn, nil, timeout, ws.StateServerSide)
+	return ReadData(ctx, cc.conn, nil, timeout, ws.StateServerSide, cc.compression)
 }
 
 func (cc *ClientConnection) Write(x interface{}) error {
-	writer := wsutil.NewWriter(cc.conn, ws.StateServerSide, ws.OpText)
-	encoder := json.NewEncoder(writer)
-
-	cc.ioMutex.Lock()
-	defer cc.ioMutex.Unlock()
-
-	if err := encoder.Encode(x); err != nil {
+	data, err := encodeFrame(x, cc.compression)
+	if err != nil {
 		return err
 	}
 
-	return writer.Flush()
+	return cc.writeRaw(data)
 }
 
 func (cc *ClientConnection) writeRaw(p []byte) error {
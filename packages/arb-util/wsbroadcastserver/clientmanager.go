@@ -17,19 +17,13 @@
 package wsbroadcastserver
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"math/big"
 	"net"
 	"sync/atomic"
 	"time"
 
-	"github.com/pkg/errors"
-
-	"github.com/gobwas/ws"
 	"github.com/gobwas/ws-examples/src/gopool"
-	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
 )
@@ -86,9 +80,9 @@ func (cm *ClientManager) registerClient(ctx context.Context, clientConnection *C
 }
 
 // Register registers new connection as a Client.
-func (cm *ClientManager) Register(conn net.Conn, desc *netpoll.Desc, requestedSeqNum *big.Int) *ClientConnection {
+func (cm *ClientManager) Register(conn net.Conn, desc *netpoll.Desc, requestedSeqNum *big.Int, compression bool) *ClientConnection {
 	createClient := ClientConnectionAction{
-		NewClientConnection(conn, desc, cm, requestedSeqNum),
+		NewClientConnection(conn, desc, cm, requestedSeqNum, compression),
 		true,
 	}
 
@@ -152,14 +146,28 @@ func (cm *ClientManager) doBroadcast(bm interface{}) ([]*ClientConnection, error
 		return nil, err
 	}
 
-	var buf bytes.Buffer
-	writer := wsutil.NewWriter(&buf, ws.StateServerSide, ws.OpText)
-	encoder := json.NewEncoder(writer)
-	if err := encoder.Encode(bm); err != nil {
-		return nil, errors.Wrap(err, "unable to encode message")
+	// Encode each kind of frame once and share it between clients
+	var plainNeeded, compressedNeeded bool
+	for client := range cm.clientPtrMap {
+		if client.compression {
+			compressedNeeded = true
+		} else {
+			plainNeeded = true
+		}
 	}
-	if err := writer.Flush(); err != nil {
-		return nil, errors.Wrap(err, "unable to flush message")
+	var plain, compressed []byte
+	var err error
+	if plainNeeded {
+		plain, err = encodeFrame(bm, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if compressedNeeded {
+		compressed, err = encodeFrame(bm, true)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	clientDeleteList := make([]*ClientConnection, 0, len(cm.clientPtrMap))
@@ -168,8 +176,10 @@ func (cm *ClientManager) doBroadcast(bm interface{}) ([]*ClientConnection, error
 			// Queue for client too backed up, disconnect instead of blocking on channel send
 			logger.Info().Str("client", client.Name).Int("sendQueue", len(client.out)).Msg("disconnecting because sendQueue too large")
 			clientDeleteList = append(clientDeleteList, client)
+		} else if client.compression {
+			client.out <- compressed
 		} else {
-			client.out <- buf.Bytes()
+			client.out <- plain
 		}
 	}
 
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wsbroadcastserver
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"io"
+
+	"github.com/gobwas/httphead"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/pkg/errors"
+)
+
+const deflateExtensionName = "permessage-deflate"
+
+// Each message is compressed on its own so that a frame can be encoded
+// once and shared between clients, which requires no context takeover
+var deflateParameters = wsflate.Parameters{
+	ServerNoContextTakeover: true,
+	ClientNoContextTakeover: true,
+}
+
+func newDeflateExtension() *wsflate.Extension {
+	return &wsflate.Extension{Parameters: deflateParameters}
+}
+
+// DeflateOffer is the permessage-deflate extension offered by feed clients
+func DeflateOffer() httphead.Option {
+	return deflateParameters.Option()
+}
+
+// DeflateAccepted returns whether the server accepted permessage-deflate
+func DeflateAccepted(extensions []httphead.Option) bool {
+	for _, extension := range extensions {
+		if string(extension.Name) == deflateExtensionName {
+			return true
+		}
+	}
+	return false
+}
+
+func newCompressor(w io.Writer) wsflate.Compressor {
+	// Only fails for an invalid level
+	compressor, _ := flate.NewWriter(w, flate.BestSpeed)
+	return compressor
+}
+
+func newDecompressor(r io.Reader) wsflate.Decompressor {
+	return flate.NewReader(r)
+}
+
+// encodeFrame encodes x as a server side text frame, compressing it if the
+// receiving clients negotiated permessage-deflate
+func encodeFrame(x interface{}, compress bool) ([]byte, error) {
+	var buf bytes.Buffer
+	state := ws.StateServerSide
+	if compress {
+		state |= ws.StateExtended
+	}
+	writer := wsutil.NewWriter(&buf, state, ws.OpText)
+	var dest io.Writer = writer
+	var compressor *wsflate.Writer
+	if compress {
+		var msg wsflate.MessageState
+		msg.SetCompressed(true)
+		writer.SetExtensions(&msg)
+		compressor = wsflate.NewWriter(writer, newCompressor)
+		dest = compressor
+	}
+
+	if err := json.NewEncoder(dest).Encode(x); err != nil {
+		return nil, errors.Wrap(err, "unable to encode message")
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return nil, errors.Wrap(err, "unable to compress message")
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, errors.Wrap(err, "unable to flush message")
+	}
+
+	return buf.Bytes(), nil
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/gobwas/ws/wsutil"
 )
 
@@ -59,7 +60,7 @@ func logWarn(err error, msg string) {
 	}
 }
 
-func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idleTimeout time.Duration, state ws.State) ([]byte, ws.OpCode, error) {
+func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idleTimeout time.Duration, state ws.State, compression bool) ([]byte, ws.OpCode, error) {
 	controlHandler := wsutil.ControlFrameHandler(conn, state)
 	reader := wsutil.Reader{
 		Source:          (&chainedReader{}).add(earlyFrameData).add(conn),
@@ -68,6 +69,11 @@ func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idle
 		SkipHeaderCheck: false,
 		OnIntermediate:  controlHandler,
 	}
+	var msg wsflate.MessageState
+	if compression {
+		reader.State |= ws.StateExtended
+		reader.Extensions = []wsutil.RecvExtension{&msg}
+	}
 
 	// Remove timeout when leaving this function
 	defer func(conn net.Conn) {
@@ -116,7 +122,11 @@ func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idle
 			continue
 		}
 
-		data, err := ioutil.ReadAll(&reader)
+		var source io.Reader = &reader
+		if msg.IsCompressed() {
+			source = wsflate.NewReader(source, newDecompressor)
+		}
+		data, err := ioutil.ReadAll(source)
 
 		return data, header.OpCode, err
 	}
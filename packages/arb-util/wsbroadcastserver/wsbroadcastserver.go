@@ -33,6 +33,7 @@ import (
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws-examples/src/gopool"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/mailru/easygo/netpoll"
 )
 
@@ -140,6 +141,11 @@ func (s *WSBroadcastServer) Start(ctx context.Context) (chan error, error) {
 				return header, nil
 			},
 		}
+		var deflate *wsflate.Extension
+		if s.settings.Compression {
+			deflate = newDeflateExtension()
+			upgrader.Negotiate = deflate.Negotiate
+		}
 
 		// Zero-copy upgrade to WebSocket connection.
 		hs, err := upgrader.Upgrade(safeConn)
@@ -162,8 +168,13 @@ func (s *WSBroadcastServer) Start(ctx context.Context) (chan error, error) {
 			return
 		}
 
+		var compression bool
+		if deflate != nil {
+			_, compression = deflate.Accepted()
+		}
+
 		// Register incoming client in clientManager.
-		client := clientManager.Register(safeConn, desc, requestedSeqNum)
+		client := clientManager.Register(safeConn, desc, requestedSeqNum, compression)
 
 		// Subscribe to events about conn.
 		err = s.poller.Start(desc, func(ev netpoll.Event) {